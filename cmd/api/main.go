@@ -2,56 +2,88 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 
 	"github.com/bacancy/droadmap/internal/config"
 	"github.com/bacancy/droadmap/internal/handlers"
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/metrics"
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
 	"github.com/bacancy/droadmap/internal/repository"
 	"github.com/bacancy/droadmap/internal/services"
+	"github.com/bacancy/droadmap/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
-	fmt.Println("🚀 Starting Multi-Tenant PDF Ingestion Service...")
-
 	// Load .env file (ignore error if file doesn't exist)
-	if err := godotenv.Load(); err != nil {
-		fmt.Println("⚠️  No .env file found, using environment variables or defaults")
-	}
+	envErr := godotenv.Load()
 
 	// Load configuration
 	cfg := config.Load()
-	fmt.Printf("✓ Configuration loaded\n")
+
+	// Log structured records; configured secrets are redacted wherever they
+	// appear
+	if _, err := logging.Setup(os.Stdout, logging.Config{
+		Level:  cfg.LogLevel,
+		Format: cfg.LogFormat,
+		Secrets: []string{
+			cfg.PostgresPassword,
+			cfg.MongoPass,
+			cfg.MinIOSecretKey,
+			cfg.AdminAPIKey,
+			cfg.GeminiAPIKey,
+			cfg.OpenAIAPIKey,
+		},
+	}); err != nil {
+		fatal("failed to initialize logging", err)
+	}
+	slog.Info("starting multi-tenant PDF ingestion service")
+	if envErr != nil {
+		slog.Info("no .env file found, using environment variables or defaults")
+	}
+
+	// Initialize tracing before the clients whose calls are traced
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:     cfg.TraceExporter,
+		OTLPEndpoint: cfg.OTLPEndpoint,
+		ServiceName:  cfg.TraceServiceName,
+		SampleRatio:  cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		fatal("failed to initialize tracing", err)
+	}
+	defer shutdownTracing(context.Background())
+	slog.Info("tracing configured", "exporter", cfg.TraceExporter)
 
 	// Initialize PostgreSQL (Master Database)
-	fmt.Printf("→ Connecting to PostgreSQL (Master DB)...\n")
 	postgresRepo, err := repository.NewPostgresRepository(cfg.PostgresConnString())
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to PostgreSQL: %v", err)
+		fatal("failed to connect to PostgreSQL", err)
 	}
 	defer postgresRepo.Close()
-	fmt.Printf("✓ Connected to PostgreSQL\n")
+	metrics.RegisterPostgresPool(postgresRepo.PoolStat)
+	slog.Info("connected to PostgreSQL", "host", cfg.PostgresHost, "database", cfg.PostgresDB)
 
 	// Initialize schema
 	if err := postgresRepo.InitSchema(context.Background()); err != nil {
-		log.Fatalf("❌ Failed to initialize schema: %v", err)
+		fatal("failed to initialize schema", err)
 	}
-	fmt.Printf("✓ Database schema initialized\n")
+	slog.Info("database schema initialized")
 
 	// Initialize MongoDB (Tenant Databases)
-	fmt.Printf("→ Connecting to MongoDB...\n")
 	mongoRepo, err := repository.NewMongoRepository(cfg.MongoConnString())
 	if err != nil {
-		log.Fatalf("❌ Failed to connect to MongoDB: %v", err)
+		fatal("failed to connect to MongoDB", err)
 	}
 	defer mongoRepo.Close(context.Background())
-	fmt.Printf("✓ Connected to MongoDB\n")
+	slog.Info("connected to MongoDB", "host", cfg.MongoHost)
 
 	// Initialize MinIO (Storage)
-	fmt.Printf("→ Connecting to MinIO...\n")
 	storageService, err := services.NewStorageService(
 		cfg.MinIOEndpoint,
 		cfg.MinIOAccessKey,
@@ -60,24 +92,129 @@ func main() {
 		cfg.MinIOUseSSL,
 	)
 	if err != nil {
-		log.Fatalf("❌ Failed to initialize storage: %v", err)
+		fatal("failed to initialize storage", err)
 	}
 
 	// Ensure bucket exists
 	if err := storageService.EnsureBucketExists(context.Background()); err != nil {
-		log.Fatalf("❌ Failed to ensure bucket exists: %v", err)
+		fatal("failed to ensure bucket exists", err)
+	}
+	slog.Info("storage initialized", "endpoint", cfg.MinIOEndpoint, "bucket", cfg.MinIOBucket)
+
+	// Initialize the event bus; events are recorded in an outbox and relayed
+	eventPublisher, err := services.NewEventPublisher(context.Background(), services.EventBusConfig{
+		Publisher:     cfg.EventPublisher,
+		FilePath:      cfg.EventFilePath,
+		NATSURL:       cfg.NATSURL,
+		NATSStream:    cfg.NATSStream,
+		SubjectPrefix: cfg.EventSubjectPrefix,
+		KafkaRESTURL:  cfg.KafkaRESTURL,
+		KafkaTopic:    cfg.KafkaTopic,
+		Timeout:       cfg.EventPublishTimeout,
+	})
+	if err != nil {
+		fatal("failed to initialize event publisher", err)
 	}
-	fmt.Printf("✓ Storage initialized (bucket: %s)\n", cfg.MinIOBucket)
+	outboxService := services.NewOutboxService(postgresRepo, eventPublisher, services.OutboxConfig{
+		PollInterval:   cfg.OutboxPollInterval,
+		BatchSize:      cfg.OutboxBatchSize,
+		Retention:      cfg.OutboxRetention,
+		PublishTimeout: cfg.EventPublishTimeout,
+	})
 
 	// Initialize services
-	tenantService := services.NewTenantService(postgresRepo, mongoRepo, cfg.MongoHost, cfg.MongoPort)
-	pdfService := services.NewPDFService()
-	aiService := services.NewAIService(cfg.GeminiAPIKey)
+	webhookService := services.NewWebhookService(postgresRepo, services.WebhookConfig{
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		RetryBase:    cfg.WebhookRetryBase,
+		Timeout:      cfg.WebhookTimeout,
+		Workers:      cfg.WebhookWorkers,
+		AllowPrivate: cfg.WebhookAllowPrivate,
+	})
+	tenantService := services.NewTenantService(postgresRepo, mongoRepo, webhookService, outboxService, cfg.MongoHost, cfg.MongoPort, cfg.TenantStrictMode)
+	pdfService := services.NewPDFService(cfg.PDFSecurityPolicy)
+	aiService, err := services.NewAIService(services.AIConfig{
+		Provider:        cfg.SummarizerProvider,
+		TenantProviders: cfg.SummarizerTenantProviders,
+		GeminiAPIKey:    cfg.GeminiAPIKey,
+		GeminiModel:     cfg.GeminiModel,
+		OpenAIAPIKey:    cfg.OpenAIAPIKey,
+		OpenAIBaseURL:   cfg.OpenAIBaseURL,
+		OpenAIModel:     cfg.OpenAIModel,
+		ChunkChars:      cfg.SummaryChunkChars,
+		Concurrency:     cfg.SummaryConcurrency,
+	})
+	if err != nil {
+		fatal("failed to initialize AI service", err)
+	}
+	authService := services.NewAuthService(postgresRepo, tenantService)
+	userService := services.NewUserService(postgresRepo, tenantService)
+	auditService := services.NewAuditService(postgresRepo)
+	documentService := services.NewDocumentService(postgresRepo, mongoRepo, storageService, webhookService, outboxService, cfg.PresignedURLExpiry, cfg.PresignedURLMaxExpiry)
+
+	// Register the bootstrap admin key used to issue all other keys
+	if cfg.AdminAPIKey != "" {
+		if err := authService.EnsureBootstrapKey(context.Background(), cfg.AdminAPIKey); err != nil {
+			fatal("failed to register admin API key", err)
+		}
+		slog.Info("admin key registered")
+	} else {
+		slog.Warn("ADMIN_API_KEY not set; only existing API keys can authenticate")
+	}
+
+	// Backfill search indexes for tenants created before full-text search.
+	// Tenants that fail are logged and retried on the next start; the others
+	// are served meanwhile.
+	indexed, err := tenantService.BackfillSearchIndexes(context.Background())
+	if err != nil {
+		slog.Error("search indexes incomplete", "tenants", indexed, "error", err)
+	} else {
+		slog.Info("search indexes ready", "tenants", indexed)
+	}
 
+	// Retry failed tenant provisioning in the background
+	tenantService.StartProvisioner(context.Background())
+
+	// Purge tenants soft-deleted longer than the retention period
+	purgeService := services.NewPurgeService(postgresRepo, mongoRepo, storageService, auditService, cfg.TenantPurgeRetention, cfg.TenantPurgeInterval, cfg.TenantPurgeDryRun)
+	purgeService.StartReaper(context.Background())
+	slog.Info("tenant reaper started", "retention", cfg.TenantPurgeRetention.String(), "dry_run", cfg.TenantPurgeDryRun)
+
+	// Repair inconsistencies left between Postgres, MongoDB and MinIO
+	reconcileService := services.NewReconcileService(postgresRepo, mongoRepo, storageService, tenantService, cfg.ReconcileGrace, cfg.ReconcileInterval, cfg.ReconcileDryRun)
+	reconcileService.Start(context.Background())
+	slog.Info("reconciliation scheduled", "interval", cfg.ReconcileInterval.String(), "dry_run", cfg.ReconcileDryRun)
+
+	// Local copies of streamed uploads, read by text extraction
+	uploadSpool, err := services.NewUploadSpool(cfg.UploadSpoolDir)
+	if err != nil {
+		fatal("failed to initialize upload spool", err)
+	}
+
+	// Start the asynchronous ingest pipeline
+	ingestService := services.NewIngestService(postgresRepo, mongoRepo, pdfService, aiService, storageService, webhookService, outboxService, uploadSpool, cfg.IngestWorkers, cfg.StoreChunkSummaries)
+	ingestService.Start(context.Background())
+
+	// Deliver queued webhook events, retrying failed deliveries
+	webhookService.Start(context.Background())
+
+	// Relay outbox events to the event bus
+	outboxService.Start(context.Background())
+	slog.Info("event publisher configured", "publisher", cfg.EventPublisher)
 
 	// Initialize handlers
-	uploadHandler := handlers.NewUploadHandler(tenantService, pdfService, aiService, storageService, mongoRepo)
-	tenantHandler := handlers.NewTenantHandler(tenantService)
+	uploadHandler := handlers.NewUploadHandler(tenantService, pdfService, ingestService, auditService, services.BatchLimits{
+		MaxFiles:    cfg.BatchMaxFiles,
+		MaxBytes:    cfg.BatchMaxBytes,
+		Concurrency: cfg.BatchConcurrency,
+	})
+	jobHandler := handlers.NewJobHandler(ingestService)
+	tenantHandler := handlers.NewTenantHandler(tenantService, purgeService, auditService)
+	documentHandler := handlers.NewDocumentHandler(documentService, tenantService, auditService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(authService, userService, auditService)
+	userHandler := handlers.NewUserHandler(userService, auditService)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	reconcileHandler := handlers.NewReconcileHandler(reconcileService, auditService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, tenantService, auditService)
 	healthHandler := handlers.NewHealthHandler()
 
 	// Setup Gin router
@@ -85,36 +222,100 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	router := gin.Default()
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.Logger(), gin.Recovery(), middleware.Metrics())
 
 	// Routes
 	router.GET("/health", healthHandler.HandleHealth)
 	
-	v1 := router.Group("/api/v1")
+	// Every API route requires an API key; tenant keys only reach their tenant
+	// and each route requires a minimum role
+	v1 := router.Group("/api/v1", middleware.Tracing(), middleware.Authenticate(authService))
 	{
+		viewer := v1.Group("", middleware.RequireRole(models.RoleViewer))
+		uploader := v1.Group("", middleware.RequireRole(models.RoleUploader))
+		tenantAdmin := v1.Group("", middleware.RequireRole(models.RoleTenantAdmin))
+		platformAdmin := v1.Group("", middleware.RequireRole(models.RolePlatformAdmin))
+
 		// Upload endpoint
-		v1.POST("/upload", uploadHandler.HandleUpload)
-		
+		uploader.POST("/upload", uploadHandler.HandleUpload)
+		uploader.POST("/upload/batch", uploadHandler.HandleBatchUpload)
+		viewer.GET("/jobs/:id", jobHandler.GetJob)
+
 		// Tenant management endpoints
-		v1.GET("/tenants", tenantHandler.ListTenants)
-		v1.GET("/tenants/deleted", tenantHandler.ListDeletedTenants)
-		v1.DELETE("/tenant/:name", tenantHandler.DeleteTenant)
-		v1.POST("/tenant/:name/restore", tenantHandler.RestoreTenant)
+		platformAdmin.POST("/tenants", tenantHandler.CreateTenant)
+		platformAdmin.GET("/tenants", tenantHandler.ListTenants)
+		platformAdmin.GET("/tenants/deleted", tenantHandler.ListDeletedTenants)
+		platformAdmin.GET("/tenants/purge-report", tenantHandler.PurgeReport)
+		tenantAdmin.GET("/tenant/:name", tenantHandler.GetTenant)
+		platformAdmin.POST("/tenant/:name/provision", tenantHandler.RetryProvisioning)
+		platformAdmin.DELETE("/tenant/:name", tenantHandler.DeleteTenant)
+		platformAdmin.POST("/tenant/:name/restore", tenantHandler.RestoreTenant)
+		platformAdmin.POST("/tenant/:name/purge", tenantHandler.PurgeTenant)
+
+		// API key and user management endpoints
+		tenantAdmin.POST("/keys", apiKeyHandler.IssueKey)
+		tenantAdmin.GET("/keys", apiKeyHandler.ListKeys)
+		tenantAdmin.POST("/keys/:id/rotate", apiKeyHandler.RotateKey)
+		tenantAdmin.DELETE("/keys/:id", apiKeyHandler.RevokeKey)
+		tenantAdmin.POST("/users", userHandler.CreateUser)
+		tenantAdmin.GET("/users", userHandler.ListUsers)
+		tenantAdmin.POST("/users/:id/disable", userHandler.DisableUser)
+
+		// Audit log endpoints
+		tenantAdmin.GET("/audit", auditHandler.ListAuditLogs)
+		tenantAdmin.GET("/audit/export", auditHandler.ExportAuditLogs)
+
+		// Consistency endpoints
+		platformAdmin.GET("/reconcile", reconcileHandler.CheckConsistency)
+		platformAdmin.POST("/reconcile", reconcileHandler.Reconcile)
+
+		// Document endpoints
+		viewer.GET("/tenant/:name/documents", documentHandler.ListDocuments)
+		viewer.GET("/tenant/:name/documents/:id", documentHandler.GetDocument)
+		uploader.PATCH("/tenant/:name/documents/:id", documentHandler.UpdateDocument)
+		tenantAdmin.DELETE("/tenant/:name/documents/:id", documentHandler.DeleteDocument)
+		tenantAdmin.POST("/tenant/:name/documents/:id/restore", documentHandler.RestoreDocument)
+		viewer.GET("/tenant/:name/documents/:id/download", documentHandler.DownloadDocument)
+		viewer.GET("/tenant/:name/documents/:id/url", documentHandler.GetDocumentURL)
+		viewer.GET("/tenant/:name/documents/:id/versions", documentHandler.ListDocumentVersions)
+		viewer.GET("/tenant/:name/documents/:id/versions/:version", documentHandler.GetDocumentVersion)
+		viewer.GET("/tenant/:name/documents/:id/versions/:version/download", documentHandler.DownloadDocumentVersion)
+		uploader.POST("/tenant/:name/documents/:id/versions/:version/rollback", documentHandler.RollbackDocument)
+		viewer.GET("/tenant/:name/search", documentHandler.SearchDocuments)
+
+		// Webhook endpoints
+		tenantAdmin.POST("/tenant/:name/webhooks", webhookHandler.CreateWebhook)
+		tenantAdmin.GET("/tenant/:name/webhooks", webhookHandler.ListWebhooks)
+		tenantAdmin.DELETE("/tenant/:name/webhooks/:id", webhookHandler.DeleteWebhook)
+		tenantAdmin.GET("/tenant/:name/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+		tenantAdmin.GET("/tenant/:name/webhooks/dead-letters", webhookHandler.ListDeadLetters)
+		tenantAdmin.POST("/tenant/:name/webhooks/deliveries/:id/redeliver", webhookHandler.Redeliver)
 	}
 
 	// Start server
-	fmt.Printf("\n✅ Server ready!\n")
-	fmt.Printf("📡 Listening on port %s\n", cfg.Port)
-	fmt.Printf("\n📚 API Endpoints:\n")
-	fmt.Printf("  POST   http://localhost:%s/api/v1/upload\n", cfg.Port)
-	fmt.Printf("  GET    http://localhost:%s/api/v1/tenants\n", cfg.Port)
-	fmt.Printf("  GET    http://localhost:%s/api/v1/tenants/deleted\n", cfg.Port)
-	fmt.Printf("  DELETE http://localhost:%s/api/v1/tenant/:name (soft delete)\n", cfg.Port)
-	fmt.Printf("  POST   http://localhost:%s/api/v1/tenant/:name/restore\n", cfg.Port)
-	fmt.Printf("  GET    http://localhost:%s/health\n\n", cfg.Port)
+	for _, route := range router.Routes() {
+		slog.Debug("route registered", "method", route.Method, "path", route.Path)
+	}
+	// Metrics carry tenant names, so they are served on their own listener
+	// that is kept off public networks rather than on the API port
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Handler())
+	go func() {
+		if err := http.ListenAndServe(cfg.MetricsAddr, metricsMux); err != nil {
+			fatal("failed to start metrics server", err)
+		}
+	}()
+
+	slog.Info("server ready", "port", cfg.Port, "metrics_addr", cfg.MetricsAddr)
 
 	if err := router.Run(":" + cfg.Port); err != nil {
-		log.Fatalf("❌ Failed to start server: %v", err)
+		fatal("failed to start server", err)
 	}
 }
 
+// fatal logs err and exits; deferred cleanup does not run
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
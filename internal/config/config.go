@@ -3,12 +3,17 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds all application configuration
 type Config struct {
 	// Server
 	Port string
+	// MetricsAddr is where /metrics is served, apart from the API port
+	MetricsAddr string
 
 	// PostgreSQL (Master DB)
 	PostgresHost     string
@@ -17,6 +22,15 @@ type Config struct {
 	PostgresUser     string
 	PostgresPassword string
 
+	// Authentication
+	AdminAPIKey string // Bootstrap admin API key, registered at startup if set
+
+	// Tenants
+	TenantStrictMode     bool          // Reject uploads to tenants not created via POST /api/v1/tenants
+	TenantPurgeRetention time.Duration // How long soft-deleted tenants are kept before the reaper purges them
+	TenantPurgeInterval  time.Duration // How often the reaper runs
+	TenantPurgeDryRun    bool          // Only log what the reaper would purge
+
 	// MongoDB (Tenant DBs)
 	MongoHost string
 	MongoPort string
@@ -30,31 +44,135 @@ type Config struct {
 	MinIOUseSSL    bool
 	MinIOBucket    string
 
+	// Presigned download URLs
+	PresignedURLExpiry    time.Duration // Default lifetime of a presigned URL
+	PresignedURLMaxExpiry time.Duration // Upper bound a client may request (S3 allows 7 days)
+
+	// Ingest pipeline
+	IngestWorkers     int    // Number of concurrent ingest workers
+	UploadSpoolDir    string // Local copies of streamed uploads until extraction; empty uses the system temp dir
+	PDFSecurityPolicy string // reject or quarantine PDFs with encryption, JavaScript, launch actions or embedded files
+
+	// Batch uploads
+	BatchMaxFiles    int   // PDFs per batch, counting archive entries
+	BatchMaxBytes    int64 // Total uncompressed size of a batch
+	BatchConcurrency int   // Files of a batch processed at once
+
+	// Webhooks
+	WebhookMaxAttempts  int           // Attempts before a delivery is dead-lettered
+	WebhookRetryBase    time.Duration // Delay before the first retry; doubled for every further retry
+	WebhookTimeout      time.Duration // Timeout of a single delivery attempt
+	WebhookWorkers      int           // Concurrent webhook deliveries
+	WebhookAllowPrivate bool          // Allow webhooks to loopback and private addresses (local development only)
+
+	// Event bus
+	EventPublisher      string        // none, file, nats or kafka; events are only recorded in the outbox when set
+	EventFilePath       string        // JSON Lines file for the file publisher
+	NATSURL             string        // NATS server for the nats publisher
+	NATSStream          string        // JetStream stream, created if missing
+	EventSubjectPrefix  string        // NATS subjects are <prefix>.<tenant>.<event type>
+	KafkaRESTURL        string        // Kafka REST Proxy for the kafka publisher
+	KafkaTopic          string        // Topic events are produced to, keyed by tenant
+	EventPublishTimeout time.Duration // Timeout of a single publish
+	OutboxPollInterval  time.Duration // How often the relay checks the outbox
+	OutboxBatchSize     int           // Events relayed per transaction
+	OutboxRetention     time.Duration // How long published events stay in the outbox
+
+	// Tracing
+	TraceExporter    string  // none, stdout or otlp
+	OTLPEndpoint     string  // OTLP/HTTP collector the otlp exporter sends to
+	TraceServiceName string  // service.name of exported spans
+	TraceSampleRatio float64 // Fraction of new traces recorded
+
+	// Logging
+	LogLevel  string // debug, info, warn or error
+	LogFormat string // json or text
+
+	// Consistency
+	ReconcileInterval time.Duration // How often stores are reconciled
+	ReconcileGrace    time.Duration // Minimum age before a stored file may be treated as orphaned
+	ReconcileDryRun   bool          // Only log inconsistencies instead of repairing them
+
 	// AI Services
-	GeminiAPIKey string // Google Gemini API Key (Free Tier)
-	OpenAIAPIKey string // OpenAI API Key (Deprecated)
+	SummarizerProvider        string            // gemini, openai, mock or fallback; empty picks gemini when a key is set
+	SummarizerTenantProviders map[string]string // per-tenant overrides, e.g. "acme:openai,ci_tenant:mock"
+	GeminiAPIKey              string            // Google Gemini API Key (Free Tier)
+	GeminiModel               string
+	OpenAIAPIKey              string // OpenAI API Key (optional for local OpenAI-compatible servers)
+	OpenAIBaseURL             string // OpenAI-compatible endpoint, e.g. http://localhost:11434/v1 for Ollama
+	OpenAIModel               string
+	SummaryChunkChars         int  // Maximum characters per summarizer call; longer documents are map-reduced
+	SummaryConcurrency        int  // Concurrent chunk summaries per document
+	StoreChunkSummaries       bool // Keep per-chunk summaries on the document
 }
 
 // Load loads configuration from environment variables
 func Load() *Config {
 	return &Config{
-		Port:             getEnv("PORT", "8080"),
-		PostgresHost:     getEnv("POSTGRES_HOST", "localhost"),
-		PostgresPort:     getEnv("POSTGRES_PORT", "5432"),
-		PostgresDB:       getEnv("POSTGRES_DB", "master_db"),
-		PostgresUser:     getEnv("POSTGRES_USER", "postgres"),
-		PostgresPassword: getEnv("POSTGRES_PASSWORD", "postgres123"),
-		MongoHost:        getEnv("MONGO_HOST", "localhost"),
-		MongoPort:        getEnv("MONGO_PORT", "27017"),
-		MongoUser:        getEnv("MONGO_USER", ""),
-		MongoPass:        getEnv("MONGO_PASS", ""),
-		MinIOEndpoint:    getEnv("MINIO_ENDPOINT", "localhost:9000"),
-		MinIOAccessKey:   getEnv("MINIO_ACCESS_KEY", "minioadmin"),
-		MinIOSecretKey:   getEnv("MINIO_SECRET_KEY", "minioadmin123"),
-		MinIOUseSSL:      getEnv("MINIO_USE_SSL", "false") == "true",
-		MinIOBucket:      getEnv("MINIO_BUCKET", "pdf-uploads"),
-		GeminiAPIKey:     getEnv("GEMINI_API_KEY", ""),
-		OpenAIAPIKey:     getEnv("OPENAI_API_KEY", ""),
+		Port:                      getEnv("PORT", "8080"),
+		MetricsAddr:               getEnv("METRICS_ADDR", ":9090"),
+		PostgresHost:              getEnv("POSTGRES_HOST", "localhost"),
+		PostgresPort:              getEnv("POSTGRES_PORT", "5432"),
+		PostgresDB:                getEnv("POSTGRES_DB", "master_db"),
+		PostgresUser:              getEnv("POSTGRES_USER", "postgres"),
+		PostgresPassword:          getEnv("POSTGRES_PASSWORD", "postgres123"),
+		AdminAPIKey:               getEnv("ADMIN_API_KEY", ""),
+		TenantStrictMode:          getEnv("TENANT_STRICT_MODE", "false") == "true",
+		TenantPurgeRetention:      getDurationEnv("TENANT_PURGE_RETENTION", 30*24*time.Hour),
+		TenantPurgeInterval:       getDurationEnv("TENANT_PURGE_INTERVAL", time.Hour),
+		TenantPurgeDryRun:         getEnv("TENANT_PURGE_DRY_RUN", "false") == "true",
+		MongoHost:                 getEnv("MONGO_HOST", "localhost"),
+		MongoPort:                 getEnv("MONGO_PORT", "27017"),
+		MongoUser:                 getEnv("MONGO_USER", ""),
+		MongoPass:                 getEnv("MONGO_PASS", ""),
+		MinIOEndpoint:             getEnv("MINIO_ENDPOINT", "localhost:9000"),
+		MinIOAccessKey:            getEnv("MINIO_ACCESS_KEY", "minioadmin"),
+		MinIOSecretKey:            getEnv("MINIO_SECRET_KEY", "minioadmin123"),
+		MinIOUseSSL:               getEnv("MINIO_USE_SSL", "false") == "true",
+		MinIOBucket:               getEnv("MINIO_BUCKET", "pdf-uploads"),
+		PresignedURLExpiry:        getDurationEnv("PRESIGNED_URL_EXPIRY", 15*time.Minute),
+		PresignedURLMaxExpiry:     getDurationEnv("PRESIGNED_URL_MAX_EXPIRY", 7*24*time.Hour),
+		IngestWorkers:             getIntEnv("INGEST_WORKERS", 4),
+		UploadSpoolDir:            getEnv("UPLOAD_SPOOL_DIR", ""),
+		PDFSecurityPolicy:         getEnv("PDF_SECURITY_POLICY", "reject"),
+		BatchMaxFiles:             getIntEnv("BATCH_MAX_FILES", 100),
+		BatchMaxBytes:             int64(getIntEnv("BATCH_MAX_BYTES", 500*1024*1024)),
+		BatchConcurrency:          getIntEnv("BATCH_CONCURRENCY", 4),
+		WebhookMaxAttempts:        getIntEnv("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookRetryBase:          getDurationEnv("WEBHOOK_RETRY_BASE", 30*time.Second),
+		WebhookTimeout:            getDurationEnv("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookWorkers:            getIntEnv("WEBHOOK_WORKERS", 2),
+		WebhookAllowPrivate:       getEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true",
+		EventPublisher:            getEnv("EVENT_PUBLISHER", "none"),
+		EventFilePath:             getEnv("EVENT_FILE_PATH", "events.jsonl"),
+		NATSURL:                   getEnv("NATS_URL", "nats://localhost:4222"),
+		NATSStream:                getEnv("NATS_STREAM", "PDF_EVENTS"),
+		EventSubjectPrefix:        getEnv("EVENT_SUBJECT_PREFIX", "pdf.events"),
+		KafkaRESTURL:              getEnv("KAFKA_REST_URL", "http://localhost:8082"),
+		KafkaTopic:                getEnv("KAFKA_TOPIC", "pdf-events"),
+		EventPublishTimeout:       getDurationEnv("EVENT_PUBLISH_TIMEOUT", 10*time.Second),
+		OutboxPollInterval:        getDurationEnv("OUTBOX_POLL_INTERVAL", time.Second),
+		OutboxBatchSize:           getIntEnv("OUTBOX_BATCH_SIZE", 100),
+		OutboxRetention:           getDurationEnv("OUTBOX_RETENTION", 7*24*time.Hour),
+		TraceExporter:             getEnv("TRACE_EXPORTER", "none"),
+		OTLPEndpoint:              getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+		TraceServiceName:          getEnv("OTEL_SERVICE_NAME", "pdf-ingestion-api"),
+		TraceSampleRatio:          getFloatEnv("TRACE_SAMPLE_RATIO", 1),
+		LogLevel:                  getEnv("LOG_LEVEL", "info"),
+		LogFormat:                 getEnv("LOG_FORMAT", "json"),
+		ReconcileInterval:         getDurationEnv("RECONCILE_INTERVAL", time.Hour),
+		ReconcileGrace:            getDurationEnv("RECONCILE_GRACE", time.Hour),
+		ReconcileDryRun:           getEnv("RECONCILE_DRY_RUN", "false") == "true",
+		SummarizerProvider:        getEnv("SUMMARIZER_PROVIDER", ""),
+		SummarizerTenantProviders: getMapEnv("SUMMARIZER_TENANT_PROVIDERS"),
+		GeminiAPIKey:              getEnv("GEMINI_API_KEY", ""),
+		GeminiModel:               getEnv("GEMINI_MODEL", "gemini-2.5-flash"),
+		OpenAIAPIKey:              getEnv("OPENAI_API_KEY", ""),
+		OpenAIBaseURL:             getEnv("OPENAI_BASE_URL", ""),
+		OpenAIModel:               getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+		SummaryChunkChars:         getIntEnv("SUMMARY_CHUNK_CHARS", 12000),
+		SummaryConcurrency:        getIntEnv("SUMMARY_CONCURRENCY", 3),
+		StoreChunkSummaries:       getEnv("STORE_CHUNK_SUMMARIES", "false") == "true",
 	}
 }
 
@@ -78,3 +196,43 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getIntEnv(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+// getFloatEnv parses a fraction between 0 and 1
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil && f >= 0 && f <= 1 {
+			return f
+		}
+	}
+	return defaultValue
+}
+
+// getMapEnv parses a comma-separated list of key:value pairs
+func getMapEnv(key string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && k != "" && v != "" {
+			result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return result
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultValue
+}
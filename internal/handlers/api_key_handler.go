@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler handles API key management requests. Tenant admins manage
+// the keys of their own tenant; platform admins manage all keys.
+type APIKeyHandler struct {
+	authService  *services.AuthService
+	userService  *services.UserService
+	auditService *services.AuditService
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(authService *services.AuthService, userService *services.UserService, auditService *services.AuditService) *APIKeyHandler {
+	return &APIKeyHandler{
+		authService:  authService,
+		userService:  userService,
+		auditService: auditService,
+	}
+}
+
+// IssueKey creates a new API key. The plaintext key is only returned here.
+func (h *APIKeyHandler) IssueKey(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid request body: %s", err.Error()),
+		})
+		return
+	}
+
+	// The key's tenant is the user's when issued for a user
+	tenantName := req.TenantName
+	if req.UserID != 0 {
+		user, err := h.userService.GetUser(ctx, strconv.Itoa(req.UserID))
+		if err != nil {
+			c.JSON(userErrorStatus(err), models.UploadResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to issue API key: %s", err.Error()),
+			})
+			return
+		}
+		tenantName = user.TenantName
+	}
+	if (req.UserID == 0 && req.Scope == models.ScopeAdmin) || !middleware.CanAccessTenant(c, tenantName) {
+		c.JSON(http.StatusForbidden, models.UploadResponse{
+			Success: false,
+			Error:   "Failed to issue API key: not allowed to issue keys outside your tenant",
+		})
+		return
+	}
+
+	issued, err := h.authService.IssueKey(ctx, req)
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to issue API key: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "key issued", "key_id", issued.ID, "key_prefix", issued.Prefix, "scope", issued.Scope)
+
+	// Never record the secret itself
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   issued.TenantName,
+		Action:       models.AuditAPIKeyIssue,
+		ResourceType: "api_key",
+		ResourceID:   issued.ID,
+		Diff: map[string]models.AuditChange{
+			"name":    {New: issued.Name},
+			"scope":   {New: issued.Scope},
+			"role":    {New: issued.Role},
+			"prefix":  {New: issued.Prefix},
+			"user_id": {New: issued.UserID},
+		},
+	})
+
+	c.JSON(http.StatusCreated, models.UploadResponse{
+		Success: true,
+		Data:    issued,
+	})
+}
+
+// ListKeys lists API keys, optionally filtered by tenant_name. Revoked keys
+// are included with include_revoked=true.
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	tenantName := c.Query("tenant_name")
+	if !middleware.HasRole(c, models.RolePlatformAdmin) {
+		tenantName = middleware.APIKey(c).TenantName
+	}
+
+	keys, err := h.authService.ListKeys(ctx, tenantName, c.Query("include_revoked") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list API keys: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"keys":  keys,
+			"count": len(keys),
+		},
+	})
+}
+
+// RotateKey replaces a key with a new secret and revokes the old one
+func (h *APIKeyHandler) RotateKey(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	if !h.keyAccessible(c, "Failed to rotate API key") {
+		return
+	}
+
+	issued, err := h.authService.RotateKey(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to rotate API key: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "key rotated", "previous_key_id", c.Param("id"), "key_id", issued.ID, "key_prefix", issued.Prefix)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   issued.TenantName,
+		Action:       models.AuditAPIKeyRotate,
+		ResourceType: "api_key",
+		ResourceID:   c.Param("id"),
+		Diff:         map[string]models.AuditChange{"key_id": {Old: c.Param("id"), New: issued.ID}},
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    issued,
+	})
+}
+
+// RevokeKey revokes a key immediately
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	if !h.keyAccessible(c, "Failed to revoke API key") {
+		return
+	}
+
+	key, err := h.authService.RevokeKey(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to revoke API key: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "key revoked", "key_id", key.ID, "key_prefix", key.Prefix)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   key.TenantName,
+		Action:       models.AuditAPIKeyRevoke,
+		ResourceType: "api_key",
+		ResourceID:   key.ID,
+		Diff:         map[string]models.AuditChange{"revoked_at": {New: key.RevokedAt}},
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    key,
+	})
+}
+
+// keyAccessible checks that the :id key belongs to a tenant the caller
+// manages, writing a 404 response otherwise so other tenants' keys stay hidden
+func (h *APIKeyHandler) keyAccessible(c *gin.Context, action string) bool {
+	key, err := h.authService.GetKey(middleware.RequestContext(c), c.Param("id"))
+	if err == nil && (!middleware.CanAccessTenant(c, key.TenantName) ||
+		(key.Scope == models.ScopeAdmin && !middleware.HasRole(c, models.RolePlatformAdmin))) {
+		err = fmt.Errorf("%w: '%s'", services.ErrAPIKeyNotFound, c.Param("id"))
+	}
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("%s: %s", action, err.Error()),
+		})
+		return false
+	}
+	return true
+}
+
+// apiKeyErrorStatus maps auth service errors to HTTP status codes
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAPIKeyNotFound), errors.Is(err, services.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidAPIKeyRequest):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditHandler handles audit log queries. Tenant admins only see their own
+// tenant's entries; platform admins see everything.
+type AuditHandler struct {
+	auditService *services.AuditService
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(auditService *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+	}
+}
+
+// ListAuditLogs returns a page of audit entries, newest first. Filters:
+// tenant_name, action, actor, from and to (RFC 3339), before_id and limit.
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid query: %s", err.Error()),
+		})
+		return
+	}
+
+	page, err := h.auditService.ListAuditLogs(ctx, filter)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidAuditQuery) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list audit logs: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// ExportAuditLogs streams every matching entry as JSON Lines for compliance
+// reviews. It takes the same filters as ListAuditLogs, without paging.
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	// Cancelled when the client goes away, so an abandoned export stops
+	// scanning instead of running to the end
+	ctx := c.Request.Context()
+
+	filter, err := parseAuditFilter(c)
+	if err == nil {
+		err = services.ValidateAuditFilter(&filter)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid query: %s", err.Error()),
+		})
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.jsonl"`, time.Now().UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only end the stream early
+	if err := h.auditService.ExportAuditLogs(ctx, filter, c.Writer); err != nil {
+		slog.ErrorContext(ctx, "audit export failed", "error", err)
+	}
+}
+
+// parseAuditFilter reads audit filters from the query string. Callers below
+// platform admin are limited to their own tenant.
+func parseAuditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		TenantName: c.Query("tenant_name"),
+		Action:     c.Query("action"),
+		Actor:      c.Query("actor"),
+	}
+	if !middleware.HasRole(c, models.RolePlatformAdmin) {
+		filter.TenantName = middleware.APIKey(c).TenantName
+	}
+
+	for param, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", param)
+			}
+			t = t.UTC()
+			*dest = &t
+		}
+	}
+
+	if v := c.Query("before_id"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("before_id must be a number")
+		}
+		filter.BeforeID = n
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("limit must be a number")
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+// recordAudit fills in the actor and request ID from the request and appends
+// entry to the audit log
+func recordAudit(c *gin.Context, auditService *services.AuditService, entry models.AuditLog) {
+	if key := middleware.APIKey(c); key != nil {
+		entry.Actor = fmt.Sprintf("key:%s", key.ID)
+		if key.UserID != nil {
+			entry.Actor = fmt.Sprintf("user:%d", *key.UserID)
+		}
+		entry.ActorRole = key.Role
+		entry.APIKeyID = key.ID
+	}
+	entry.RequestID = middleware.GetRequestID(c)
+
+	auditService.Record(middleware.RequestContext(c), &entry)
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// batchFormOverhead allows for multipart headers and boundaries on top of
+// the batch size limit
+const batchFormOverhead = 1 << 20
+
+// batchItem is one file of a batch upload and, once known, its outcome
+type batchItem struct {
+	file       *services.FileUpload
+	name       string
+	archive    string
+	quarantine *models.Quarantine
+	outcome    *uploadOutcome
+}
+
+// HandleBatchUpload accepts many PDFs, or ZIP archives of PDFs, in the files
+// form field. Every file goes through the same pipeline as HandleUpload, a
+// few at a time, and the response reports the outcome of each.
+func (h *UploadHandler) HandleBatchUpload(c *gin.Context) {
+	startTime := time.Now()
+	ctx := middleware.RequestContext(c)
+	limits := h.batchLimits
+
+	// Archives are smaller than their contents, so the uncompressed limit
+	// bounds the request as well
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxBytes+batchFormOverhead)
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, models.UploadResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Batch rejected: request exceeds %d bytes", limits.MaxBytes),
+				Code:    "BATCH_TOO_LARGE",
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid multipart form: %s", err.Error()),
+		})
+		return
+	}
+
+	formFiles := form.File["files"]
+	if len(formFiles) == 0 {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   "At least one PDF or ZIP file is required in the files field",
+		})
+		return
+	}
+
+	tenantName := uploadTenantName(c)
+	if !h.checkUploadTenant(c, tenantName) {
+		return
+	}
+	// The request context now carries the tenant for the logs
+	ctx = middleware.RequestContext(c)
+
+	onDuplicate := c.DefaultPostForm("onDuplicate", models.DuplicateExisting)
+	if err := services.ValidateDuplicateMode(onDuplicate); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid onDuplicate: %s", err.Error()),
+		})
+		return
+	}
+
+	// Expand archives into their entries
+	var items []batchItem
+	for _, formFile := range formFiles {
+		if !strings.HasSuffix(strings.ToLower(formFile.Filename), ".zip") {
+			items = append(items, batchItem{file: services.NewFileUpload(formFile), name: formFile.Filename})
+			continue
+		}
+
+		entries, closer, err := services.ReadZipArchive(formFile, limits.MaxFiles)
+		if errors.Is(err, services.ErrBatchTooLarge) {
+			respondBatchTooLarge(c, err)
+			return
+		}
+		if err != nil {
+			items = append(items, batchItem{name: formFile.Filename, outcome: &uploadOutcome{
+				http.StatusBadRequest, models.UploadResponse{Success: false, Error: err.Error()},
+			}})
+			continue
+		}
+		defer closer.Close()
+
+		for _, entry := range entries {
+			item := batchItem{file: entry.File, name: entry.Name, archive: formFile.Filename}
+			if entry.Err != nil {
+				item.outcome = &uploadOutcome{http.StatusBadRequest, models.UploadResponse{
+					Success: false,
+					Error:   entry.Err.Error(),
+					Code:    "ARCHIVE_ENTRY_REJECTED",
+				}}
+			}
+			items = append(items, item)
+		}
+	}
+
+	var totalBytes int64
+	for _, item := range items {
+		if item.file != nil {
+			totalBytes += item.file.Size
+		}
+	}
+	if len(items) > limits.MaxFiles {
+		respondBatchTooLarge(c, fmt.Errorf("%w: %d files, the limit is %d", services.ErrBatchTooLarge, len(items), limits.MaxFiles))
+		return
+	}
+	if totalBytes > limits.MaxBytes {
+		respondBatchTooLarge(c, fmt.Errorf("%w: %d bytes uncompressed, the limit is %d", services.ErrBatchTooLarge, totalBytes, limits.MaxBytes))
+		return
+	}
+
+	slog.DebugContext(ctx, "accepting batch upload", "files", len(items), "size", totalBytes)
+
+	// Validate and inspect every file before touching the tenant, so a batch
+	// of invalid files creates nothing
+	forEachConcurrently(len(items), limits.Concurrency, func(i int) {
+		item := &items[i]
+		if item.outcome == nil {
+			item.quarantine, item.outcome = h.inspectUpload(item.file)
+		}
+	})
+
+	accepted := 0
+	for _, item := range items {
+		if item.outcome == nil {
+			accepted++
+		}
+	}
+	if accepted > 0 {
+		tenant, ok := h.uploadTenant(c, ctx, tenantName)
+		if !ok {
+			return
+		}
+
+		forEachConcurrently(len(items), limits.Concurrency, func(i int) {
+			item := &items[i]
+			if item.outcome == nil {
+				outcome := h.enqueueUpload(c, ctx, tenant, item.file, item.quarantine, onDuplicate, startTime)
+				item.outcome = &outcome
+			}
+		})
+	}
+
+	report := models.BatchUploadReport{
+		TenantName: tenantName,
+		Files:      len(items),
+		Results:    make([]models.BatchFileResult, 0, len(items)),
+	}
+	for _, item := range items {
+		result := models.BatchFileResult{
+			FileName: item.name,
+			Archive:  item.archive,
+			Status:   item.outcome.status,
+			Success:  item.outcome.response.Success,
+			Data:     item.outcome.response.Data,
+			Error:    item.outcome.response.Error,
+			Code:     item.outcome.response.Code,
+		}
+		switch {
+		case !result.Success:
+			report.Failed++
+		case isDuplicate(result.Data):
+			report.Duplicates++
+		default:
+			report.Queued++
+		}
+		report.Results = append(report.Results, result)
+	}
+	report.ElapsedMS = time.Since(startTime).Milliseconds()
+
+	slog.InfoContext(ctx, "batch upload accepted", "files", report.Files, "queued", report.Queued,
+		"duplicates", report.Duplicates, "failed", report.Failed, "duration_ms", report.ElapsedMS)
+
+	if report.Failed == report.Files {
+		c.JSON(http.StatusUnprocessableEntity, models.UploadResponse{
+			Success: false,
+			Data:    report,
+			Error:   "No file in the batch was accepted",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// respondBatchTooLarge writes the response for a batch over its limits
+func respondBatchTooLarge(c *gin.Context, err error) {
+	c.JSON(http.StatusRequestEntityTooLarge, models.UploadResponse{
+		Success: false,
+		Error:   fmt.Sprintf("Batch rejected: %s", err.Error()),
+		Code:    "BATCH_TOO_LARGE",
+	})
+}
+
+// isDuplicate reports whether upload response data describes a duplicate
+func isDuplicate(data interface{}) bool {
+	fields, ok := data.(map[string]interface{})
+	return ok && fields["duplicate"] == true
+}
+
+// forEachConcurrently calls fn for every index below n, running at most
+// limit calls at once
+func forEachConcurrently(n, limit int, fn func(i int)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
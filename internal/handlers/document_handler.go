@@ -0,0 +1,566 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// DocumentHandler handles document read and management requests
+type DocumentHandler struct {
+	documentService *services.DocumentService
+	tenantService   *services.TenantService
+	auditService    *services.AuditService
+}
+
+// NewDocumentHandler creates a new document handler
+func NewDocumentHandler(documentService *services.DocumentService, tenantService *services.TenantService, auditService *services.AuditService) *DocumentHandler {
+	return &DocumentHandler{
+		documentService: documentService,
+		tenantService:   tenantService,
+		auditService:    auditService,
+	}
+}
+
+// ListDocuments handles paginated document listing for a tenant
+func (h *DocumentHandler) ListDocuments(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	filter, err := parseDocumentFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid query: %s", err.Error()),
+		})
+		return
+	}
+
+	page, err := h.documentService.ListDocuments(ctx, tenantName, filter)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list documents: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    page,
+	})
+}
+
+// SearchDocuments handles full-text search across a tenant's documents
+func (h *DocumentHandler) SearchDocuments(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	var limit, offset int64
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.UploadResponse{
+				Success: false,
+				Error:   "Invalid query: limit must be a number",
+			})
+			return
+		}
+		limit = n
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.UploadResponse{
+				Success: false,
+				Error:   "Invalid query: offset must be a number",
+			})
+			return
+		}
+		offset = n
+	}
+
+	result, err := h.documentService.SearchDocuments(ctx, tenantName, c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to search documents: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    result,
+	})
+}
+
+// GetDocument handles fetching a single document. Page text is only
+// returned when include_text=true.
+func (h *DocumentHandler) GetDocument(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	includeText := c.Query("include_text") == "true"
+	doc, err := h.documentService.GetDocument(ctx, tenantName, c.Param("id"), includeText)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to get document: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    doc,
+	})
+}
+
+// UpdateDocument handles metadata updates on a single document
+func (h *DocumentHandler) UpdateDocument(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	var update models.DocumentUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid request body: %s", err.Error()),
+		})
+		return
+	}
+
+	doc, previous, err := h.documentService.UpdateDocument(ctx, tenantName, c.Param("id"), update)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to update document: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "document updated", logging.KeyDocumentID, doc.ID.Hex())
+
+	diff := map[string]models.AuditChange{}
+	if previous.FileName != doc.FileName {
+		diff["file_name"] = models.AuditChange{Old: previous.FileName, New: doc.FileName}
+	}
+	if previous.Summary != doc.Summary {
+		diff["summary"] = models.AuditChange{Old: previous.Summary, New: doc.Summary}
+	}
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditDocumentUpdate,
+		ResourceType: "document",
+		ResourceID:   doc.ID.Hex(),
+		Diff:         diff,
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    doc,
+	})
+}
+
+// DeleteDocument handles soft deletion of a single document
+func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+	documentID := c.Param("id")
+
+	if err := h.documentService.DeleteDocument(ctx, tenantName, documentID); err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to delete document: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "document soft deleted", logging.KeyDocumentID, documentID)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditDocumentDelete,
+		ResourceType: "document",
+		ResourceID:   documentID,
+		Diff:         map[string]models.AuditChange{"is_deleted": {Old: false, New: true}},
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"document_id":     documentID,
+			"tenant_name":     tenantName,
+			"soft_deleted":    true,
+			"restore_command": fmt.Sprintf("POST /api/v1/tenant/%s/documents/%s/restore", tenantName, documentID),
+		},
+	})
+}
+
+// RestoreDocument handles restoration of a single soft-deleted document
+func (h *DocumentHandler) RestoreDocument(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+	documentID := c.Param("id")
+
+	if err := h.documentService.RestoreDocument(ctx, tenantName, documentID); err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to restore document: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "document restored", logging.KeyDocumentID, documentID)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditDocumentRestore,
+		ResourceType: "document",
+		ResourceID:   documentID,
+		Diff:         map[string]models.AuditChange{"is_deleted": {Old: true, New: false}},
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"document_id": documentID,
+			"tenant_name": tenantName,
+			"restored":    true,
+		},
+	})
+}
+
+// ListDocumentVersions handles listing every version of a document
+func (h *DocumentHandler) ListDocumentVersions(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	list, err := h.documentService.ListDocumentVersions(ctx, tenantName, c.Param("id"))
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list document versions: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+// GetDocumentVersion handles fetching one version of a document. Page text
+// is only returned when include_text=true.
+func (h *DocumentHandler) GetDocumentVersion(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+	number, ok := versionParam(c)
+	if !ok {
+		return
+	}
+
+	includeText := c.Query("include_text") == "true"
+	version, err := h.documentService.GetDocumentVersion(ctx, tenantName, c.Param("id"), number, includeText)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to get document version: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    version,
+	})
+}
+
+// RollbackDocument handles making an earlier version of a document current
+func (h *DocumentHandler) RollbackDocument(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+	number, ok := versionParam(c)
+	if !ok {
+		return
+	}
+	documentID := c.Param("id")
+
+	version, previous, err := h.documentService.RollbackDocument(ctx, tenantName, documentID, number)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to roll back document: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "document rolled back", logging.KeyDocumentID, documentID, "version", number)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditDocumentRollback,
+		ResourceType: "document",
+		ResourceID:   documentID,
+		Diff:         map[string]models.AuditChange{"current_version": {Old: previous, New: version.Version}},
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    version,
+	})
+}
+
+// DownloadDocumentVersion streams the original PDF of one version of a document
+func (h *DocumentHandler) DownloadDocumentVersion(c *gin.Context) {
+	// Streams stop with the client, so they keep the cancellable context
+	ctx := c.Request.Context()
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+	number, ok := versionParam(c)
+	if !ok {
+		return
+	}
+
+	version, reader, size, err := h.documentService.OpenDocumentVersionFile(ctx, tenantName, c.Param("id"), number)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to download document version: %s", err.Error()),
+		})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, size, "application/pdf", reader, map[string]string{
+		"Content-Disposition": services.ContentDisposition(version.FileName),
+	})
+}
+
+// DownloadDocument streams the original PDF of a document from storage
+func (h *DocumentHandler) DownloadDocument(c *gin.Context) {
+	// Streams stop with the client, so they keep the cancellable context
+	ctx := c.Request.Context()
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	doc, reader, size, err := h.documentService.OpenDocumentFile(ctx, tenantName, c.Param("id"))
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to download document: %s", err.Error()),
+		})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, size, "application/pdf", reader, map[string]string{
+		"Content-Disposition": services.ContentDisposition(doc.FileName),
+	})
+}
+
+// GetDocumentURL returns a time-limited presigned download URL.
+// The lifetime can be set with expires_in (seconds), up to the configured maximum.
+func (h *DocumentHandler) GetDocumentURL(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	var expiry time.Duration
+	if v := c.Query("expires_in"); v != "" {
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.UploadResponse{
+				Success: false,
+				Error:   "Invalid query: expires_in must be a number of seconds",
+			})
+			return
+		}
+		expiry = time.Duration(seconds) * time.Second
+	}
+
+	url, expiresAt, err := h.documentService.PresignDocumentURL(ctx, tenantName, c.Param("id"), expiry)
+	if err != nil {
+		c.JSON(documentErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to generate download URL: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"document_id": c.Param("id"),
+			"url":         url,
+			"expires_at":  expiresAt,
+		},
+	})
+}
+
+// tenantParam validates the :name path parameter, writing a 400 response if invalid
+func tenantParam(c *gin.Context, tenantService *services.TenantService) (string, bool) {
+	tenantName := c.Param("name")
+	if err := tenantService.ValidateTenantName(tenantName); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid tenant name: %s", err.Error()),
+		})
+		return "", false
+	}
+	return tenantName, true
+}
+
+// versionParam parses the :version path parameter, writing a 400 response if invalid
+func versionParam(c *gin.Context) (int, bool) {
+	number, err := strconv.Atoi(c.Param("version"))
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   "Invalid version: must be a positive number",
+		})
+		return 0, false
+	}
+	return number, true
+}
+
+// parseDocumentFilter reads listing options from the query string
+func parseDocumentFilter(c *gin.Context) (models.DocumentFilter, error) {
+	filter := models.DocumentFilter{
+		FileName:  c.Query("file_name"),
+		Title:     c.Query("title"),
+		Author:    c.Query("author"),
+		SortBy:    c.Query("sort"),
+		SortOrder: c.Query("order"),
+		Cursor:    c.Query("cursor"),
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("limit must be a number")
+		}
+		filter.Limit = limit
+	}
+
+	if v := c.Query("min_pages"); v != "" {
+		pages, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("min_pages must be a number")
+		}
+		filter.MinPages = &pages
+	}
+
+	if v := c.Query("max_pages"); v != "" {
+		pages, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("max_pages must be a number")
+		}
+		filter.MaxPages = &pages
+	}
+
+	if v := c.Query("min_size"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("min_size must be a number of bytes")
+		}
+		filter.MinSize = &size
+	}
+
+	if v := c.Query("max_size"); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("max_size must be a number of bytes")
+		}
+		filter.MaxSize = &size
+	}
+
+	if v := c.Query("uploaded_from"); v != "" {
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("uploaded_from must be an RFC3339 timestamp")
+		}
+		filter.UploadedFrom = &from
+	}
+
+	if v := c.Query("uploaded_to"); v != "" {
+		to, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("uploaded_to must be an RFC3339 timestamp")
+		}
+		filter.UploadedTo = &to
+	}
+
+	// Active documents by default; "all" lists both active and deleted
+	switch v := c.DefaultQuery("is_deleted", "false"); v {
+	case "all":
+	case "true", "false":
+		deleted := v == "true"
+		filter.IsDeleted = &deleted
+	default:
+		return filter, fmt.Errorf("is_deleted must be true, false or all")
+	}
+
+	return filter, nil
+}
+
+// documentErrorStatus maps document service errors to HTTP status codes
+func documentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTenantNotFound), errors.Is(err, services.ErrDocumentNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidDocumentQuery),
+		errors.Is(err, services.ErrInvalidDocumentID),
+		errors.Is(err, services.ErrInvalidDocumentUpdate),
+		errors.Is(err, services.ErrInvalidDuplicateMode):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrDocumentConflict), errors.Is(err, services.ErrDuplicateDocument):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
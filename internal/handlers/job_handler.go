@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// JobHandler handles ingest job status requests
+type JobHandler struct {
+	ingestService *services.IngestService
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(ingestService *services.IngestService) *JobHandler {
+	return &JobHandler{
+		ingestService: ingestService,
+	}
+}
+
+// GetJob reports the status, per-step timings and errors of an ingest job
+func (h *JobHandler) GetJob(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	job, err := h.ingestService.GetJob(ctx, c.Param("id"))
+	if err == nil && !middleware.CanAccessTenant(c, job.TenantName) {
+		// Don't reveal that another tenant's job exists
+		err = fmt.Errorf("%w: '%s'", services.ErrJobNotFound, c.Param("id"))
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrJobNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to get job: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    job,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ReconcileHandler runs consistency checks across Postgres, MongoDB and MinIO
+type ReconcileHandler struct {
+	reconcileService *services.ReconcileService
+	auditService     *services.AuditService
+}
+
+// NewReconcileHandler creates a new reconcile handler
+func NewReconcileHandler(reconcileService *services.ReconcileService, auditService *services.AuditService) *ReconcileHandler {
+	return &ReconcileHandler{
+		reconcileService: reconcileService,
+		auditService:     auditService,
+	}
+}
+
+// CheckConsistency reports inconsistencies without repairing them
+func (h *ReconcileHandler) CheckConsistency(c *gin.Context) {
+	report, err := h.reconcileService.Run(middleware.RequestContext(c), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to check consistency: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// Reconcile repairs inconsistencies now instead of waiting for the
+// background job. With ?dry_run=true it behaves like CheckConsistency.
+func (h *ReconcileHandler) Reconcile(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true"
+
+	ctx := middleware.RequestContext(c)
+	report, err := h.reconcileService.Run(ctx, dryRun)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to reconcile: %s", err.Error()),
+		})
+		return
+	}
+
+	repaired := 0
+	for _, issue := range report.Issues {
+		if issue.Repaired {
+			repaired++
+		}
+	}
+	slog.InfoContext(ctx, "reconciliation run", "dry_run", dryRun, "issues", len(report.Issues), "repaired", repaired)
+
+	if !dryRun {
+		recordAudit(c, h.auditService, models.AuditLog{
+			Action:       models.AuditReconcile,
+			ResourceType: "system",
+			Details: map[string]interface{}{
+				"issues":   len(report.Issues),
+				"repaired": repaired,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    report,
+	})
+}
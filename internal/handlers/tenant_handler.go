@@ -1,10 +1,12 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 
+	"github.com/bacancy/droadmap/internal/middleware"
 	"github.com/bacancy/droadmap/internal/models"
 	"github.com/bacancy/droadmap/internal/services"
 	"github.com/gin-gonic/gin"
@@ -13,22 +15,127 @@ import (
 // TenantHandler handles tenant-related requests
 type TenantHandler struct {
 	tenantService *services.TenantService
+	purgeService  *services.PurgeService
+	auditService  *services.AuditService
 }
 
 // NewTenantHandler creates a new tenant handler
-func NewTenantHandler(tenantService *services.TenantService) *TenantHandler {
+func NewTenantHandler(tenantService *services.TenantService, purgeService *services.PurgeService, auditService *services.AuditService) *TenantHandler {
 	return &TenantHandler{
 		tenantService: tenantService,
+		purgeService:  purgeService,
+		auditService:  auditService,
 	}
 }
 
+// CreateTenant provisions a tenant with its display name, settings and quotas
+func (h *TenantHandler) CreateTenant(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	var req models.TenantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid request body: %s", err.Error()),
+		})
+		return
+	}
+
+	tenant, err := h.tenantService.CreateTenant(ctx, req)
+	if tenant != nil {
+		// The tenant is registered even if its database could not be created
+		recordAudit(c, h.auditService, models.AuditLog{
+			TenantName:   tenant.TenantName,
+			Action:       models.AuditTenantCreate,
+			ResourceType: "tenant",
+			ResourceID:   tenant.TenantName,
+			Diff: map[string]models.AuditChange{
+				"status":       {New: tenant.Status},
+				"db_name":      {New: tenant.DBName},
+				"display_name": {New: tenant.DisplayName},
+				"settings":     {New: tenant.Settings},
+				"quotas":       {New: tenant.Quotas},
+			},
+		})
+	}
+	if err != nil {
+		respondTenantError(c, "Failed to create tenant", tenant, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.UploadResponse{
+		Success: true,
+		Data:    tenant,
+	})
+}
+
+// GetTenant returns a tenant with its current usage
+func (h *TenantHandler) GetTenant(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName := c.Param("name")
+
+	if !middleware.CanAccessTenant(c, tenantName) {
+		c.JSON(http.StatusForbidden, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("API key is not authorized for tenant '%s'", tenantName),
+		})
+		return
+	}
+
+	tenant, err := h.tenantService.GetTenant(ctx, tenantName)
+	if err != nil {
+		respondTenantError(c, "Failed to get tenant", nil, err)
+		return
+	}
+
+	usage, err := h.tenantService.GetUsage(ctx, tenantName)
+	if err != nil {
+		respondTenantError(c, "Failed to get tenant usage", nil, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"tenant": tenant,
+			"usage":  usage,
+		},
+	})
+}
+
+// RetryProvisioning provisions a failed tenant again without waiting for the
+// background retry
+func (h *TenantHandler) RetryProvisioning(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName := c.Param("name")
+
+	tenant, err := h.tenantService.RetryProvisioning(ctx, tenantName)
+	if tenant != nil {
+		recordAudit(c, h.auditService, models.AuditLog{
+			TenantName:   tenantName,
+			Action:       models.AuditTenantProvision,
+			ResourceType: "tenant",
+			ResourceID:   tenantName,
+			Diff:         map[string]models.AuditChange{"status": {Old: models.TenantStatusFailed, New: tenant.Status}},
+		})
+	}
+	if err != nil {
+		respondTenantError(c, "Failed to provision tenant", tenant, err)
+		return
+	}
+
+	slog.InfoContext(ctx, "tenant provisioned on request")
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    tenant,
+	})
+}
+
 // DeleteTenant handles tenant soft deletion requests
 func (h *TenantHandler) DeleteTenant(c *gin.Context) {
-	ctx := context.Background()
+	ctx := middleware.RequestContext(c)
 	tenantName := c.Param("name")
 
-	fmt.Printf("\n🗑️  Soft delete request for tenant: %s\n", tenantName)
-
 	// Validate tenant name
 	if err := h.tenantService.ValidateTenantName(tenantName); err != nil {
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
@@ -39,7 +146,6 @@ func (h *TenantHandler) DeleteTenant(c *gin.Context) {
 	}
 
 	// Soft delete the tenant
-	fmt.Println("→ Marking tenant as deleted (data will be preserved)...")
 	stats, err := h.tenantService.DeleteTenant(ctx, tenantName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
@@ -49,10 +155,14 @@ func (h *TenantHandler) DeleteTenant(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("✓ Tenant '%s' soft deleted successfully\n", tenantName)
-	fmt.Printf("  - Marked as deleted: %v\n", stats["soft_deleted"])
-	fmt.Printf("  - Documents marked deleted: %v\n", stats["documents_marked_deleted"])
-	fmt.Printf("  - Note: %v\n\n", stats["note"])
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditTenantDelete,
+		ResourceType: "tenant",
+		ResourceID:   tenantName,
+		Diff:         map[string]models.AuditChange{"is_deleted": {Old: false, New: true}},
+		Details:      map[string]interface{}{"documents_marked_deleted": stats["documents_marked_deleted"]},
+	})
 
 	// Return success response
 	c.JSON(http.StatusOK, models.UploadResponse{
@@ -64,17 +174,16 @@ func (h *TenantHandler) DeleteTenant(c *gin.Context) {
 			"can_restore":              true,
 			"message":                  fmt.Sprintf("Tenant '%s' and %v documents marked as deleted. Can be restored.", tenantName, stats["documents_marked_deleted"]),
 			"restore_command":          fmt.Sprintf("POST /api/v1/tenant/%s/restore", tenantName),
+			"purge_command":            fmt.Sprintf("POST /api/v1/tenant/%s/purge", tenantName),
 		},
 	})
 }
 
 // RestoreTenant handles tenant restoration requests
 func (h *TenantHandler) RestoreTenant(c *gin.Context) {
-	ctx := context.Background()
+	ctx := middleware.RequestContext(c)
 	tenantName := c.Param("name")
 
-	fmt.Printf("\n♻️  Restore request for tenant: %s\n", tenantName)
-
 	// Validate tenant name
 	if err := h.tenantService.ValidateTenantName(tenantName); err != nil {
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
@@ -85,7 +194,6 @@ func (h *TenantHandler) RestoreTenant(c *gin.Context) {
 	}
 
 	// Restore the tenant
-	fmt.Println("→ Restoring tenant and documents...")
 	stats, err := h.tenantService.RestoreTenant(ctx, tenantName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
@@ -95,9 +203,14 @@ func (h *TenantHandler) RestoreTenant(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("✓ Tenant '%s' restored successfully\n", tenantName)
-	fmt.Printf("  - Tenant restored: %v\n", stats["tenant_restored"])
-	fmt.Printf("  - Documents restored: %v\n\n", stats["documents_restored"])
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditTenantRestore,
+		ResourceType: "tenant",
+		ResourceID:   tenantName,
+		Diff:         map[string]models.AuditChange{"is_deleted": {Old: true, New: false}},
+		Details:      map[string]interface{}{"documents_restored": stats["documents_restored"]},
+	})
 
 	// Return success response
 	c.JSON(http.StatusOK, models.UploadResponse{
@@ -112,11 +225,58 @@ func (h *TenantHandler) RestoreTenant(c *gin.Context) {
 	})
 }
 
+// PurgeTenant permanently removes a soft-deleted tenant's database and files.
+// With ?dry_run=true it only reports what would be removed.
+func (h *TenantHandler) PurgeTenant(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName := c.Param("name")
+	dryRun := c.Query("dry_run") == "true"
+
+	purge, err := h.purgeService.PurgeTenant(ctx, tenantName, dryRun)
+	if err != nil {
+		respondTenantError(c, "Failed to purge tenant", nil, err)
+		return
+	}
+
+	if purge.Purged {
+		slog.InfoContext(ctx, "tenant purged", "documents", purge.Documents, "objects", purge.Objects)
+		recordAudit(c, h.auditService, models.AuditLog{
+			TenantName:   tenantName,
+			Action:       models.AuditTenantPurge,
+			ResourceType: "tenant",
+			ResourceID:   tenantName,
+			Diff:         map[string]models.AuditChange{"status": {Old: models.TenantStatusDeleted, New: models.TenantStatusPurged}},
+			Details: map[string]interface{}{
+				"documents": purge.Documents,
+				"objects":   purge.Objects,
+			},
+		})
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    purge,
+	})
+}
+
+// PurgeReport lists the tenants the reaper would purge now (a dry run)
+func (h *TenantHandler) PurgeReport(c *gin.Context) {
+	report, err := h.purgeService.Report(middleware.RequestContext(c))
+	if err != nil {
+		respondTenantError(c, "Failed to build purge report", nil, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data:    report,
+	})
+}
+
 // ListTenants handles listing all active tenants
 func (h *TenantHandler) ListTenants(c *gin.Context) {
-	ctx := context.Background()
+	ctx := middleware.RequestContext(c)
 
-	fmt.Println("\n📋 Listing all active tenants...")
 	tenants, err := h.tenantService.ListTenants(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
@@ -126,8 +286,6 @@ func (h *TenantHandler) ListTenants(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("✓ Found %d active tenant(s)\n\n", len(tenants))
-
 	c.JSON(http.StatusOK, models.UploadResponse{
 		Success: true,
 		Data: map[string]interface{}{
@@ -140,9 +298,8 @@ func (h *TenantHandler) ListTenants(c *gin.Context) {
 
 // ListDeletedTenants handles listing all soft-deleted tenants
 func (h *TenantHandler) ListDeletedTenants(c *gin.Context) {
-	ctx := context.Background()
+	ctx := middleware.RequestContext(c)
 
-	fmt.Println("\n📋 Listing all deleted tenants...")
 	tenants, err := h.tenantService.ListDeletedTenants(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
@@ -152,8 +309,6 @@ func (h *TenantHandler) ListDeletedTenants(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("✓ Found %d deleted tenant(s)\n\n", len(tenants))
-
 	c.JSON(http.StatusOK, models.UploadResponse{
 		Success: true,
 		Data: map[string]interface{}{
@@ -165,3 +320,36 @@ func (h *TenantHandler) ListDeletedTenants(c *gin.Context) {
 	})
 }
 
+// respondTenantError writes a tenant error; a tenant whose provisioning
+// failed is included so the client can see its state
+func respondTenantError(c *gin.Context, message string, tenant *models.Tenant, err error) {
+	var data interface{}
+	if tenant != nil {
+		data = tenant
+	}
+	c.JSON(tenantErrorStatus(err), models.UploadResponse{
+		Success: false,
+		Data:    data,
+		Error:   fmt.Sprintf("%s: %s", message, err.Error()),
+	})
+}
+
+// tenantErrorStatus maps tenant service errors to HTTP status codes
+func tenantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTenantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidTenantRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTenantExists),
+		errors.Is(err, services.ErrTenantNotReady),
+		errors.Is(err, services.ErrTenantNotDeleted):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrQuotaExceeded):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrProvisioningFailed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
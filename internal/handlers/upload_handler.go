@@ -2,69 +2,115 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"time"
 
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/middleware"
 	"github.com/bacancy/droadmap/internal/models"
 	"github.com/bacancy/droadmap/internal/services"
-	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/bacancy/droadmap/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// maxFormFieldSize bounds the plain fields of a streamed upload form
+const maxFormFieldSize = 1024
+
 // UploadHandler handles PDF upload requests
 type UploadHandler struct {
-	tenantService  *services.TenantService
-	pdfService     *services.PDFService
-	aiService      *services.AIService
-	storageService *services.StorageService
-	mongoRepo      *repository.MongoRepository
+	tenantService *services.TenantService
+	pdfService    *services.PDFService
+	ingestService *services.IngestService
+	auditService  *services.AuditService
+	batchLimits   services.BatchLimits
 }
 
 // NewUploadHandler creates a new upload handler
 func NewUploadHandler(
 	tenantService *services.TenantService,
 	pdfService *services.PDFService,
-	aiService *services.AIService,
-	storageService *services.StorageService,
-	mongoRepo *repository.MongoRepository,
+	ingestService *services.IngestService,
+	auditService *services.AuditService,
+	batchLimits services.BatchLimits,
 ) *UploadHandler {
+	if batchLimits.Concurrency < 1 {
+		batchLimits.Concurrency = 1
+	}
 	return &UploadHandler{
-		tenantService:  tenantService,
-		pdfService:     pdfService,
-		aiService:      aiService,
-		storageService: storageService,
-		mongoRepo:      mongoRepo,
+		tenantService: tenantService,
+		pdfService:    pdfService,
+		ingestService: ingestService,
+		auditService:  auditService,
+		batchLimits:   batchLimits,
 	}
 }
 
-// HandleUpload processes PDF upload requests
+// HandleUpload accepts a PDF upload, stores it and queues it for ingestion.
+// The file is streamed to storage as it arrives instead of being buffered, so
+// the tenantName and onDuplicate fields must precede the pdf field.
+// Extraction, summarization and indexing run asynchronously; the response
+// carries a job ID whose progress is reported by GET /api/v1/jobs/:id.
 func (h *UploadHandler) HandleUpload(c *gin.Context) {
 	startTime := time.Now()
-	ctx := context.Background()
+	ctx := middleware.RequestContext(c)
 
-	// Step 1: Parse form data
-	tenantName := c.PostForm("tenantName")
-	file, err := c.FormFile("pdf")
-	
+	// Step 1: Parse form data up to the file
+	_, span := tracing.Start(ctx, "upload.read_form")
+	var fields map[string]string
+	var part *multipart.Part
+	reader, err := c.Request.MultipartReader()
+	if err == nil {
+		fields, part, err = readUploadFields(reader, "pdf")
+	}
+	tracing.End(span, err)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid multipart form: %s", err.Error()),
+		})
+		return
+	}
+	if part == nil {
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
 			Error:   "PDF file is required",
 		})
 		return
 	}
+	defer part.Close()
+
+	tenantName := fields["tenantName"]
+	if key := middleware.APIKey(c); tenantName == "" && key != nil {
+		// Tenant keys imply their tenant
+		tenantName = key.TenantName
+	}
+	// What to do when the same content is already stored: reject, existing
+	// (return the stored document) or version (store as its new version)
+	onDuplicate := fields["onDuplicate"]
+	if onDuplicate == "" {
+		onDuplicate = models.DuplicateExisting
+	}
 
 	// Step 2: Validate inputs
-	if err := h.tenantService.ValidateTenantName(tenantName); err != nil {
+	if !h.checkUploadTenant(c, tenantName) {
+		return
+	}
+	// The request context now carries the tenant for the logs
+	ctx = middleware.RequestContext(c)
+	if err := services.ValidateDuplicateMode(onDuplicate); err != nil {
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Invalid tenant name: %s", err.Error()),
+			Error:   fmt.Sprintf("Invalid onDuplicate: %s", err.Error()),
 		})
 		return
 	}
-
-	if err := h.pdfService.ValidatePDF(file); err != nil {
+	if err := h.pdfService.ValidateFileName(part.FileName()); err != nil {
 		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
 			Error:   fmt.Sprintf("Invalid PDF file: %s", err.Error()),
@@ -72,96 +118,339 @@ func (h *UploadHandler) HandleUpload(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("\n📥 Processing upload for tenant: %s, file: %s\n", tenantName, file.Filename)
+	// Step 3: Get or create tenant (creates MongoDB database if new; strict
+	// mode only accepts tenants created via POST /api/v1/tenants) and refuse
+	// the upload before reading the file if the tenant cannot take it
+	stepCtx, span := tracing.Start(ctx, "upload.tenant")
+	tenant, ok := h.uploadTenant(c, stepCtx, tenantName)
+	span.End()
+	if !ok {
+		return
+	}
+	if err := h.tenantService.CheckUploadStatus(tenant); err != nil {
+		outcome := uploadRejected(err)
+		c.JSON(outcome.status, outcome.response)
+		return
+	}
+
+	slog.DebugContext(ctx, "accepting upload", "file_name", part.FileName())
 
-	// Step 3: Get or create tenant (creates MongoDB database if new)
-	fmt.Println("→ Checking tenant database...")
-	tenant, err := h.tenantService.GetOrCreateTenant(ctx, tenantName)
+	// Step 4: Stream the file to storage, hashing it on the way and stopping
+	// at the tenant's file size quota, then inspect the local copy:
+	// structure, encryption and active content
+	stepCtx, span = tracing.Start(ctx, "upload.stream", attribute.String("file.name", part.FileName()))
+	file, err := h.ingestService.StreamUpload(stepCtx, tenantName, part.FileName(), part, tenant.Quotas.MaxFileSize)
+	if file != nil {
+		span.SetAttributes(attribute.Int64("file.size", file.Size))
+	}
+	tracing.End(span, err)
 	if err != nil {
+		if errors.Is(err, services.ErrFileTooLarge) {
+			c.JSON(http.StatusBadRequest, models.UploadResponse{
+				Success: false,
+				Error:   "Invalid PDF file: file size must be less than 50MB",
+			})
+			return
+		}
+		if errors.Is(err, services.ErrQuotaExceeded) {
+			outcome := uploadRejected(err)
+			c.JSON(outcome.status, outcome.response)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.UploadResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to get/create tenant: %s", err.Error()),
+			Error:   fmt.Sprintf("Failed to store file: %s", err.Error()),
 		})
 		return
 	}
-	fmt.Printf("✓ Tenant database ready: %s\n", tenant.DBName)
 
-	// Step 4: Extract text from PDF
-	fmt.Println("→ Extracting text from PDF...")
-	extractedText, err := h.pdfService.ExtractText(file)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+	_, span = tracing.Start(ctx, "upload.inspect")
+	quarantine, outcome := h.inspectUpload(file)
+	if outcome != nil {
+		span.SetAttributes(attribute.Int("http.response.status_code", outcome.status))
+	}
+	span.End()
+	if outcome != nil {
+		h.ingestService.Discard(ctx, file)
+		c.JSON(outcome.status, outcome.response)
+		return
+	}
+
+	// Steps 5-6: Queue the ingest job and return accepted response
+	stepCtx, span = tracing.Start(ctx, "upload.enqueue")
+	result := h.enqueueUpload(c, stepCtx, tenant, file, quarantine, onDuplicate, startTime)
+	span.SetAttributes(attribute.Int("http.response.status_code", result.status))
+	span.End()
+	c.JSON(result.status, result.response)
+}
+
+// readUploadFields reads the fields of a streamed multipart form up to the
+// file part named fileField, which is returned unread. Fields after the file
+// are not seen. A nil part means the form has no such file.
+func readUploadFields(reader *multipart.Reader, fileField string) (map[string]string, *multipart.Part, error) {
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return fields, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if part.FormName() == fileField && part.FileName() != "" {
+			return fields, part, nil
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(value) > maxFormFieldSize {
+				return nil, nil, fmt.Errorf("field '%s' is too long", part.FormName())
+			}
+			fields[part.FormName()] = string(value)
+		}
+		part.Close()
+	}
+}
+
+// checkUploadTenant validates the target tenant of an upload and that the
+// key may write to it, writing an error response if not
+func (h *UploadHandler) checkUploadTenant(c *gin.Context, tenantName string) bool {
+	if err := h.tenantService.ValidateTenantName(tenantName); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to extract PDF content: %s", err.Error()),
+			Error:   fmt.Sprintf("Invalid tenant name: %s", err.Error()),
 		})
-		return
+		return false
+	}
+	if !middleware.CanAccessTenant(c, tenantName) {
+		c.JSON(http.StatusForbidden, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("API key is not valid for tenant '%s'", tenantName),
+		})
+		return false
+	}
+	middleware.SetTenant(c, tenantName)
+	return true
+}
+
+// uploadOutcome is the response for one uploaded file
+type uploadOutcome struct {
+	status   int
+	response models.UploadResponse
+}
+
+// uploadTenantName reads the target tenant of a buffered upload form;
+// tenant keys imply their tenant
+func uploadTenantName(c *gin.Context) string {
+	tenantName := c.PostForm("tenantName")
+	if key := middleware.APIKey(c); tenantName == "" && key != nil {
+		tenantName = key.TenantName
+	}
+	return tenantName
+}
+
+// inspectUpload validates a file and inspects its content: structure,
+// encryption and active content. It returns the quarantine record for files
+// accepted under the quarantine policy, or the outcome of a refused file.
+func (h *UploadHandler) inspectUpload(file *services.FileUpload) (*models.Quarantine, *uploadOutcome) {
+	if err := h.pdfService.ValidatePDF(file); err != nil {
+		return nil, &uploadOutcome{http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid PDF file: %s", err.Error()),
+		}}
 	}
-	fmt.Printf("✓ Extracted %d characters of text\n", len(extractedText))
 
-	// Step 5: Upload file to storage
-	fmt.Println("→ Uploading file to storage...")
-	storagePath, storageURL, err := h.storageService.UploadFile(ctx, tenantName, file)
+	quarantine, err := h.pdfService.InspectFile(file)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+		var validationErr *services.PDFValidationError
+		if !errors.As(err, &validationErr) {
+			return nil, &uploadOutcome{http.StatusInternalServerError, models.UploadResponse{
+				Success: false,
+				Error:   fmt.Sprintf("Failed to inspect PDF: %s", err.Error()),
+			}}
+		}
+
+		// Malformed files are bad requests; well-formed but unsafe files are
+		// understood and refused
+		status := http.StatusBadRequest
+		var data interface{}
+		if len(validationErr.Findings) > 0 {
+			status = http.StatusUnprocessableEntity
+			data = map[string]interface{}{"findings": validationErr.Findings}
+		}
+		return nil, &uploadOutcome{status, models.UploadResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to store file: %s", err.Error()),
-		})
-		return
+			Data:    data,
+			Error:   fmt.Sprintf("Invalid PDF file: %s", validationErr.Reason),
+			Code:    validationErr.Code,
+		}}
 	}
-	fmt.Printf("✓ File stored at: %s\n", storagePath)
 
-	// Step 6: Generate AI summary
-	fmt.Println("→ Generating AI summary...")
-	summary, err := h.aiService.GenerateSummary(ctx, extractedText)
+	return quarantine, nil
+}
+
+// uploadTenant gets or creates the tenant of an upload, writing an error
+// response if it cannot take uploads
+func (h *UploadHandler) uploadTenant(c *gin.Context, ctx context.Context, tenantName string) (*models.Tenant, bool) {
+	tenant, created, err := h.tenantService.GetOrCreateTenant(ctx, tenantName)
+	if created {
+		recordAudit(c, h.auditService, models.AuditLog{
+			TenantName:   tenantName,
+			Action:       models.AuditTenantCreate,
+			ResourceType: "tenant",
+			ResourceID:   tenantName,
+			Diff: map[string]models.AuditChange{
+				"status":  {New: tenant.Status},
+				"db_name": {New: tenant.DBName},
+			},
+		})
+	}
 	if err != nil {
-		fmt.Printf("⚠ AI summarization failed: %s\n", err.Error())
-		summary = "Summary generation failed. Please check AI service configuration."
-	} else {
-		fmt.Printf("✓ Summary generated (%d characters)\n", len(summary))
-	}
-
-	// Step 7: Store document in tenant's MongoDB database
-	fmt.Println("→ Storing document in database...")
-	document := &models.Document{
-		TenantName:    tenantName,
-		FileName:      file.Filename,
-		FileSize:      file.Size,
-		StoragePath:   storagePath,
-		StorageURL:    storageURL,
-		ExtractedText: extractedText,
-		Summary:       summary,
-		UploadedAt:    time.Now(),
-		IsDeleted:     false,
-		DeletedAt:     nil,
-	}
-
-	err = h.mongoRepo.InsertDocument(ctx, tenantName, document)
+		respondTenantError(c, "Failed to get/create tenant", nil, err)
+		return nil, false
+	}
+	return tenant, true
+}
+
+// uploadRejected is the outcome of an upload the tenant cannot take
+func uploadRejected(err error) uploadOutcome {
+	code := ""
+	if errors.Is(err, services.ErrQuotaExceeded) {
+		code = "TENANT_QUOTA_EXCEEDED"
+	}
+	return uploadOutcome{tenantErrorStatus(err), models.UploadResponse{
+		Success: false,
+		Error:   fmt.Sprintf("Upload rejected: %s", err.Error()),
+		Code:    code,
+	}}
+}
+
+// enqueueUpload checks a validated file against the tenant's quotas, stores
+// it and queues its ingest job
+func (h *UploadHandler) enqueueUpload(
+	c *gin.Context,
+	ctx context.Context,
+	tenant *models.Tenant,
+	file *services.FileUpload,
+	quarantine *models.Quarantine,
+	onDuplicate string,
+	startTime time.Time,
+) uploadOutcome {
+	tenantName := tenant.TenantName
+
+	// The tenant must be active and the file must fit its quotas
+	if err := h.tenantService.CheckUpload(ctx, tenant, file.Size); err != nil {
+		h.ingestService.Discard(ctx, file)
+		return uploadRejected(err)
+	}
+
+	// Store the file and queue the ingest job
+	result, err := h.ingestService.Enqueue(ctx, tenantName, file, quarantine, onDuplicate)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+		code := ""
+		var data interface{}
+		if errors.Is(err, services.ErrDuplicateDocument) {
+			code = "DUPLICATE_DOCUMENT"
+			data = duplicateData(result)
+		}
+		return uploadOutcome{documentErrorStatus(err), models.UploadResponse{
 			Success: false,
-			Error:   fmt.Sprintf("Failed to store document: %s", err.Error()),
-		})
-		return
+			Data:    data,
+			Error:   fmt.Sprintf("Failed to queue upload: %s", err.Error()),
+			Code:    code,
+		}}
 	}
 
-	processingTime := time.Since(startTime).Milliseconds()
-	fmt.Printf("✓ Document stored successfully (ID: %s)\n", document.ID.Hex())
-	fmt.Printf("✅ Total processing time: %dms\n\n", processingTime)
+	acceptTime := time.Since(startTime).Milliseconds()
 
-	// Step 8: Return success response
-	c.JSON(http.StatusOK, models.UploadResponse{
-		Success: true,
-		Data: map[string]interface{}{
-			"document_id":       document.ID.Hex(),
-			"tenant_name":       tenantName,
-			"file_name":         file.Filename,
-			"file_size":         file.Size,
-			"summary":           summary,
-			"storage_url":       storageURL,
-			"uploaded_at":       document.UploadedAt,
-			"processing_time_ms": processingTime,
+	// Identical content is already stored or being ingested; nothing was queued
+	if result.DuplicateJob || (result.Job == nil && result.Duplicate != nil) {
+		data := duplicateData(result)
+		slog.InfoContext(ctx, "duplicate upload, nothing queued",
+			logging.KeyDocumentID, data["document_id"], "file_name", file.Filename, "duration_ms", acceptTime)
+		data["tenant_name"] = tenantName
+		data["file_name"] = file.Filename
+		data["accept_time_ms"] = acceptTime
+
+		status := http.StatusOK
+		if result.DuplicateJob {
+			status = http.StatusAccepted
+		}
+		return uploadOutcome{status, models.UploadResponse{
+			Success: true,
+			Data:    data,
+		}}
+	}
+
+	job := result.Job
+	slog.InfoContext(ctx, "ingest job queued", logging.KeyJobID, job.ID, logging.KeyDocumentID, job.DocumentID,
+		"file_name", file.Filename, "size", file.Size, "duration_ms", acceptTime)
+
+	details := map[string]interface{}{
+		"job_id":      job.ID,
+		"quarantined": quarantine != nil,
+	}
+	if job.NewVersion {
+		details["new_version"] = true
+	}
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditDocumentUpload,
+		ResourceType: "document",
+		ResourceID:   job.DocumentID,
+		Diff: map[string]models.AuditChange{
+			"file_name":    {New: file.Filename},
+			"file_size":    {New: file.Size},
+			"storage_path": {New: job.StoragePath},
 		},
+		Details: details,
 	})
+
+	data := map[string]interface{}{
+		"job_id":         job.ID,
+		"status":         job.Status,
+		"status_url":     fmt.Sprintf("/api/v1/jobs/%s", job.ID),
+		"document_id":    job.DocumentID,
+		"tenant_name":    tenantName,
+		"file_name":      file.Filename,
+		"file_size":      file.Size,
+		"accept_time_ms": acceptTime,
+	}
+	if quarantine != nil {
+		data["quarantine"] = quarantine
+	}
+	if job.NewVersion {
+		data["new_version"] = true
+	}
+	return uploadOutcome{http.StatusAccepted, models.UploadResponse{
+		Success: true,
+		Data:    data,
+	}}
+}
+
+// duplicateData describes the stored document or pending job an upload
+// duplicates
+func duplicateData(result *services.UploadResult) map[string]interface{} {
+	data := map[string]interface{}{"duplicate": true}
+	if result == nil {
+		return data
+	}
+	if result.Duplicate != nil {
+		data["document_id"] = result.Duplicate.ID.Hex()
+		data["content_hash"] = result.Duplicate.ContentHash
+		data["is_deleted"] = result.Duplicate.IsDeleted
+	}
+	if result.DuplicateJob && result.Job != nil {
+		data["job_id"] = result.Job.ID
+		data["status"] = result.Job.Status
+		data["status_url"] = fmt.Sprintf("/api/v1/jobs/%s", result.Job.ID)
+		data["document_id"] = result.Job.DocumentID
+		data["content_hash"] = result.Job.ContentHash
+	}
+	return data
 }
 
 // HealthHandler handles health check requests
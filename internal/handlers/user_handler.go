@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// UserHandler handles user management requests. Tenant admins manage the
+// users of their own tenant; platform admins manage all users.
+type UserHandler struct {
+	userService  *services.UserService
+	auditService *services.AuditService
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(userService *services.UserService, auditService *services.AuditService) *UserHandler {
+	return &UserHandler{
+		userService:  userService,
+		auditService: auditService,
+	}
+}
+
+// CreateUser creates a user in a tenant, or a platform admin
+func (h *UserHandler) CreateUser(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	var req models.UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid request body: %s", err.Error()),
+		})
+		return
+	}
+
+	// Tenant admins cannot create users elsewhere or grant platform admin
+	if req.Role == models.RolePlatformAdmin && !middleware.HasRole(c, models.RolePlatformAdmin) ||
+		req.Role != models.RolePlatformAdmin && !middleware.CanAccessTenant(c, req.TenantName) {
+		c.JSON(http.StatusForbidden, models.UploadResponse{
+			Success: false,
+			Error:   "Failed to create user: not allowed to create this user",
+		})
+		return
+	}
+
+	user, err := h.userService.CreateUser(ctx, req)
+	if err != nil {
+		c.JSON(userErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create user: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "user created", "user_id", user.ID, "role", user.Role, logging.KeyTenant, user.TenantName)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   user.TenantName,
+		Action:       models.AuditUserCreate,
+		ResourceType: "user",
+		ResourceID:   strconv.Itoa(user.ID),
+		Diff: map[string]models.AuditChange{
+			"email": {New: user.Email},
+			"name":  {New: user.Name},
+			"role":  {New: user.Role},
+		},
+	})
+
+	c.JSON(http.StatusCreated, models.UploadResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// ListUsers lists users, filtered by tenant_name. Tenant admins only see
+// their own tenant.
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	tenantName := c.Query("tenant_name")
+	if !middleware.HasRole(c, models.RolePlatformAdmin) {
+		tenantName = middleware.APIKey(c).TenantName
+	}
+
+	users, err := h.userService.ListUsers(ctx, tenantName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list users: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"users": users,
+			"count": len(users),
+		},
+	})
+}
+
+// DisableUser disables a user and, with it, every API key issued for them
+func (h *UserHandler) DisableUser(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+
+	user, err := h.userService.GetUser(ctx, c.Param("id"))
+	if err == nil && !middleware.CanAccessTenant(c, user.TenantName) {
+		// Don't reveal users of other tenants
+		err = fmt.Errorf("%w: '%s'", services.ErrUserNotFound, c.Param("id"))
+	}
+	if err == nil {
+		err = h.userService.DisableUser(ctx, user.ID)
+	}
+	if err != nil {
+		c.JSON(userErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to disable user: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "user disabled", "user_id", user.ID)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   user.TenantName,
+		Action:       models.AuditUserDisable,
+		ResourceType: "user",
+		ResourceID:   strconv.Itoa(user.ID),
+		Diff:         map[string]models.AuditChange{"disabled": {Old: false, New: true}},
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"id":       user.ID,
+			"email":    user.Email,
+			"disabled": true,
+		},
+	})
+}
+
+// userErrorStatus maps user service errors to HTTP status codes
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrTenantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidUserRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrUserExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bacancy/droadmap/internal/middleware"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandler handles webhook management and delivery history requests
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+	tenantService  *services.TenantService
+	auditService   *services.AuditService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookService *services.WebhookService, tenantService *services.TenantService, auditService *services.AuditService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		tenantService:  tenantService,
+		auditService:   auditService,
+	}
+}
+
+// CreateWebhook registers an endpoint for the tenant's events. The signing
+// secret is only returned here.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Invalid request body: %s", err.Error()),
+		})
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(ctx, tenantName, req)
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to create webhook: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "webhook created", "webhook_id", webhook.ID, "url", webhook.URL)
+
+	// Never record the secret itself
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditWebhookCreate,
+		ResourceType: "webhook",
+		ResourceID:   webhook.ID,
+		Diff: map[string]models.AuditChange{
+			"url":    {New: webhook.URL},
+			"events": {New: webhook.Events},
+		},
+	})
+
+	c.JSON(http.StatusCreated, models.UploadResponse{
+		Success: true,
+		Data:    webhook,
+	})
+}
+
+// ListWebhooks lists the tenant's webhooks
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.webhookService.ListWebhooks(ctx, tenantName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list webhooks: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"webhooks": webhooks,
+			"count":    len(webhooks),
+		},
+	})
+}
+
+// DeleteWebhook deletes a webhook and drops its pending deliveries
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+	webhookID := c.Param("id")
+
+	if err := h.webhookService.DeleteWebhook(ctx, tenantName, webhookID); err != nil {
+		c.JSON(webhookErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to delete webhook: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "webhook deleted", "webhook_id", webhookID)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditWebhookDelete,
+		ResourceType: "webhook",
+		ResourceID:   webhookID,
+	})
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"webhook_id": webhookID,
+			"deleted":    true,
+		},
+	})
+}
+
+// ListDeliveries returns the delivery history of one webhook, newest first.
+// Filters: status (pending, delivered or dead) and limit.
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	h.listDeliveries(c, c.Param("id"), c.Query("status"))
+}
+
+// ListDeadLetters returns the deliveries of all the tenant's webhooks that
+// failed every attempt, newest first
+func (h *WebhookHandler) ListDeadLetters(c *gin.Context) {
+	h.listDeliveries(c, "", models.DeliveryStatusDead)
+}
+
+// listDeliveries writes the tenant's deliveries matching the filter
+func (h *WebhookHandler) listDeliveries(c *gin.Context, webhookID, status string) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.UploadResponse{
+				Success: false,
+				Error:   "Invalid query: limit must be a number",
+			})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(ctx, models.DeliveryFilter{
+		TenantName: tenantName,
+		WebhookID:  webhookID,
+		Status:     status,
+		Limit:      limit,
+	})
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to list webhook deliveries: %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UploadResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"deliveries": deliveries,
+			"count":      len(deliveries),
+		},
+	})
+}
+
+// Redeliver queues a dead or delivered delivery to be sent again with a
+// fresh set of attempts
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	ctx := middleware.RequestContext(c)
+	tenantName, ok := tenantParam(c, h.tenantService)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(ctx, tenantName, c.Param("id"))
+	if err != nil {
+		c.JSON(webhookErrorStatus(err), models.UploadResponse{
+			Success: false,
+			Error:   fmt.Sprintf("Failed to redeliver: %s", err.Error()),
+		})
+		return
+	}
+
+	slog.InfoContext(ctx, "webhook delivery requeued", "delivery_id", delivery.ID, "webhook_id", delivery.WebhookID, "event", delivery.Event)
+
+	recordAudit(c, h.auditService, models.AuditLog{
+		TenantName:   tenantName,
+		Action:       models.AuditWebhookRedeliver,
+		ResourceType: "webhook_delivery",
+		ResourceID:   delivery.ID,
+		Details:      map[string]interface{}{"webhook_id": delivery.WebhookID, "event": delivery.Event},
+	})
+
+	c.JSON(http.StatusAccepted, models.UploadResponse{
+		Success: true,
+		Data:    delivery,
+	})
+}
+
+// webhookErrorStatus maps webhook service errors to HTTP status codes
+func webhookErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound),
+		errors.Is(err, services.ErrDeliveryNotFound),
+		errors.Is(err, services.ErrTenantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidWebhookRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrDeliveryConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,125 @@
+// Package logging configures the structured log/slog logger of the service.
+// Records carry the request, tenant, document, job and stage of their context
+// along with the trace they belong to, and secrets are redacted from every
+// message and attribute before they are written.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Log formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Context attribute keys
+const (
+	KeyRequestID  = "request_id"
+	KeyTenant     = "tenant"
+	KeyDocumentID = "document_id"
+	KeyJobID      = "job_id"
+	KeyStage      = "stage"
+)
+
+// Config selects the level and format of the log
+type Config struct {
+	Level  string // debug, info, warn or error
+	Format string // json or text
+	// Secrets are redacted wherever they appear, in addition to the values
+	// recognized by their shape or attribute key
+	Secrets []string
+}
+
+// Setup makes a logger writing to w the default logger, including for the
+// standard library's log package
+func Setup(w io.Writer, config Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level '%s' (use debug, info, warn or error)", config.Level)
+	}
+
+	redactor := newRedactor(config.Secrets)
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactor.replaceAttr}
+
+	var handler slog.Handler
+	switch strings.ToLower(config.Format) {
+	case "", FormatJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case FormatText:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format '%s' (use json or text)", config.Format)
+	}
+
+	logger := slog.New(&contextHandler{Handler: handler, redactor: redactor})
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// attrsKey is the context key of the attributes added by With
+type attrsKey struct{}
+
+// With returns ctx carrying attributes that are added to every record logged
+// with it, replacing earlier values of the same keys
+func With(ctx context.Context, args ...any) context.Context {
+	added := slog.Group("", args...).Value.Group()
+	existing, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+
+	attrs := make([]slog.Attr, 0, len(existing)+len(added))
+	for _, attr := range existing {
+		if !hasKey(added, attr.Key) {
+			attrs = append(attrs, attr)
+		}
+	}
+	attrs = append(attrs, added...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler adds the attributes and trace of the context to records and
+// redacts their messages
+type contextHandler struct {
+	slog.Handler
+	redactor *redactor
+}
+
+// Handle implements slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", span.TraceID().String()),
+			slog.String("span_id", span.SpanID().String()),
+		)
+	}
+	record.Message = h.redactor.redact(record.Message)
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs), redactor: h.redactor}
+}
+
+// WithGroup implements slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name), redactor: h.redactor}
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secrets in log output
+const redacted = "[REDACTED]"
+
+// secretPatterns match secrets by their shape; the replacement keeps the
+// surrounding context
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Credentials in URL query strings, e.g. the Gemini ?key=
+	{regexp.MustCompile(`(?i)([?&](?:key|api_key|apikey|token|access_token|signature|x-amz-signature)=)[^&\s"']+`), "${1}" + redacted},
+	// Passwords in connection strings
+	{regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`), "${1}" + redacted + "@"},
+	// Authorization headers
+	{regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + redacted},
+	// API keys of this service (the short display prefix is kept), webhook
+	// secrets, Google and OpenAI keys
+	{regexp.MustCompile(`\bdrk_[A-Za-z0-9_-]{16,}`), redacted},
+	{regexp.MustCompile(`\bwhsec_[A-Za-z0-9+/=_-]+`), redacted},
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), redacted},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`), redacted},
+}
+
+// sensitiveKeys are attribute key names, or endings of names, whose values
+// are always redacted
+var sensitiveKeys = []string{"password", "secret", "token", "api_key", "apikey", "authorization"}
+
+// keySeparators normalizes the separators of attribute keys to underscores
+var keySeparators = strings.NewReplacer("-", "_", ".", "_")
+
+// redactor removes secrets from log messages and attributes
+type redactor struct {
+	// secrets replaces configured secret values
+	secrets *strings.Replacer
+}
+
+func newRedactor(secrets []string) *redactor {
+	var pairs []string
+	for _, secret := range secrets {
+		// Short values would redact ordinary words
+		if len(secret) >= 8 {
+			pairs = append(pairs, secret, redacted)
+		}
+	}
+	return &redactor{secrets: strings.NewReplacer(pairs...)}
+}
+
+// redact returns s with every secret it contains replaced
+func (r *redactor) redact(s string) string {
+	s = r.secrets.Replace(s)
+	for _, p := range secretPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// replaceAttr redacts attributes named like secrets, and secrets within
+// string and error values
+func (r *redactor) replaceAttr(groups []string, attr slog.Attr) slog.Attr {
+	if sensitiveKey(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(r.redact(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			attr.Value = slog.StringValue(r.redact(err.Error()))
+		}
+	}
+	return attr
+}
+
+// sensitiveKey reports whether an attribute key names a secret. The key must
+// end with a sensitive name, so db_password, accessToken and X-Api-Key are
+// redacted but counts such as prompt_tokens or token_count are not.
+func sensitiveKey(key string) bool {
+	key = keySeparators.Replace(strings.ToLower(key))
+	for _, sensitive := range sensitiveKeys {
+		if strings.HasSuffix(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
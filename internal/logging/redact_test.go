@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r := newRedactor([]string{"minio-secret-123", "short"})
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"query key", "GET https://generativelanguage.googleapis.com/v1/models?key=abc123&alt=json", "GET https://generativelanguage.googleapis.com/v1/models?key=[REDACTED]&alt=json"},
+		{"query signature", "https://minio:9000/b/o?X-Amz-Signature=deadbeef", "https://minio:9000/b/o?X-Amz-Signature=[REDACTED]"},
+		{"query token after other params", "/hook?id=1&access_token=xyz", "/hook?id=1&access_token=[REDACTED]"},
+		{"unrelated query", "/search?q=keynote&page=2", "/search?q=keynote&page=2"},
+		{"DSN password", "failed to connect to postgres://app:s3cr3t@db:5432/master", "failed to connect to postgres://app:[REDACTED]@db:5432/master"},
+		{"DSN without password", "mongodb://mongo:27017", "mongodb://mongo:27017"},
+		{"bearer", "Authorization: Bearer eyJhbGciOi.J9.sig", "Authorization: Bearer [REDACTED]"},
+		{"API key", "key drk_0123456789abcdefABCDEF rejected", "key [REDACTED] rejected"},
+		{"API key display prefix", "key drk_0123 revoked", "key drk_0123 revoked"},
+		{"webhook secret", "secret whsec_c2VjcmV0 issued", "secret [REDACTED] issued"},
+		{"Google key", "AIza" + strings.Repeat("x", 35), "[REDACTED]"},
+		{"OpenAI key", "using sk-proj0123456789abcdef", "using [REDACTED]"},
+		{"configured secret", "minio rejected minio-secret-123", "minio rejected [REDACTED]"},
+		{"short configured secret", "a short message", "a short message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redact(tt.in); got != tt.want {
+				t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensitiveKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{"password", true},
+		{"db_password", true},
+		{"Secret", true},
+		{"webhook_secret", true},
+		{"token", true},
+		{"access_token", true},
+		{"accessToken", true},
+		{"api_key", true},
+		{"X-Api-Key", true},
+		{"apikey", true},
+		{"Authorization", true},
+		{"tokens", false},
+		{"prompt_tokens", false},
+		{"token_count", false},
+		{"max_tokens", false},
+		{"secret_id", false},
+		{"key_prefix", false},
+		{"tenant", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := sensitiveKey(tt.key); got != tt.sensitive {
+				t.Errorf("sensitiveKey(%q) = %v, want %v", tt.key, got, tt.sensitive)
+			}
+		})
+	}
+}
+
+func TestReplaceAttr(t *testing.T) {
+	r := newRedactor(nil)
+
+	tests := []struct {
+		name string
+		attr slog.Attr
+		want string
+	}{
+		{"sensitive key", slog.String("db_password", "hunter22"), redacted},
+		{"sensitive key with a number", slog.Int("api_key", 42), redacted},
+		{"token count", slog.Int("prompt_tokens", 1200), "1200"},
+		{"string value", slog.String("url", "/x?token=abc"), "/x?token=" + redacted},
+		{"error value", slog.Any("error", errors.New("dial postgres://u:pw@db/x")), "dial postgres://u:" + redacted + "@db/x"},
+		{"other value", slog.Int("pages", 3), "3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.replaceAttr(nil, tt.attr)
+			if got.Key != tt.attr.Key || got.Value.String() != tt.want {
+				t.Errorf("replaceAttr(%v) = %v, want %s=%s", tt.attr, got, tt.attr.Key, tt.want)
+			}
+		})
+	}
+}
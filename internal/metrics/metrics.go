@@ -0,0 +1,202 @@
+// Package metrics defines the Prometheus metrics of the service. Metrics are
+// registered with the default registry, which also carries the Go runtime and
+// process collectors, and are served by Handler.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "pdf_ingest"
+
+// Outcomes of ingest steps and summarizer calls
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method, status code and tenant.",
+	}, []string{"method", "route", "status", "tenant"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and tenant.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route", "tenant"})
+
+	ingestStepDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ingest_step_duration_seconds",
+		Help:      "Duration of ingest pipeline steps (upload, extract, summarize, store) by outcome.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 15), // 10ms to ~160s
+	}, []string{"step", "outcome"})
+
+	ingestJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_job_attempts_total",
+		Help:      "Finished ingest job attempts by resulting job status (succeeded, queued for retry, failed).",
+	}, []string{"status"})
+
+	summarizerCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "summarizer_calls_total",
+		Help:      "Summarizer calls by provider and outcome.",
+	}, []string{"provider", "outcome"})
+
+	summarizerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "summarizer_call_duration_seconds",
+		Help:      "Summarizer call latency by provider.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12), // 50ms to ~100s
+	}, []string{"provider"})
+
+	summarizerFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "summarizer_fallbacks_total",
+		Help:      "Summaries replaced by the extractive fallback, by the provider that failed.",
+	}, []string{"provider"})
+
+	extractedChars = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "extracted_characters",
+		Help:      "Characters of text extracted per document.",
+		Buckets:   prometheus.ExponentialBuckets(100, 4, 10), // 100 to ~26M
+	})
+
+	uploadSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of uploaded files.",
+		Buckets:   prometheus.ExponentialBuckets(16*1024, 4, 8), // 16KB to 256MB
+	})
+
+	mongoConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mongo_pool_connections",
+		Help:      "MongoDB pool connections, open and checked out.",
+	}, []string{"state"})
+
+	mongoCheckoutFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mongo_pool_checkout_failures_total",
+		Help:      "Failed attempts to check a connection out of the MongoDB pool.",
+	})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveRequest records a served HTTP request. route is the route pattern,
+// not the path, so IDs do not become labels.
+func ObserveRequest(method, route string, status int, tenant string, elapsed time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status), tenant).Inc()
+	httpDuration.WithLabelValues(method, route, tenant).Observe(elapsed.Seconds())
+}
+
+// ObserveIngestStep records the duration of an ingest pipeline step
+func ObserveIngestStep(step string, err error, elapsed time.Duration) {
+	ingestStepDuration.WithLabelValues(step, outcome(err)).Observe(elapsed.Seconds())
+}
+
+// CountIngestJob records the status a job attempt ended in
+func CountIngestJob(status string) {
+	ingestJobs.WithLabelValues(status).Inc()
+}
+
+// ObserveSummarizerCall records one call to a summarization provider
+func ObserveSummarizerCall(provider string, err error, elapsed time.Duration) {
+	summarizerCalls.WithLabelValues(provider, outcome(err)).Inc()
+	summarizerDuration.WithLabelValues(provider).Observe(elapsed.Seconds())
+}
+
+// CountSummarizerFallback records a summary produced by the fallback after
+// provider failed
+func CountSummarizerFallback(provider string) {
+	summarizerFallbacks.WithLabelValues(provider).Inc()
+}
+
+// ObserveExtractedChars records the amount of text extracted from a document
+func ObserveExtractedChars(chars int) {
+	extractedChars.Observe(float64(chars))
+}
+
+// ObserveUploadSize records the size of an uploaded file
+func ObserveUploadSize(bytes int64) {
+	uploadSize.Observe(float64(bytes))
+}
+
+// RegisterPostgresPool exports the statistics of the master database pool
+func RegisterPostgresPool(stat func() *pgxpool.Stat) {
+	gauge := func(name, help string, value func(s *pgxpool.Stat) float64) {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stat()) })
+	}
+	counter := func(name, help string, value func(s *pgxpool.Stat) float64) {
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(stat()) })
+	}
+
+	gauge("postgres_pool_connections_max", "Maximum size of the PostgreSQL pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	gauge("postgres_pool_connections_total", "Open PostgreSQL connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("postgres_pool_connections_acquired", "PostgreSQL connections in use.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("postgres_pool_connections_idle", "Idle PostgreSQL connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	counter("postgres_pool_acquires_total", "Connections acquired from the PostgreSQL pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("postgres_pool_empty_acquires_total", "Acquires that had to wait for a PostgreSQL connection.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("postgres_pool_acquire_wait_seconds_total", "Time spent acquiring PostgreSQL connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+}
+
+// MongoPoolMonitor returns a pool monitor that tracks the MongoDB client's
+// connections
+func MongoPoolMonitor() *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				mongoConnections.WithLabelValues("open").Inc()
+			case event.ConnectionClosed:
+				mongoConnections.WithLabelValues("open").Dec()
+			case event.GetSucceeded:
+				mongoConnections.WithLabelValues("checked_out").Inc()
+			case event.ConnectionReturned:
+				mongoConnections.WithLabelValues("checked_out").Dec()
+			case event.GetFailed:
+				mongoCheckoutFailures.Inc()
+			}
+		},
+	}
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// tenantContextKey is the gin context key holding the tenant a request
+	// acted on, when it is not in the path
+	tenantContextKey = "tenant"
+	// unmatchedRoute labels requests that matched no route
+	unmatchedRoute = "unmatched"
+)
+
+// Metrics records the count and latency of every request by route and tenant
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), Tenant(c), time.Since(start))
+	}
+}
+
+// SetTenant records the tenant a request acts on for handlers whose tenant is
+// not in the path, such as uploads, and adds it to the request's logs
+func SetTenant(c *gin.Context, tenantName string) {
+	c.Set(tenantContextKey, tenantName)
+	c.Request = c.Request.WithContext(logging.With(c.Request.Context(), logging.KeyTenant, tenantName))
+}
+
+// Tenant returns the tenant a request acted on, or "" if none. The :name path
+// parameter only counts once the request is authenticated, which also
+// checked that the key may access it.
+func Tenant(c *gin.Context) string {
+	if tenantName := c.GetString(tenantContextKey); tenantName != "" {
+		return tenantName
+	}
+	if APIKey(c) != nil {
+		return c.Param("name")
+	}
+	return ""
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// RequestIDHeader carries the request ID in requests and responses
+	RequestIDHeader = "X-Request-ID"
+	// requestIDContextKey is the gin context key holding the request ID
+	requestIDContextKey = "request_id"
+)
+
+// validRequestID limits client-supplied IDs to safe, bounded values
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID assigns every request an ID, reusing a well-formed X-Request-ID
+// from the client, and echoes it in the response
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Set(requestIDContextKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), logging.KeyRequestID, id))
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID assigned by RequestID, or "" if none
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
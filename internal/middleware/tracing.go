@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/bacancy/droadmap/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Tracing starts a span for every request, continuing the trace of a W3C
+// traceparent header from the client. Handlers reach the span through the
+// request context.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		ctx := tracing.ExtractHeader(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.StartServer(ctx, c.Request.Method+" "+route,
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("request.id", GetRequestID(c)),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if tenantName := Tenant(c); tenantName != "" {
+			span.SetAttributes(attribute.String("tenant.name", tenantName))
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
+
+// RequestContext returns the context for the services a request calls. It
+// carries the request's trace but is not cancelled when the client goes
+// away, so work a request started is not left half done.
+func RequestContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// API key scopes
+const (
+	ScopeTenant = "tenant" // bound to a single tenant
+	ScopeAdmin  = "admin"  // platform-wide
+)
+
+// APIKey is an API key record. Only a hash of the secret is stored.
+// Keys issued for a user act with that user's role and stop working when the
+// user is disabled; other keys act as tenant-admin (tenant scope) or
+// platform-admin (admin scope).
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	TenantName string     `json:"tenant_name,omitempty"` // empty for admin keys
+	UserID     *int       `json:"user_id,omitempty"`
+	Role       string     `json:"role"`
+	Prefix     string     `json:"prefix"` // first characters of the key, for identification
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedAPIKey is returned once when a key is issued or rotated; the
+// plaintext key cannot be retrieved again
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyRequest is the body of POST /api/v1/keys
+type APIKeyRequest struct {
+	Name       string `json:"name"`
+	Scope      string `json:"scope"` // tenant (default) or admin
+	TenantName string `json:"tenant_name"`
+	UserID     int    `json:"user_id"` // issue the key for a user; scope and tenant follow the user
+}
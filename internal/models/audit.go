@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// Audited actions
+const (
+	AuditDocumentUpload   = "document.upload"
+	AuditDocumentUpdate   = "document.update"
+	AuditDocumentDelete   = "document.delete"
+	AuditDocumentRestore  = "document.restore"
+	AuditDocumentRollback = "document.rollback"
+	AuditTenantCreate     = "tenant.create"
+	AuditTenantDelete     = "tenant.delete"
+	AuditTenantRestore    = "tenant.restore"
+	AuditTenantProvision  = "tenant.provision"
+	AuditTenantPurge      = "tenant.purge"
+	AuditAPIKeyIssue      = "api_key.issue"
+	AuditAPIKeyRotate     = "api_key.rotate"
+	AuditAPIKeyRevoke     = "api_key.revoke"
+	AuditUserCreate       = "user.create"
+	AuditUserDisable      = "user.disable"
+	AuditWebhookCreate    = "webhook.create"
+	AuditWebhookDelete    = "webhook.delete"
+	AuditWebhookRedeliver = "webhook.redeliver"
+	AuditReconcile        = "reconcile.run"
+)
+
+// AuditChange is the old and new value of one changed field
+type AuditChange struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// AuditLog records a mutating action. Actor is "user:<id>" for keys issued to
+// a user and "key:<id>" otherwise.
+type AuditLog struct {
+	ID           int64                  `json:"id"`
+	TenantName   string                 `json:"tenant_name,omitempty"`
+	Action       string                 `json:"action"`
+	ResourceType string                 `json:"resource_type"`
+	ResourceID   string                 `json:"resource_id"`
+	Actor        string                 `json:"actor"`
+	ActorRole    string                 `json:"actor_role,omitempty"`
+	APIKeyID     string                 `json:"api_key_id,omitempty"`
+	RequestID    string                 `json:"request_id,omitempty"`
+	Diff         map[string]AuditChange `json:"diff,omitempty"`
+	Details      map[string]interface{} `json:"details,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// AuditFilter selects audit log entries. Zero values match everything.
+type AuditFilter struct {
+	TenantName string
+	Action     string
+	Actor      string
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+	BeforeID   int64      // keyset pagination: only entries older than this ID
+	Limit      int
+}
+
+// AuditPage is one page of audit log entries, newest first
+type AuditPage struct {
+	Entries      []AuditLog `json:"entries"`
+	NextBeforeID int64      `json:"next_before_id,omitempty"` // pass as before_id for the next page
+}
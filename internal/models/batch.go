@@ -0,0 +1,25 @@
+package models
+
+// BatchFileResult is the outcome of one file of a batch upload. Status and
+// the response fields are what a single upload of the file would return.
+type BatchFileResult struct {
+	FileName string      `json:"file_name"`
+	Archive  string      `json:"archive,omitempty"` // archive the file was extracted from
+	Status   int         `json:"status"`
+	Success  bool        `json:"success"`
+	Data     interface{} `json:"data,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Code     string      `json:"code,omitempty"`
+}
+
+// BatchUploadReport summarizes a batch upload, listing files in the order
+// they were submitted
+type BatchUploadReport struct {
+	TenantName string            `json:"tenant_name"`
+	Files      int               `json:"files"`
+	Queued     int               `json:"queued"`
+	Duplicates int               `json:"duplicates"`
+	Failed     int               `json:"failed"`
+	ElapsedMS  int64             `json:"elapsed_ms"`
+	Results    []BatchFileResult `json:"results"`
+}
@@ -1,7 +1,9 @@
 package models
 
 import (
+	"strings"
 	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -12,12 +14,119 @@ type Document struct {
 	FileName      string             `bson:"file_name" json:"file_name"`
 	FileSize      int64              `bson:"file_size" json:"file_size"`
 	StoragePath   string             `bson:"storage_path" json:"storage_path"`
-	StorageURL    string             `bson:"storage_url" json:"storage_url"`
-	ExtractedText string             `bson:"extracted_text" json:"extracted_text,omitempty"`
+	ContentHash   string             `bson:"content_hash,omitempty" json:"content_hash,omitempty"`     // SHA-256 of the file, unique per tenant
+	ExtractedText string             `bson:"extracted_text,omitempty" json:"extracted_text,omitempty"` // legacy documents only; see Pages
+	Pages         []PDFPage          `bson:"pages,omitempty" json:"pages,omitempty"`
+	Metadata      PDFMetadata        `bson:"metadata" json:"metadata"`
 	Summary       string             `bson:"summary" json:"summary"`
 	UploadedAt    time.Time          `bson:"uploaded_at" json:"uploaded_at"`
 	IsDeleted     bool               `bson:"is_deleted" json:"is_deleted"`
 	DeletedAt     *time.Time         `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	UpdatedAt     *time.Time         `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+
+	// Set when the file had risky content and was accepted under the quarantine policy
+	Quarantine *Quarantine `bson:"quarantine,omitempty" json:"quarantine,omitempty"`
+
+	// Per-chunk summaries of long documents (map step of map-reduce summarization)
+	ChunkSummaries []ChunkSummary `bson:"chunk_summaries,omitempty" json:"chunk_summaries,omitempty"`
+
+	// Number of the version whose content the document currently holds;
+	// zero for documents stored before versions were recorded
+	CurrentVersion int `bson:"current_version,omitempty" json:"current_version,omitempty"`
+}
+
+// Duplicate handling modes for uploads whose content is already stored
+const (
+	DuplicateReject   = "reject"   // refuse the upload
+	DuplicateExisting = "existing" // return the existing document instead
+	DuplicateVersion  = "version"  // store the upload as a new version of the existing document
+)
+
+// DocumentVersion is one uploaded revision of a document, with its own
+// stored file, extracted text and summary
+type DocumentVersion struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	DocumentID     primitive.ObjectID `bson:"document_id" json:"document_id"`
+	Version        int                `bson:"version" json:"version"`
+	JobID          string             `bson:"job_id,omitempty" json:"job_id,omitempty"`
+	FileName       string             `bson:"file_name" json:"file_name"`
+	FileSize       int64              `bson:"file_size" json:"file_size"`
+	StoragePath    string             `bson:"storage_path" json:"storage_path"`
+	ContentHash    string             `bson:"content_hash,omitempty" json:"content_hash,omitempty"`
+	ExtractedText  string             `bson:"extracted_text,omitempty" json:"extracted_text,omitempty"`
+	Pages          []PDFPage          `bson:"pages,omitempty" json:"pages,omitempty"`
+	Metadata       PDFMetadata        `bson:"metadata" json:"metadata"`
+	Summary        string             `bson:"summary" json:"summary"`
+	ChunkSummaries []ChunkSummary     `bson:"chunk_summaries,omitempty" json:"chunk_summaries,omitempty"`
+	Quarantine     *Quarantine        `bson:"quarantine,omitempty" json:"quarantine,omitempty"`
+	UploadedAt     time.Time          `bson:"uploaded_at" json:"uploaded_at"`
+
+	// Set in listings for the version the document currently holds
+	Current bool `bson:"-" json:"current"`
+}
+
+// DocumentVersionList is every version of a document, oldest first
+type DocumentVersionList struct {
+	DocumentID     string            `json:"document_id"`
+	CurrentVersion int               `json:"current_version"`
+	Versions       []DocumentVersion `json:"versions"`
+}
+
+// PageBreak separates page texts when pages are joined into one string
+const PageBreak = "\f"
+
+// PDFPage holds the extracted text of one PDF page
+type PDFPage struct {
+	Number    int    `bson:"number" json:"number"` // 1-based
+	Text      string `bson:"text" json:"text"`
+	CharCount int    `bson:"char_count" json:"char_count"`
+}
+
+// PDFMetadata holds the PDF Info dictionary and page count
+type PDFMetadata struct {
+	Title          string     `bson:"title,omitempty" json:"title,omitempty"`
+	Author         string     `bson:"author,omitempty" json:"author,omitempty"`
+	Subject        string     `bson:"subject,omitempty" json:"subject,omitempty"`
+	Producer       string     `bson:"producer,omitempty" json:"producer,omitempty"`
+	CreationDate   *time.Time `bson:"creation_date,omitempty" json:"creation_date,omitempty"`
+	PageCount      int        `bson:"page_count" json:"page_count"`
+	ExtractionNote string     `bson:"extraction_note,omitempty" json:"extraction_note,omitempty"` // why no text was extracted
+}
+
+// PageText joins the page texts, separated by form feeds, for summarization
+// and legacy consumers. Falls back to ExtractedText for older documents.
+func (d *Document) PageText() string {
+	if len(d.Pages) == 0 {
+		return d.ExtractedText
+	}
+	texts := make([]string, len(d.Pages))
+	for i, page := range d.Pages {
+		texts[i] = page.Text
+	}
+	return strings.Join(texts, PageBreak)
+}
+
+// Quarantine records why a document was quarantined. Quarantined documents
+// are stored but not extracted, summarized or downloadable.
+type Quarantine struct {
+	Codes  []string `bson:"codes" json:"codes"`
+	Reason string   `bson:"reason" json:"reason"`
+}
+
+// ChunkSummary is the summary of one chunk of a long document
+type ChunkSummary struct {
+	Index     int    `bson:"index" json:"index"`
+	StartPage int    `bson:"start_page,omitempty" json:"start_page,omitempty"`
+	EndPage   int    `bson:"end_page,omitempty" json:"end_page,omitempty"`
+	Chars     int    `bson:"chars" json:"chars"`
+	Summary   string `bson:"summary" json:"summary"`
+}
+
+// DocumentUpdate holds the editable metadata fields of a document.
+// Nil fields are left unchanged.
+type DocumentUpdate struct {
+	FileName *string `json:"file_name"`
+	Summary  *string `json:"summary"`
 }
 
 // UploadResponse represents the API response for upload
@@ -25,5 +134,53 @@ type UploadResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // machine-readable error code
+}
+
+// SearchHit represents a ranked full-text search result
+type SearchHit struct {
+	Document `bson:",inline"`
+	Score    float64         `bson:"score" json:"score"`
+	Snippets []SearchSnippet `bson:"-" json:"snippets"`
+}
+
+// SearchSnippet is a highlighted excerpt of a matching field
+type SearchSnippet struct {
+	Field string `json:"field"`          // pages.text, extracted_text, summary or file_name
+	Page  int    `json:"page,omitempty"` // 1-based page number when known
+	Text  string `json:"text"`
+}
+
+// SearchResult represents the response of a tenant search
+type SearchResult struct {
+	Query  string      `json:"query"`
+	Hits   []SearchHit `json:"hits"`
+	Count  int         `json:"count"`
+	Offset int64       `json:"offset"`
+}
+
+// DocumentFilter holds the query options for listing a tenant's documents
+type DocumentFilter struct {
+	FileName     string     // case-insensitive substring match on file_name
+	Title        string     // case-insensitive substring match on metadata.title
+	Author       string     // case-insensitive substring match on metadata.author
+	MinPages     *int       // inclusive lower bound on metadata.page_count
+	MaxPages     *int       // inclusive upper bound on metadata.page_count
+	MinSize      *int64     // inclusive lower bound on file_size
+	MaxSize      *int64     // inclusive upper bound on file_size
+	UploadedFrom *time.Time // inclusive lower bound on uploaded_at
+	UploadedTo   *time.Time // inclusive upper bound on uploaded_at
+	IsDeleted    *bool      // nil returns both active and deleted documents
+	SortBy       string     // uploaded_at, file_name or file_size
+	SortOrder    string     // asc or desc
+	Cursor       string     // opaque cursor returned by the previous page
+	Limit        int64
 }
 
+// DocumentPage represents one page of a document listing
+type DocumentPage struct {
+	Documents  []Document `json:"documents"`
+	Count      int        `json:"count"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+	HasMore    bool       `json:"has_more"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Ingest job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Ingest pipeline step names, in execution order
+const (
+	StepUpload    = "upload"
+	StepExtract   = "extract"
+	StepSummarize = "summarize"
+	StepStore     = "store"
+)
+
+// Step statuses
+const (
+	StepStatusPending   = "pending"
+	StepStatusRunning   = "running"
+	StepStatusCompleted = "completed"
+	StepStatusFailed    = "failed"
+	StepStatusSkipped   = "skipped"
+)
+
+// Job represents an asynchronous ingest job stored in the master database
+type Job struct {
+	ID          string      `json:"id"`
+	TenantName  string      `json:"tenant_name"`
+	FileName    string      `json:"file_name"`
+	FileSize    int64       `json:"file_size"`
+	StoragePath string      `json:"storage_path"`
+	DocumentID  string      `json:"document_id"` // pre-allocated so retries insert idempotently
+	ContentHash string      `json:"content_hash,omitempty"`
+	NewVersion  bool        `json:"new_version,omitempty"` // adds a version to DocumentID instead of creating it
+	Quarantine  *Quarantine `json:"quarantine,omitempty"`
+	Status      string      `json:"status"` // queued, running, succeeded, failed
+	Steps       []JobStep   `json:"steps"`
+	Attempts    int         `json:"attempts"`
+	Error       string      `json:"error,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	StartedAt   *time.Time  `json:"started_at,omitempty"`
+	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
+	// TraceContext continues the trace of the upload when the job runs
+	TraceContext map[string]string `json:"-"`
+}
+
+// JobStep records the progress of one pipeline step
+type JobStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"` // pending, running, completed, failed
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+	Note       string     `json:"note,omitempty"` // e.g. why a step was skipped
+}
+
+// Step returns the named step, or nil if the job has no such step
+func (j *Job) Step(name string) *JobStep {
+	for i := range j.Steps {
+		if j.Steps[i].Name == name {
+			return &j.Steps[i]
+		}
+	}
+	return nil
+}
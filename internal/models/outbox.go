@@ -0,0 +1,19 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OutboxEvent is a change recorded in the outbox of the master database and
+// relayed to the event bus. It is published at least once; consumers drop
+// duplicates by ID and can check per-tenant order with Sequence.
+type OutboxEvent struct {
+	ID         int64           `json:"-"` // position in the outbox
+	EventID    string          `json:"id"`
+	Type       string          `json:"type"`
+	TenantName string          `json:"tenant_name"`
+	Sequence   int64           `json:"sequence"` // increases by one with every event of the tenant
+	Data       json.RawMessage `json:"data"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Inconsistencies found by reconciliation
+const (
+	IssueOrphanedObject          = "orphaned_object"           // stored file no document or pending job references
+	IssueDanglingDocument        = "dangling_document"         // active document whose file is missing
+	IssueTenantMissingDatabase   = "tenant_missing_database"   // tenant record without a database
+	IssueDatabaseMissingTenant   = "database_missing_tenant"   // tenant database without a record
+	IssueDeletedTenantDocuments  = "deleted_tenant_documents"  // active documents in a soft-deleted tenant
+	IssueRestoredTenantDocuments = "restored_tenant_documents" // documents still deleted with an active tenant
+	IssuePurgedTenantDatabase    = "purged_tenant_database"    // database left behind by a purged tenant
+	IssueCheckFailed             = "check_failed"              // the tenant could not be checked
+)
+
+// ReconcileIssue is one inconsistency between Postgres, MongoDB and MinIO
+type ReconcileIssue struct {
+	Kind       string `json:"kind"`
+	TenantName string `json:"tenant_name"`
+	Resource   string `json:"resource,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	Repaired   bool   `json:"repaired"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReconcileReport is the result of one reconciliation run
+type ReconcileReport struct {
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at"`
+	DryRun     bool             `json:"dry_run"`
+	Tenants    int              `json:"tenants_checked"`
+	Objects    int              `json:"objects_checked"`
+	Issues     []ReconcileIssue `json:"issues"`
+}
@@ -2,17 +2,77 @@ package models
 
 import "time"
 
+// Tenant lifecycle states
+const (
+	TenantStatusProvisioning = "provisioning" // tenant database is being created
+	TenantStatusActive       = "active"
+	TenantStatusFailed       = "failed" // provisioning failed; retried with backoff
+	TenantStatusDeleted      = "deleted"
+	TenantStatusPurging      = "purging" // data is being removed; can no longer be restored
+	TenantStatusPurged       = "purged"  // database and files removed; the row is kept for history
+)
+
 // Tenant represents a tenant in the master database
 type Tenant struct {
-	ID           int        `json:"id"`
+	ID                int                    `json:"id"`
+	TenantName        string                 `json:"tenant_name"`
+	DisplayName       string                 `json:"display_name,omitempty"`
+	DBHost            string                 `json:"db_host"`
+	DBPort            int                    `json:"db_port"`
+	DBName            string                 `json:"db_name"`
+	Status            string                 `json:"status"` // active, provisioning, failed, deleted, purging, purged
+	Settings          map[string]interface{} `json:"settings,omitempty"`
+	Quotas            TenantQuotas           `json:"quotas"`
+	ProvisionAttempts int                    `json:"provision_attempts"`
+	ProvisionError    string                 `json:"provision_error,omitempty"`
+	IsDeleted         bool                   `json:"is_deleted"`
+	DeletedAt         *time.Time             `json:"deleted_at,omitempty"`
+	PurgedAt          *time.Time             `json:"purged_at,omitempty"`
+	CreatedAt         time.Time              `json:"created_at"`
+	UpdatedAt         time.Time              `json:"updated_at"`
+}
+
+// TenantQuotas limits what a tenant may store. Zero means unlimited.
+type TenantQuotas struct {
+	MaxDocuments    int64 `json:"max_documents,omitempty"`
+	MaxStorageBytes int64 `json:"max_storage_bytes,omitempty"`
+	MaxFileSize     int64 `json:"max_file_size,omitempty"`
+}
+
+// TenantRequest is the body of POST /api/v1/tenants
+type TenantRequest struct {
+	TenantName  string                 `json:"tenant_name"`
+	DisplayName string                 `json:"display_name"`
+	Settings    map[string]interface{} `json:"settings"`
+	Quotas      TenantQuotas           `json:"quotas"`
+}
+
+// TenantUsage is what a tenant currently stores, including uploads still
+// being ingested
+type TenantUsage struct {
+	Documents    int64 `json:"documents"`
+	StorageBytes int64 `json:"storage_bytes"`
+}
+
+// TenantPurge describes the data removed, or that would be removed in a dry
+// run, when a soft-deleted tenant is purged
+type TenantPurge struct {
 	TenantName   string     `json:"tenant_name"`
-	DBHost       string     `json:"db_host"`
-	DBPort       int        `json:"db_port"`
 	DBName       string     `json:"db_name"`
-	Status       string     `json:"status"` // active, provisioning, failed
-	IsDeleted    bool       `json:"is_deleted"`
 	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	PurgeAfter   *time.Time `json:"purge_after,omitempty"`
+	Documents    int64      `json:"documents"`
+	Objects      int64      `json:"objects"`
+	StorageBytes int64      `json:"storage_bytes"`
+	DryRun       bool       `json:"dry_run"`
+	Purged       bool       `json:"purged"`
+	Error        string     `json:"error,omitempty"`
 }
 
+// PurgeReport is the result of one reaper pass
+type PurgeReport struct {
+	Retention string        `json:"retention"`
+	Cutoff    time.Time     `json:"cutoff"`
+	DryRun    bool          `json:"dry_run"`
+	Tenants   []TenantPurge `json:"tenants"`
+}
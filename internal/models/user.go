@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// User roles, from least to most privileged
+const (
+	RoleViewer        = "viewer"         // read documents, search and job status
+	RoleUploader      = "uploader"       // viewer + upload and edit document metadata
+	RoleTenantAdmin   = "tenant-admin"   // uploader + delete/restore documents, manage the tenant's users and keys
+	RolePlatformAdmin = "platform-admin" // every tenant, tenant management and admin keys
+)
+
+// roleRanks orders roles by privilege
+var roleRanks = map[string]int{
+	RoleViewer:        1,
+	RoleUploader:      2,
+	RoleTenantAdmin:   3,
+	RolePlatformAdmin: 4,
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants everything required grants.
+// Unknown roles grant nothing.
+func RoleAtLeast(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// User is a member of a tenant, or a platform admin with no tenant
+type User struct {
+	ID         int        `json:"id"`
+	TenantName string     `json:"tenant_name,omitempty"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name,omitempty"`
+	Role       string     `json:"role"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// UserRequest is the body of POST /api/v1/users
+type UserRequest struct {
+	Email      string `json:"email"`
+	Name       string `json:"name"`
+	Role       string `json:"role"`
+	TenantName string `json:"tenant_name"` // omitted for platform admins
+}
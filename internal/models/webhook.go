@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook events
+const (
+	EventDocumentIngested = "document.ingested"
+	EventDocumentFailed   = "document.failed"
+	EventDocumentDeleted  = "document.deleted"
+	EventTenantDeleted    = "tenant.deleted"
+	EventTenantRestored   = "tenant.restored"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	EventDocumentIngested,
+	EventDocumentFailed,
+	EventDocumentDeleted,
+	EventTenantDeleted,
+	EventTenantRestored,
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryStatusPending   = "pending"   // waiting for its first or next attempt
+	DeliveryStatusDelivered = "delivered" // the endpoint answered with a 2xx status
+	DeliveryStatusDead      = "dead"      // every attempt failed; only redelivered on request
+)
+
+// Webhook is an endpoint of a tenant subscribed to events. The signing
+// secret is never returned after creation.
+type Webhook struct {
+	ID         string    `json:"id"`
+	TenantName string    `json:"tenant_name"`
+	URL        string    `json:"url"`
+	Events     []string  `json:"events"`
+	Secret     string    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// CreatedWebhook is returned once when a webhook is created; the signing
+// secret cannot be retrieved again
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// WebhookRequest is the body of POST /api/v1/tenant/:name/webhooks
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"` // empty subscribes to every event
+}
+
+// WebhookEvent is the JSON body posted to webhook endpoints. ID identifies
+// the event across retries and endpoints, so receivers can deduplicate.
+type WebhookEvent struct {
+	ID         string                 `json:"id"`
+	Event      string                 `json:"event"`
+	TenantName string                 `json:"tenant_name"`
+	CreatedAt  time.Time              `json:"created_at"`
+	Data       map[string]interface{} `json:"data"`
+}
+
+// WebhookDelivery is one event queued for one webhook, with the outcome of
+// its latest attempt
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	TenantName     string          `json:"tenant_name"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	// TraceContext is the trace the event was raised in, sent with every
+	// attempt
+	TraceContext map[string]string `json:"-"`
+}
+
+// DeliveryFilter selects webhook deliveries of a tenant. Zero values match
+// everything.
+type DeliveryFilter struct {
+	TenantName string
+	WebhookID  string
+	Status     string
+	Limit      int
+}
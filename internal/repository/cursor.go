@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// documentCursor is the decoded form of a listing cursor: the sort key value
+// and ObjectID of the last document on the previous page
+type documentCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    string          `json:"id"`
+}
+
+// encodeCursor builds an opaque cursor pointing after the given document
+func encodeCursor(sortBy string, doc *models.Document) (string, error) {
+	var value interface{}
+	switch sortBy {
+	case "file_name":
+		value = doc.FileName
+	case "file_size":
+		value = doc.FileSize
+	default:
+		value = doc.UploadedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(documentCursor{Value: raw, ID: doc.ID.Hex()})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the sort key value and ObjectID stored in a cursor
+func decodeCursor(sortBy, cursor string) (interface{}, primitive.ObjectID, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	var c documentCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.ID)
+	if err != nil {
+		return nil, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	switch sortBy {
+	case "file_name":
+		var name string
+		if err := json.Unmarshal(c.Value, &name); err != nil {
+			return nil, id, fmt.Errorf("%w: expected file name", ErrInvalidCursor)
+		}
+		return name, id, nil
+	case "file_size":
+		var size int64
+		if err := json.Unmarshal(c.Value, &size); err != nil {
+			return nil, id, fmt.Errorf("%w: expected file size", ErrInvalidCursor)
+		}
+		return size, id, nil
+	default:
+		var ts string
+		if err := json.Unmarshal(c.Value, &ts); err != nil {
+			return nil, id, fmt.Errorf("%w: expected timestamp", ErrInvalidCursor)
+		}
+		uploadedAt, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return nil, id, fmt.Errorf("%w: expected timestamp", ErrInvalidCursor)
+		}
+		return uploadedAt, id, nil
+	}
+}
@@ -2,16 +2,25 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
+	"github.com/bacancy/droadmap/internal/metrics"
 	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrContentConflict is returned when making a version current would give two
+// documents of a tenant the same content
+var ErrContentConflict = errors.New("content conflict")
+
 // MongoRepository handles MongoDB operations for tenant databases
 type MongoRepository struct {
 	client *mongo.Client
@@ -22,7 +31,12 @@ func NewMongoRepository(connString string) (*MongoRepository, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connString))
+	// The pool monitor exports connection counts as metrics; the command
+	// monitor traces commands
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(connString).
+		SetPoolMonitor(metrics.MongoPoolMonitor()).
+		SetMonitor(tracing.MongoMonitor()))
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to MongoDB: %w", err)
 	}
@@ -45,9 +59,9 @@ func (r *MongoRepository) CreateTenantDatabase(ctx context.Context, tenantName s
 	// Create the documents collection
 	err := db.CreateCollection(ctx, "documents")
 	if err != nil {
-		// Collection might already exist, which is okay
-		// Check if it's a different error
-		if !mongo.IsDuplicateKeyError(err) && err.Error() != "Collection already exists" {
+		// Collection might already exist (e.g. when provisioning is retried),
+		// which is okay
+		if !isNamespaceExists(err) {
 			return fmt.Errorf("unable to create collection: %w", err)
 		}
 	}
@@ -62,10 +76,114 @@ func (r *MongoRepository) CreateTenantDatabase(ctx context.Context, tenantName s
 			Keys: bson.D{{Key: "file_name", Value: 1}},
 		},
 	})
+	if err != nil {
+		return err
+	}
+
+	if err := r.EnsureDocumentIndexes(ctx, tenantName); err != nil {
+		return err
+	}
+
+	return r.EnsureSearchIndex(ctx, tenantName)
+}
+
+// EnsureDocumentIndexes creates the unique content hash index on a tenant's
+// documents and the indexes of its document versions. It is idempotent and
+// backfills tenants created before deduplication existed.
+func (r *MongoRepository) EnsureDocumentIndexes(ctx context.Context, tenantName string) error {
+	db := r.client.Database(fmt.Sprintf("tenant_%s", tenantName))
+
+	_, err := db.Collection("documents").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "content_hash", Value: 1}},
+		Options: options.Index().
+			SetName("content_hash_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"content_hash": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create content hash index: %w", err)
+	}
+
+	_, err = db.Collection("document_versions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "document_id", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "content_hash", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "job_id", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"job_id": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create version indexes: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureSearchIndex creates the full-text index on a tenant's documents.
+// It is idempotent and is also used to backfill tenants created before search existed.
+func (r *MongoRepository) EnsureSearchIndex(ctx context.Context, tenantName string) error {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	// A collection allows one text index; replace indexes from older versions
+	for _, name := range legacySearchIndexes {
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+			return fmt.Errorf("unable to drop legacy search index: %w", err)
+		}
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "file_name", Value: "text"},
+			{Key: "metadata.title", Value: "text"},
+			{Key: "summary", Value: "text"},
+			{Key: "pages.text", Value: "text"},
+			{Key: "extracted_text", Value: "text"},
+		},
+		Options: options.Index().
+			SetName(searchIndexName).
+			SetWeights(bson.D{
+				{Key: "file_name", Value: 10},
+				{Key: "metadata.title", Value: 8},
+				{Key: "summary", Value: 5},
+				{Key: "pages.text", Value: 1},
+				{Key: "extracted_text", Value: 1},
+			}),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create search index: %w", err)
+	}
+
+	return nil
+}
+
+// searchIndexName is the current text index; legacySearchIndexes are dropped when found
+const searchIndexName = "document_text_search_v2"
 
-	return err
+var legacySearchIndexes = []string{"document_text_search"}
+
+// isIndexNotFound reports whether err is MongoDB's IndexNotFound (code 27)
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 27
+}
+
+// isNamespaceExists reports whether err is MongoDB's NamespaceExists (code 48)
+func isNamespaceExists(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 48
 }
 
+// textProjection excludes the large text fields from query results
+var textProjection = bson.M{"extracted_text": 0, "pages": 0}
+
 // InsertDocument inserts a document into the tenant's database
 func (r *MongoRepository) InsertDocument(ctx context.Context, tenantName string, doc *models.Document) error {
 	dbName := fmt.Sprintf("tenant_%s", tenantName)
@@ -80,6 +198,312 @@ func (r *MongoRepository) InsertDocument(ctx context.Context, tenantName string,
 	return nil
 }
 
+// FindDocumentByHash returns the document, active or soft-deleted, whose
+// file has the given content hash, without its text.
+// Returns mongo.ErrNoDocuments if there is none.
+func (r *MongoRepository) FindDocumentByHash(ctx context.Context, tenantName, contentHash string) (*models.Document, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	var doc models.Document
+	opts := options.FindOne().SetProjection(textProjection)
+	if err := collection.FindOne(ctx, bson.M{"content_hash": contentHash}, opts).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// FindVersionByHash returns a stored, non-quarantined version whose file has
+// the given content hash, with its text, so identical uploads can reuse its
+// extraction and summary. Returns mongo.ErrNoDocuments if there is none.
+func (r *MongoRepository) FindVersionByHash(ctx context.Context, tenantName, contentHash string) (*models.DocumentVersion, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("document_versions")
+
+	var version models.DocumentVersion
+	filter := bson.M{"content_hash": contentHash, "quarantine": nil}
+	if err := collection.FindOne(ctx, filter).Decode(&version); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// FindDocumentByName returns the most recently uploaded active document with
+// the given file name, without its text. The file name is a document's
+// logical identity: re-uploads under the same name become new versions.
+// Returns mongo.ErrNoDocuments if there is none.
+func (r *MongoRepository) FindDocumentByName(ctx context.Context, tenantName, fileName string) (*models.Document, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	var doc models.Document
+	filter := bson.M{"file_name": fileName, "is_deleted": bson.M{"$ne": true}}
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "uploaded_at", Value: -1}}).
+		SetProjection(textProjection)
+	if err := collection.FindOne(ctx, filter, opts).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// ListDocumentVersions returns the recorded versions of a document, oldest
+// first, without their text. Documents stored before versions were recorded
+// have none.
+func (r *MongoRepository) ListDocumentVersions(ctx context.Context, tenantName string, documentID primitive.ObjectID) ([]models.DocumentVersion, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("document_versions")
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: 1}}).
+		SetProjection(bson.M{"extracted_text": 0, "pages": 0, "chunk_summaries": 0})
+	cursor, err := collection.Find(ctx, bson.M{"document_id": documentID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list document versions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	versions := []models.DocumentVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("unable to decode document versions: %w", err)
+	}
+	return versions, nil
+}
+
+// GetDocumentVersion retrieves one version of a document. Extracted text and
+// pages are only loaded when includeText is true. Versions of documents stored
+// before versions were recorded are read from the document itself.
+// Returns mongo.ErrNoDocuments if missing.
+func (r *MongoRepository) GetDocumentVersion(ctx context.Context, tenantName string, documentID primitive.ObjectID, number int, includeText bool) (*models.DocumentVersion, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("document_versions")
+
+	opts := options.FindOne()
+	if !includeText {
+		opts.SetProjection(textProjection)
+	}
+
+	var version models.DocumentVersion
+	err := collection.FindOne(ctx, bson.M{"document_id": documentID, "version": number}, opts).Decode(&version)
+	if err != mongo.ErrNoDocuments {
+		if err != nil {
+			return nil, err
+		}
+		return &version, nil
+	}
+
+	// Only the document's own content exists for unversioned documents
+	recorded, err := collection.CountDocuments(ctx, bson.M{"document_id": documentID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to count document versions: %w", err)
+	}
+	if recorded > 0 || number != 1 {
+		return nil, mongo.ErrNoDocuments
+	}
+	doc, err := r.GetDocument(ctx, tenantName, documentID, includeText)
+	if err != nil {
+		return nil, err
+	}
+	return versionOf(doc), nil
+}
+
+// RollbackDocument makes an earlier version of an active document current
+// again and returns it. Returns mongo.ErrNoDocuments if the document is not
+// active or the version does not exist.
+func (r *MongoRepository) RollbackDocument(ctx context.Context, tenantName string, documentID primitive.ObjectID, number int) (*models.DocumentVersion, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	documents := r.client.Database(dbName).Collection("documents")
+
+	var doc models.Document
+	filter := bson.M{"_id": documentID, "is_deleted": bson.M{"$ne": true}}
+	if err := documents.FindOne(ctx, filter, options.FindOne().SetProjection(textProjection)).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	version, err := r.GetDocumentVersion(ctx, tenantName, documentID, number, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.setCurrentVersion(ctx, tenantName, version); err != nil {
+		return nil, err
+	}
+
+	// Keep the listing small, as for other reads without text
+	version.ExtractedText = ""
+	version.Pages = nil
+	version.ChunkSummaries = nil
+	return version, nil
+}
+
+// InsertDocumentVersion records a version of a document. A version already
+// recorded for the same job is not recorded again.
+func (r *MongoRepository) InsertDocumentVersion(ctx context.Context, tenantName string, version *models.DocumentVersion) error {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("document_versions")
+
+	version.ID = primitive.NewObjectID()
+	if _, err := collection.InsertOne(ctx, version); err != nil {
+		if mongo.IsDuplicateKeyError(err) && version.JobID != "" {
+			return nil
+		}
+		return fmt.Errorf("unable to insert document version: %w", err)
+	}
+	return nil
+}
+
+// AddDocumentVersion records version as the next version of its document and
+// makes it current. Version numbers are allocated here; retries of the same
+// job reuse the version already recorded for it. Documents stored before
+// versions existed get their content recorded as version 1 first.
+// Returns mongo.ErrNoDocuments if the document does not exist.
+func (r *MongoRepository) AddDocumentVersion(ctx context.Context, tenantName string, version *models.DocumentVersion) error {
+	db := r.client.Database(fmt.Sprintf("tenant_%s", tenantName))
+	documents := db.Collection("documents")
+	versions := db.Collection("document_versions")
+
+	var doc models.Document
+	if err := documents.FindOne(ctx, bson.M{"_id": version.DocumentID}).Decode(&doc); err != nil {
+		return err
+	}
+
+	const maxAttempts = 5
+	for attempt := 0; ; attempt++ {
+		var recorded models.DocumentVersion
+		err := versions.FindOne(ctx, bson.M{"job_id": version.JobID}).Decode(&recorded)
+		if err == nil {
+			*version = recorded
+			break
+		}
+		if err != mongo.ErrNoDocuments {
+			return fmt.Errorf("unable to check document version: %w", err)
+		}
+
+		latest, err := r.latestVersion(ctx, tenantName, &doc)
+		if err != nil {
+			return err
+		}
+
+		version.ID = primitive.NewObjectID()
+		version.Version = latest + 1
+		_, err = versions.InsertOne(ctx, version)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == maxAttempts-1 {
+			return fmt.Errorf("unable to insert document version: %w", err)
+		}
+		// Another version was added concurrently; take the next number
+	}
+
+	return r.setCurrentVersion(ctx, tenantName, version)
+}
+
+// latestVersion returns the highest recorded version of a document,
+// recording the document's own content as version 1 if it has none
+func (r *MongoRepository) latestVersion(ctx context.Context, tenantName string, doc *models.Document) (int, error) {
+	versions := r.client.Database(fmt.Sprintf("tenant_%s", tenantName)).Collection("document_versions")
+
+	var latest models.DocumentVersion
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}).SetProjection(bson.M{"version": 1})
+	err := versions.FindOne(ctx, bson.M{"document_id": doc.ID}, opts).Decode(&latest)
+	if err == nil {
+		return latest.Version, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return 0, fmt.Errorf("unable to find latest version: %w", err)
+	}
+
+	initial := versionOf(doc)
+	if _, err := versions.InsertOne(ctx, initial); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return 0, fmt.Errorf("unable to record initial version: %w", err)
+	}
+	return initial.Version, nil
+}
+
+// versionOf captures the current content of a document as a version
+func versionOf(doc *models.Document) *models.DocumentVersion {
+	number := doc.CurrentVersion
+	if number == 0 {
+		number = 1
+	}
+	return &models.DocumentVersion{
+		ID:             primitive.NewObjectID(),
+		DocumentID:     doc.ID,
+		Version:        number,
+		FileName:       doc.FileName,
+		FileSize:       doc.FileSize,
+		StoragePath:    doc.StoragePath,
+		ContentHash:    doc.ContentHash,
+		ExtractedText:  doc.ExtractedText,
+		Pages:          doc.Pages,
+		Metadata:       doc.Metadata,
+		Summary:        doc.Summary,
+		ChunkSummaries: doc.ChunkSummaries,
+		Quarantine:     doc.Quarantine,
+		UploadedAt:     doc.UploadedAt,
+	}
+}
+
+// setCurrentVersion copies a version's content onto its document
+func (r *MongoRepository) setCurrentVersion(ctx context.Context, tenantName string, version *models.DocumentVersion) error {
+	documents := r.client.Database(fmt.Sprintf("tenant_%s", tenantName)).Collection("documents")
+
+	set := bson.M{
+		"file_name":       version.FileName,
+		"file_size":       version.FileSize,
+		"storage_path":    version.StoragePath,
+		"pages":           version.Pages,
+		"metadata":        version.Metadata,
+		"summary":         version.Summary,
+		"current_version": version.Version,
+		"updated_at":      primitive.NewDateTimeFromTime(time.Now()),
+	}
+	unset := bson.M{}
+	optional := map[string]interface{}{
+		"content_hash":    version.ContentHash,
+		"extracted_text":  version.ExtractedText,
+		"chunk_summaries": version.ChunkSummaries,
+		"quarantine":      version.Quarantine,
+	}
+	for field, value := range optional {
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				unset[field] = ""
+				continue
+			}
+		case []models.ChunkSummary:
+			if len(v) == 0 {
+				unset[field] = ""
+				continue
+			}
+		case *models.Quarantine:
+			if v == nil {
+				unset[field] = ""
+				continue
+			}
+		}
+		set[field] = value
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := documents.UpdateOne(ctx, bson.M{"_id": version.DocumentID}, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return fmt.Errorf("%w: another document holds the content of this version", ErrContentConflict)
+		}
+		return fmt.Errorf("unable to update document: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
 // TenantDatabaseExists checks if a tenant database exists
 func (r *MongoRepository) TenantDatabaseExists(ctx context.Context, tenantName string) (bool, error) {
 	dbName := fmt.Sprintf("tenant_%s", tenantName)
@@ -93,6 +517,40 @@ func (r *MongoRepository) TenantDatabaseExists(ctx context.Context, tenantName s
 	return len(databases) > 0, nil
 }
 
+// DocumentUsage counts the documents of a tenant and their total size,
+// including soft-deleted documents whose files are still stored
+func (r *MongoRepository) DocumentUsage(ctx context.Context, tenantName string) (models.TenantUsage, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "documents", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "storage_bytes", Value: bson.D{{Key: "$sum", Value: "$file_size"}}},
+		}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return models.TenantUsage{}, fmt.Errorf("unable to compute usage: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var usage models.TenantUsage
+	if cursor.Next(ctx) {
+		var result struct {
+			Documents    int64 `bson:"documents"`
+			StorageBytes int64 `bson:"storage_bytes"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return models.TenantUsage{}, fmt.Errorf("unable to decode usage: %w", err)
+		}
+		usage = models.TenantUsage{Documents: result.Documents, StorageBytes: result.StorageBytes}
+	}
+
+	return usage, cursor.Err()
+}
+
 // CountDocuments counts active (non-deleted) documents in a tenant database
 func (r *MongoRepository) CountDocuments(ctx context.Context, tenantName string) (int64, error) {
 	dbName := fmt.Sprintf("tenant_%s", tenantName)
@@ -108,7 +566,9 @@ func (r *MongoRepository) CountDocuments(ctx context.Context, tenantName string)
 	return count, nil
 }
 
-// SoftDeleteAllDocuments marks all documents in a tenant database as deleted
+// SoftDeleteAllDocuments marks all documents in a tenant database as deleted.
+// They are flagged as deleted with the tenant so that restoring the tenant
+// leaves individually deleted documents alone.
 func (r *MongoRepository) SoftDeleteAllDocuments(ctx context.Context, tenantName string) (int64, error) {
 	dbName := fmt.Sprintf("tenant_%s", tenantName)
 	collection := r.client.Database(dbName).Collection("documents")
@@ -117,8 +577,9 @@ func (r *MongoRepository) SoftDeleteAllDocuments(ctx context.Context, tenantName
 	filter := bson.M{"is_deleted": bson.M{"$ne": true}} // Only update non-deleted docs
 	update := bson.M{
 		"$set": bson.M{
-			"is_deleted": true,
-			"deleted_at": primitive.NewDateTimeFromTime(time.Now()),
+			"is_deleted":          true,
+			"deleted_at":          primitive.NewDateTimeFromTime(time.Now()),
+			"deleted_with_tenant": true,
 		},
 	}
 	
@@ -130,30 +591,404 @@ func (r *MongoRepository) SoftDeleteAllDocuments(ctx context.Context, tenantName
 	return result.ModifiedCount, nil
 }
 
-// RestoreAllDocuments restores all soft-deleted documents in a tenant database
+// RestoreAllDocuments restores the documents deleted with the tenant.
+// Documents deleted before the flag existed are restored as well.
 func (r *MongoRepository) RestoreAllDocuments(ctx context.Context, tenantName string) (int64, error) {
+	return r.restoreDocuments(ctx, tenantName, bson.M{"is_deleted": true, "deleted_with_tenant": bson.M{"$ne": false}})
+}
+
+// RestoreDocumentsDeletedWithTenant restores only documents flagged as
+// deleted with the tenant, for repairing a tenant restore that was cut short
+func (r *MongoRepository) RestoreDocumentsDeletedWithTenant(ctx context.Context, tenantName string) (int64, error) {
+	return r.restoreDocuments(ctx, tenantName, bson.M{"is_deleted": true, "deleted_with_tenant": true})
+}
+
+// CountDocumentsDeletedWithTenant counts documents flagged as deleted with
+// the tenant
+func (r *MongoRepository) CountDocumentsDeletedWithTenant(ctx context.Context, tenantName string) (int64, error) {
 	dbName := fmt.Sprintf("tenant_%s", tenantName)
 	collection := r.client.Database(dbName).Collection("documents")
-	
-	// Update all documents to restore them
-	filter := bson.M{"is_deleted": true}
+
+	count, err := collection.CountDocuments(ctx, bson.M{"is_deleted": true, "deleted_with_tenant": true})
+	if err != nil {
+		return 0, fmt.Errorf("unable to count documents: %w", err)
+	}
+	return count, nil
+}
+
+func (r *MongoRepository) restoreDocuments(ctx context.Context, tenantName string, filter bson.M) (int64, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
 	update := bson.M{
 		"$set": bson.M{
 			"is_deleted": false,
 		},
 		"$unset": bson.M{
-			"deleted_at": "",
+			"deleted_at":          "",
+			"deleted_with_tenant": "",
 		},
 	}
-	
+
 	result, err := collection.UpdateMany(ctx, filter, update)
 	if err != nil {
 		return 0, fmt.Errorf("unable to restore documents: %w", err)
 	}
-	
+
 	return result.ModifiedCount, nil
 }
 
+// ListDocumentFiles returns the ID, storage path and deletion state of every
+// document of a tenant, including soft-deleted ones
+func (r *MongoRepository) ListDocumentFiles(ctx context.Context, tenantName string) ([]models.Document, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	opts := options.Find().SetProjection(bson.M{"_id": 1, "storage_path": 1, "is_deleted": 1})
+	cursor, err := collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var docs []models.Document
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("unable to decode documents: %w", err)
+	}
+	return docs, nil
+}
+
+// ListVersionFiles returns the storage paths of every recorded document
+// version of a tenant
+func (r *MongoRepository) ListVersionFiles(ctx context.Context, tenantName string) ([]string, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("document_versions")
+
+	paths, err := collection.Distinct(ctx, "storage_path", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list document versions: %w", err)
+	}
+
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if p, ok := path.(string); ok && p != "" {
+			files = append(files, p)
+		}
+	}
+	return files, nil
+}
+
+// FileReferenced reports whether a document or any document version of a
+// tenant refers to the stored file at storagePath
+func (r *MongoRepository) FileReferenced(ctx context.Context, tenantName, storagePath string) (bool, error) {
+	db := r.client.Database(fmt.Sprintf("tenant_%s", tenantName))
+	opts := options.Count().SetLimit(1)
+
+	for _, name := range []string{"document_versions", "documents"} {
+		count, err := db.Collection(name).CountDocuments(ctx, bson.M{"storage_path": storagePath}, opts)
+		if err != nil {
+			return false, fmt.Errorf("unable to look up file references: %w", err)
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListTenantDatabases returns the names of tenants that have a database
+func (r *MongoRepository) ListTenantDatabases(ctx context.Context) ([]string, error) {
+	names, err := r.client.ListDatabaseNames(ctx, bson.M{"name": bson.M{"$regex": "^tenant_"}})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list databases: %w", err)
+	}
+
+	tenants := make([]string, 0, len(names))
+	for _, name := range names {
+		tenants = append(tenants, strings.TrimPrefix(name, "tenant_"))
+	}
+	return tenants, nil
+}
+
+// ListDocuments returns one page of a tenant's documents using keyset pagination.
+// Extracted text and pages are excluded from the results to keep listings small.
+func (r *MongoRepository) ListDocuments(ctx context.Context, tenantName string, filter models.DocumentFilter) (*models.DocumentPage, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	sortBy := filter.SortBy
+	if sortBy == "" {
+		sortBy = "uploaded_at"
+	}
+	direction := -1
+	if filter.SortOrder == "asc" {
+		direction = 1
+	}
+
+	// tenant_name leads the query so the tenant_name/uploaded_at index is used
+	conditions := bson.A{bson.M{"tenant_name": tenantName}}
+
+	if filter.FileName != "" {
+		conditions = append(conditions, bson.M{"file_name": primitive.Regex{
+			Pattern: regexp.QuoteMeta(filter.FileName),
+			Options: "i",
+		}})
+	}
+
+	if filter.Title != "" {
+		conditions = append(conditions, bson.M{"metadata.title": primitive.Regex{
+			Pattern: regexp.QuoteMeta(filter.Title),
+			Options: "i",
+		}})
+	}
+
+	if filter.Author != "" {
+		conditions = append(conditions, bson.M{"metadata.author": primitive.Regex{
+			Pattern: regexp.QuoteMeta(filter.Author),
+			Options: "i",
+		}})
+	}
+
+	pageRange := bson.M{}
+	if filter.MinPages != nil {
+		pageRange["$gte"] = *filter.MinPages
+	}
+	if filter.MaxPages != nil {
+		pageRange["$lte"] = *filter.MaxPages
+	}
+	if len(pageRange) > 0 {
+		conditions = append(conditions, bson.M{"metadata.page_count": pageRange})
+	}
+
+	sizeRange := bson.M{}
+	if filter.MinSize != nil {
+		sizeRange["$gte"] = *filter.MinSize
+	}
+	if filter.MaxSize != nil {
+		sizeRange["$lte"] = *filter.MaxSize
+	}
+	if len(sizeRange) > 0 {
+		conditions = append(conditions, bson.M{"file_size": sizeRange})
+	}
+
+	dateRange := bson.M{}
+	if filter.UploadedFrom != nil {
+		dateRange["$gte"] = *filter.UploadedFrom
+	}
+	if filter.UploadedTo != nil {
+		dateRange["$lte"] = *filter.UploadedTo
+	}
+	if len(dateRange) > 0 {
+		conditions = append(conditions, bson.M{"uploaded_at": dateRange})
+	}
+
+	if filter.IsDeleted != nil {
+		if *filter.IsDeleted {
+			conditions = append(conditions, bson.M{"is_deleted": true})
+		} else {
+			conditions = append(conditions, bson.M{"is_deleted": bson.M{"$ne": true}})
+		}
+	}
+
+	// Resume after the last document of the previous page
+	if filter.Cursor != "" {
+		value, id, err := decodeCursor(sortBy, filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		op := "$lt"
+		if direction == 1 {
+			op = "$gt"
+		}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{sortBy: bson.M{op: value}},
+			bson.M{sortBy: value, "_id": bson.M{op: id}},
+		}})
+	}
+
+	// Fetch one extra document to know whether another page exists
+	opts := options.Find().
+		SetSort(bson.D{{Key: sortBy, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(filter.Limit + 1).
+		SetProjection(textProjection)
+
+	cursor, err := collection.Find(ctx, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	documents := []models.Document{}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("unable to decode documents: %w", err)
+	}
+
+	page := &models.DocumentPage{}
+	if int64(len(documents)) > filter.Limit {
+		documents = documents[:filter.Limit]
+		page.HasMore = true
+	}
+	page.Documents = documents
+	page.Count = len(documents)
+
+	if page.HasMore {
+		next, err := encodeCursor(sortBy, &documents[len(documents)-1])
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode cursor: %w", err)
+		}
+		page.NextCursor = next
+	}
+
+	return page, nil
+}
+
+// GetDocument retrieves a single document by ID. Extracted text and pages are only
+// loaded when includeText is true. Returns mongo.ErrNoDocuments if missing.
+func (r *MongoRepository) GetDocument(ctx context.Context, tenantName string, id primitive.ObjectID, includeText bool) (*models.Document, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	opts := options.FindOne()
+	if !includeText {
+		opts.SetProjection(textProjection)
+	}
+
+	var doc models.Document
+	err := collection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// UpdateDocumentMetadata updates the editable fields of an active document and
+// returns the document as it was before and after the update.
+// Returns mongo.ErrNoDocuments if no active document matches.
+func (r *MongoRepository) UpdateDocumentMetadata(ctx context.Context, tenantName string, id primitive.ObjectID, update models.DocumentUpdate) (*models.Document, *models.Document, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	fields := bson.M{"updated_at": primitive.NewDateTimeFromTime(now)}
+	if update.FileName != nil {
+		fields["file_name"] = *update.FileName
+	}
+	if update.Summary != nil {
+		fields["summary"] = *update.Summary
+	}
+
+	// Return the previous version so callers can record what changed
+	filter := bson.M{"_id": id, "is_deleted": bson.M{"$ne": true}}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.Before).
+		SetProjection(textProjection)
+
+	var before models.Document
+	err := collection.FindOneAndUpdate(ctx, filter, bson.M{"$set": fields}, opts).Decode(&before)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after := before
+	if update.FileName != nil {
+		after.FileName = *update.FileName
+	}
+	if update.Summary != nil {
+		after.Summary = *update.Summary
+	}
+	after.UpdatedAt = &now
+
+	return &before, &after, nil
+}
+
+// SoftDeleteDocument marks a single active document as deleted.
+// Returns mongo.ErrNoDocuments if no active document matches.
+func (r *MongoRepository) SoftDeleteDocument(ctx context.Context, tenantName string, id primitive.ObjectID) error {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	filter := bson.M{"_id": id, "is_deleted": bson.M{"$ne": true}}
+	update := bson.M{
+		"$set": bson.M{
+			"is_deleted":          true,
+			"deleted_at":          primitive.NewDateTimeFromTime(time.Now()),
+			"deleted_with_tenant": false,
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("unable to soft delete document: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// RestoreDocument restores a single soft-deleted document.
+// Returns mongo.ErrNoDocuments if no deleted document matches.
+func (r *MongoRepository) RestoreDocument(ctx context.Context, tenantName string, id primitive.ObjectID) error {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	filter := bson.M{"_id": id, "is_deleted": true}
+	update := bson.M{
+		"$set": bson.M{
+			"is_deleted": false,
+		},
+		"$unset": bson.M{
+			"deleted_at":          "",
+			"deleted_with_tenant": "",
+		},
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("unable to restore document: %w", err)
+	}
+
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// SearchDocuments runs a full-text query over a tenant's active documents,
+// ranked by text score
+func (r *MongoRepository) SearchDocuments(ctx context.Context, tenantName, query string, limit, offset int64) ([]models.SearchHit, error) {
+	dbName := fmt.Sprintf("tenant_%s", tenantName)
+	collection := r.client.Database(dbName).Collection("documents")
+
+	filter := bson.M{
+		"$text":      bson.M{"$search": query},
+		"is_deleted": bson.M{"$ne": true},
+	}
+	score := bson.M{"$meta": "textScore"}
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "uploaded_at", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to search documents: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	hits := []models.SearchHit{}
+	if err := cursor.All(ctx, &hits); err != nil {
+		return nil, fmt.Errorf("unable to decode search results: %w", err)
+	}
+
+	return hits, nil
+}
+
 // DropDatabase drops a tenant database completely (for hard delete)
 func (r *MongoRepository) DropDatabase(ctx context.Context, tenantName string) error {
 	dbName := fmt.Sprintf("tenant_%s", tenantName)
@@ -2,9 +2,14 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -15,7 +20,14 @@ type PostgresRepository struct {
 
 // NewPostgresRepository creates a new PostgreSQL repository
 func NewPostgresRepository(connString string) (*PostgresRepository, error) {
-	pool, err := pgxpool.New(context.Background(), connString)
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse connection string: %w", err)
+	}
+	// Queries made within a trace get a span
+	config.ConnConfig.Tracer = tracing.PostgresTracer{}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
@@ -28,6 +40,11 @@ func NewPostgresRepository(connString string) (*PostgresRepository, error) {
 	return &PostgresRepository{pool: pool}, nil
 }
 
+// PoolStat returns a snapshot of the connection pool statistics
+func (r *PostgresRepository) PoolStat() *pgxpool.Stat {
+	return r.pool.Stat()
+}
+
 // InitSchema creates the necessary tables if they don't exist
 func (r *PostgresRepository) InitSchema(ctx context.Context) error {
 	query := `
@@ -46,101 +63,272 @@ func (r *PostgresRepository) InitSchema(ctx context.Context) error {
 
 	CREATE INDEX IF NOT EXISTS idx_tenant_name ON tenants(tenant_name);
 	CREATE INDEX IF NOT EXISTS idx_is_deleted ON tenants(is_deleted);
+
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS display_name VARCHAR(255);
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS settings JSONB NOT NULL DEFAULT '{}';
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS quotas JSONB NOT NULL DEFAULT '{}';
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS provision_attempts INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS provision_error TEXT;
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP;
+
+	CREATE TABLE IF NOT EXISTS ingest_jobs (
+		id UUID PRIMARY KEY,
+		tenant_name VARCHAR(255) NOT NULL,
+		file_name VARCHAR(1024) NOT NULL,
+		file_size BIGINT NOT NULL,
+		storage_path VARCHAR(1024) NOT NULL,
+		document_id VARCHAR(24) NOT NULL,
+		status VARCHAR(50) NOT NULL DEFAULT 'queued',
+		steps JSONB NOT NULL DEFAULT '[]',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		run_after TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		locked_until TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP
+	);
+
+	ALTER TABLE ingest_jobs ADD COLUMN IF NOT EXISTS quarantine JSONB;
+	ALTER TABLE ingest_jobs ADD COLUMN IF NOT EXISTS content_hash CHAR(64);
+	ALTER TABLE ingest_jobs ADD COLUMN IF NOT EXISTS new_version BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE ingest_jobs ADD COLUMN IF NOT EXISTS trace_context JSONB;
+
+	CREATE INDEX IF NOT EXISTS idx_ingest_jobs_status ON ingest_jobs(status, run_after);
+	CREATE INDEX IF NOT EXISTS idx_ingest_jobs_tenant ON ingest_jobs(tenant_name, created_at);
+	CREATE INDEX IF NOT EXISTS idx_ingest_jobs_content_hash ON ingest_jobs(tenant_name, content_hash);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id UUID PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		scope VARCHAR(50) NOT NULL,
+		tenant_name VARCHAR(255),
+		key_prefix VARCHAR(32) NOT NULL,
+		key_hash CHAR(64) UNIQUE NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		last_used_at TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys(tenant_name);
+
+	CREATE TABLE IF NOT EXISTS users (
+		id SERIAL PRIMARY KEY,
+		tenant_id INTEGER REFERENCES tenants(id),
+		email VARCHAR(255) UNIQUE NOT NULL,
+		name VARCHAR(255),
+		role VARCHAR(50) DEFAULT 'viewer',
+		disabled_at TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Platform admins belong to no tenant
+	ALTER TABLE users ALTER COLUMN tenant_id DROP NOT NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMP;
+
+	CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+	CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id);
+
+	ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id);
+
+	CREATE TABLE IF NOT EXISTS audit_logs (
+		id BIGSERIAL PRIMARY KEY,
+		tenant_name VARCHAR(255),
+		action VARCHAR(255),
+		resource_type VARCHAR(100),
+		resource_id VARCHAR(255),
+		actor VARCHAR(255),
+		actor_role VARCHAR(50),
+		api_key_id VARCHAR(36),
+		request_id VARCHAR(128),
+		diff JSONB,
+		details JSONB,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Older schemas created audit_logs keyed by tenant_id only
+	ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS tenant_name VARCHAR(255);
+	ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS actor VARCHAR(255);
+	ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS actor_role VARCHAR(50);
+	ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS api_key_id VARCHAR(36);
+	ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS request_id VARCHAR(128);
+	ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS diff JSONB;
+
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_tenant_name ON audit_logs(tenant_name, id);
+	CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
+
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id UUID PRIMARY KEY,
+		tenant_name VARCHAR(255) NOT NULL,
+		url VARCHAR(2048) NOT NULL,
+		events TEXT[] NOT NULL,
+		secret VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhooks_tenant ON webhooks(tenant_name);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id UUID PRIMARY KEY,
+		webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+		tenant_name VARCHAR(255) NOT NULL,
+		event VARCHAR(100) NOT NULL,
+		payload JSONB NOT NULL,
+		status VARCHAR(50) NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		locked_until TIMESTAMP,
+		last_status_code INTEGER,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		delivered_at TIMESTAMP
+	);
+
+	ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS trace_context JSONB;
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_tenant ON webhook_deliveries(tenant_name, status, created_at);
+
+	CREATE TABLE IF NOT EXISTS outbox_events (
+		id BIGSERIAL PRIMARY KEY,
+		event_id UUID UNIQUE NOT NULL,
+		tenant_name VARCHAR(255) NOT NULL,
+		sequence BIGINT NOT NULL,
+		event_type VARCHAR(100) NOT NULL,
+		data JSONB NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		published_at TIMESTAMP,
+		UNIQUE (tenant_name, sequence)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished ON outbox_events(id) WHERE published_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_outbox_events_published_at ON outbox_events(published_at);
+
+	-- Last event sequence number per tenant; its row lock orders a tenant's
+	-- events by commit
+	CREATE TABLE IF NOT EXISTS outbox_sequences (
+		tenant_name VARCHAR(255) PRIMARY KEY,
+		last_sequence BIGINT NOT NULL
+	);
 	`
 	_, err := r.pool.Exec(ctx, query)
 	return err
 }
 
-// GetTenantByName retrieves a tenant by name (excluding soft-deleted)
-func (r *PostgresRepository) GetTenantByName(ctx context.Context, tenantName string) (*models.Tenant, error) {
-	query := `
-		SELECT id, tenant_name, db_host, db_port, db_name, status, is_deleted, deleted_at, created_at, updated_at
-		FROM tenants
-		WHERE tenant_name = $1 AND is_deleted = FALSE
-	`
+// tenantColumns lists the tenants columns scanned by scanTenant
+const tenantColumns = `id, tenant_name, COALESCE(display_name, ''), db_host, db_port, db_name, status,
+	settings, quotas, provision_attempts, COALESCE(provision_error, ''), is_deleted, deleted_at, purged_at, created_at, updated_at`
 
+// scanTenant scans a row selected with tenantColumns
+func scanTenant(row pgx.Row) (*models.Tenant, error) {
 	var tenant models.Tenant
-	err := r.pool.QueryRow(ctx, query, tenantName).Scan(
+	err := row.Scan(
 		&tenant.ID,
 		&tenant.TenantName,
+		&tenant.DisplayName,
 		&tenant.DBHost,
 		&tenant.DBPort,
 		&tenant.DBName,
 		&tenant.Status,
+		&tenant.Settings,
+		&tenant.Quotas,
+		&tenant.ProvisionAttempts,
+		&tenant.ProvisionError,
 		&tenant.IsDeleted,
 		&tenant.DeletedAt,
+		&tenant.PurgedAt,
 		&tenant.CreatedAt,
 		&tenant.UpdatedAt,
 	)
-
 	if err != nil {
 		return nil, err
 	}
-
 	return &tenant, nil
 }
 
+// GetTenantByName retrieves a tenant by name (excluding soft-deleted)
+func (r *PostgresRepository) GetTenantByName(ctx context.Context, tenantName string) (*models.Tenant, error) {
+	query := `SELECT ` + tenantColumns + ` FROM tenants WHERE tenant_name = $1 AND is_deleted = FALSE`
+	return scanTenant(r.pool.QueryRow(ctx, query, tenantName))
+}
+
 // CreateTenant creates a new tenant record
 func (r *PostgresRepository) CreateTenant(ctx context.Context, tenant *models.Tenant) error {
 	query := `
-		INSERT INTO tenants (tenant_name, db_host, db_port, db_name, status)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO tenants (tenant_name, display_name, db_host, db_port, db_name, status, settings, quotas)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5, $6, COALESCE($7, '{}'::jsonb), $8)
 		RETURNING id, created_at, updated_at
 	`
 
 	return r.pool.QueryRow(ctx, query,
 		tenant.TenantName,
+		tenant.DisplayName,
 		tenant.DBHost,
 		tenant.DBPort,
 		tenant.DBName,
 		tenant.Status,
+		tenant.Settings,
+		tenant.Quotas,
 	).Scan(&tenant.ID, &tenant.CreatedAt, &tenant.UpdatedAt)
 }
 
-// DeleteTenant performs soft delete on a tenant record
-func (r *PostgresRepository) DeleteTenant(ctx context.Context, tenantName string) error {
+// DeleteTenant performs soft delete on a tenant record, recording events in
+// the outbox in the same transaction
+func (r *PostgresRepository) DeleteTenant(ctx context.Context, tenantName string, events ...*models.OutboxEvent) error {
 	query := `
 		UPDATE tenants 
 		SET is_deleted = TRUE, deleted_at = NOW(), status = 'deleted'
 		WHERE tenant_name = $1 AND is_deleted = FALSE
 	`
 	
-	result, err := r.pool.Exec(ctx, query, tenantName)
-	if err != nil {
-		return fmt.Errorf("unable to delete tenant: %w", err)
-	}
-	
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("tenant '%s' not found or already deleted", tenantName)
-	}
-	
-	return nil
+	return r.withOutbox(ctx, events, func(q querier) error {
+		result, err := q.Exec(ctx, query, tenantName)
+		if err != nil {
+			return fmt.Errorf("unable to delete tenant: %w", err)
+		}
+
+		if result.RowsAffected() == 0 {
+			return fmt.Errorf("tenant '%s' not found or already deleted", tenantName)
+		}
+
+		return nil
+	})
 }
 
-// RestoreTenant restores a soft-deleted tenant
-func (r *PostgresRepository) RestoreTenant(ctx context.Context, tenantName string) error {
+// RestoreTenant restores a soft-deleted tenant, recording events in the
+// outbox in the same transaction
+func (r *PostgresRepository) RestoreTenant(ctx context.Context, tenantName string, events ...*models.OutboxEvent) error {
 	query := `
 		UPDATE tenants 
 		SET is_deleted = FALSE, deleted_at = NULL, status = 'active'
-		WHERE tenant_name = $1 AND is_deleted = TRUE
+		WHERE tenant_name = $1 AND is_deleted = TRUE AND status = 'deleted'
 	`
 	
-	result, err := r.pool.Exec(ctx, query, tenantName)
-	if err != nil {
-		return fmt.Errorf("unable to restore tenant: %w", err)
-	}
-	
-	if result.RowsAffected() == 0 {
-		return fmt.Errorf("tenant '%s' not found or not deleted", tenantName)
-	}
-	
-	return nil
+	return r.withOutbox(ctx, events, func(q querier) error {
+		result, err := q.Exec(ctx, query, tenantName)
+		if err != nil {
+			return fmt.Errorf("unable to restore tenant: %w", err)
+		}
+
+		if result.RowsAffected() == 0 {
+			return fmt.Errorf("tenant '%s' not found, not deleted or already purged", tenantName)
+		}
+
+		return nil
+	})
 }
 
 // ListTenants retrieves all active (non-deleted) tenants
 func (r *PostgresRepository) ListTenants(ctx context.Context) ([]models.Tenant, error) {
 	query := `
-		SELECT id, tenant_name, db_host, db_port, db_name, status, is_deleted, deleted_at, created_at, updated_at
+		SELECT `+tenantColumns+`
 		FROM tenants
 		WHERE is_deleted = FALSE
 		ORDER BY created_at DESC
@@ -154,34 +342,22 @@ func (r *PostgresRepository) ListTenants(ctx context.Context) ([]models.Tenant,
 	
 	var tenants []models.Tenant
 	for rows.Next() {
-		var tenant models.Tenant
-		err := rows.Scan(
-			&tenant.ID,
-			&tenant.TenantName,
-			&tenant.DBHost,
-			&tenant.DBPort,
-			&tenant.DBName,
-			&tenant.Status,
-			&tenant.IsDeleted,
-			&tenant.DeletedAt,
-			&tenant.CreatedAt,
-			&tenant.UpdatedAt,
-		)
+		tenant, err := scanTenant(rows)
 		if err != nil {
 			return nil, fmt.Errorf("unable to scan tenant: %w", err)
 		}
-		tenants = append(tenants, tenant)
+		tenants = append(tenants, *tenant)
 	}
 	
 	return tenants, nil
 }
 
-// ListDeletedTenants retrieves all soft-deleted tenants
+// ListDeletedTenants retrieves all soft-deleted tenants that are not purged
 func (r *PostgresRepository) ListDeletedTenants(ctx context.Context) ([]models.Tenant, error) {
 	query := `
-		SELECT id, tenant_name, db_host, db_port, db_name, status, is_deleted, deleted_at, created_at, updated_at
+		SELECT `+tenantColumns+`
 		FROM tenants
-		WHERE is_deleted = TRUE
+		WHERE is_deleted = TRUE AND status <> 'purged'
 		ORDER BY deleted_at DESC
 	`
 	
@@ -193,28 +369,1086 @@ func (r *PostgresRepository) ListDeletedTenants(ctx context.Context) ([]models.T
 	
 	var tenants []models.Tenant
 	for rows.Next() {
-		var tenant models.Tenant
-		err := rows.Scan(
-			&tenant.ID,
-			&tenant.TenantName,
-			&tenant.DBHost,
-			&tenant.DBPort,
-			&tenant.DBName,
-			&tenant.Status,
-			&tenant.IsDeleted,
-			&tenant.DeletedAt,
-			&tenant.CreatedAt,
-			&tenant.UpdatedAt,
-		)
+		tenant, err := scanTenant(rows)
 		if err != nil {
 			return nil, fmt.Errorf("unable to scan tenant: %w", err)
 		}
-		tenants = append(tenants, tenant)
+		tenants = append(tenants, *tenant)
 	}
 	
 	return tenants, nil
 }
 
+// SetTenantStatus records the outcome of provisioning. A failed status
+// counts an attempt and keeps the error for the retry loop.
+func (r *PostgresRepository) SetTenantStatus(ctx context.Context, tenantName, status, provisionErr string) error {
+	query := `
+		UPDATE tenants
+		SET status = $2,
+			provision_error = NULLIF($3, ''),
+			provision_attempts = provision_attempts + CASE WHEN $2 = 'failed' THEN 1 ELSE 0 END,
+			updated_at = NOW()
+		WHERE tenant_name = $1 AND is_deleted = FALSE
+	`
+
+	_, err := r.pool.Exec(ctx, query, tenantName, status, provisionErr)
+	return err
+}
+
+// ClaimTenantProvisioning moves a failed tenant, or one stuck in
+// provisioning for longer than stuckAfter, to provisioning so only one caller
+// retries it. Returns pgx.ErrNoRows if the tenant is in neither state.
+func (r *PostgresRepository) ClaimTenantProvisioning(ctx context.Context, tenantName string, stuckAfter time.Duration) (*models.Tenant, error) {
+	query := `
+		UPDATE tenants
+		SET status = 'provisioning', updated_at = NOW()
+		WHERE tenant_name = $1 AND is_deleted = FALSE AND (
+			status = 'failed'
+			OR (status = 'provisioning' AND updated_at <= NOW() - ($2 * INTERVAL '1 second'))
+		)
+		RETURNING ` + tenantColumns
+
+	return scanTenant(r.pool.QueryRow(ctx, query, tenantName, int64(stuckAfter.Seconds())))
+}
+
+// ListTenantsToProvision returns failed tenants whose backoff has elapsed and
+// tenants stuck in provisioning (e.g. after a crash), up to maxAttempts
+func (r *PostgresRepository) ListTenantsToProvision(ctx context.Context, maxAttempts int, stuckAfter time.Duration) ([]string, error) {
+	query := `
+		SELECT tenant_name FROM tenants
+		WHERE is_deleted = FALSE AND provision_attempts < $1 AND (
+			(status = 'failed' AND updated_at <= NOW() - (provision_attempts * provision_attempts * 30) * INTERVAL '1 second')
+			OR (status = 'provisioning' AND updated_at <= NOW() - ($2 * INTERVAL '1 second'))
+		)
+		ORDER BY updated_at
+	`
+
+	rows, err := r.pool.Query(ctx, query, maxAttempts, int64(stuckAfter.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tenants to provision: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("unable to scan tenant: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// ListAllTenants retrieves every tenant row, including soft-deleted and
+// purged tenants
+func (r *PostgresRepository) ListAllTenants(ctx context.Context) ([]models.Tenant, error) {
+	query := `SELECT ` + tenantColumns + ` FROM tenants ORDER BY id`
+
+	rows, err := r.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []models.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan tenant: %w", err)
+		}
+		tenants = append(tenants, *tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+// GetDeletedTenant retrieves a soft-deleted tenant that is not yet purged
+func (r *PostgresRepository) GetDeletedTenant(ctx context.Context, tenantName string) (*models.Tenant, error) {
+	query := `SELECT ` + tenantColumns + ` FROM tenants
+		WHERE tenant_name = $1 AND is_deleted = TRUE AND status IN ('deleted', 'purging')`
+	return scanTenant(r.pool.QueryRow(ctx, query, tenantName))
+}
+
+// ListTenantsDeletedBefore returns tenants soft-deleted before cutoff that
+// are not yet purged, including purges that were interrupted
+func (r *PostgresRepository) ListTenantsDeletedBefore(ctx context.Context, cutoff time.Time) ([]models.Tenant, error) {
+	query := `
+		SELECT ` + tenantColumns + `
+		FROM tenants
+		WHERE is_deleted = TRUE AND status IN ('deleted', 'purging') AND deleted_at < $1
+		ORDER BY deleted_at
+	`
+
+	rows, err := r.pool.Query(ctx, query, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tenants to purge: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []models.Tenant
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan tenant: %w", err)
+		}
+		tenants = append(tenants, *tenant)
+	}
+
+	return tenants, rows.Err()
+}
+
+// ClaimTenantPurge moves a soft-deleted tenant to purging, after which it can
+// no longer be restored. A tenant already purging is claimed again so an
+// interrupted purge can finish. Returns pgx.ErrNoRows if the tenant is not
+// soft-deleted.
+func (r *PostgresRepository) ClaimTenantPurge(ctx context.Context, tenantName string) (*models.Tenant, error) {
+	query := `
+		UPDATE tenants
+		SET status = 'purging', updated_at = NOW()
+		WHERE tenant_name = $1 AND is_deleted = TRUE AND status IN ('deleted', 'purging')
+		RETURNING ` + tenantColumns
+
+	return scanTenant(r.pool.QueryRow(ctx, query, tenantName))
+}
+
+// MarkTenantPurged marks a tenant as purged, revokes its API keys and removes
+// its ingest jobs and webhooks. The tenant row is kept, so the name stays reserved.
+func (r *PostgresRepository) MarkTenantPurged(ctx context.Context, tenantName string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE tenants
+		SET status = 'purged', purged_at = NOW(), updated_at = NOW()
+		WHERE tenant_name = $1 AND status = 'purging'
+	`, tenantName)
+	if err != nil {
+		return fmt.Errorf("unable to mark tenant purged: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE tenant_name = $1 AND revoked_at IS NULL`, tenantName)
+	if err != nil {
+		return fmt.Errorf("unable to revoke tenant API keys: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM ingest_jobs WHERE tenant_name = $1`, tenantName)
+	if err != nil {
+		return fmt.Errorf("unable to delete tenant jobs: %w", err)
+	}
+
+	// Deliveries are removed with their webhooks
+	_, err = tx.Exec(ctx, `DELETE FROM webhooks WHERE tenant_name = $1`, tenantName)
+	if err != nil {
+		return fmt.Errorf("unable to delete tenant webhooks: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PendingJobUsage counts uploads of a tenant that are accepted but not yet
+// stored as documents
+func (r *PostgresRepository) PendingJobUsage(ctx context.Context, tenantName string) (models.TenantUsage, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(SUM(file_size), 0)
+		FROM ingest_jobs
+		WHERE tenant_name = $1 AND status IN ('queued', 'running')
+	`
+
+	var usage models.TenantUsage
+	err := r.pool.QueryRow(ctx, query, tenantName).Scan(&usage.Documents, &usage.StorageBytes)
+	return usage, err
+}
+
+// PendingJobStoragePaths returns the stored files of a tenant's queued and
+// running jobs, which have no document yet
+func (r *PostgresRepository) PendingJobStoragePaths(ctx context.Context, tenantName string) ([]string, error) {
+	query := `SELECT storage_path FROM ingest_jobs WHERE tenant_name = $1 AND status IN ('queued', 'running')`
+
+	rows, err := r.pool.Query(ctx, query, tenantName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list pending jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("unable to scan job: %w", err)
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// jobColumns lists the ingest_jobs columns scanned by scanJob
+const jobColumns = `id, tenant_name, file_name, file_size, storage_path, document_id, COALESCE(content_hash, ''),
+	new_version, quarantine, status, steps, attempts, COALESCE(error, ''), created_at, updated_at, started_at, finished_at,
+	trace_context`
+
+// scanJob scans a row selected with jobColumns
+func scanJob(row pgx.Row) (*models.Job, error) {
+	var job models.Job
+	err := row.Scan(
+		&job.ID,
+		&job.TenantName,
+		&job.FileName,
+		&job.FileSize,
+		&job.StoragePath,
+		&job.DocumentID,
+		&job.ContentHash,
+		&job.NewVersion,
+		&job.Quarantine,
+		&job.Status,
+		&job.Steps,
+		&job.Attempts,
+		&job.Error,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+		&job.TraceContext,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CreateJob inserts a new queued ingest job
+func (r *PostgresRepository) CreateJob(ctx context.Context, job *models.Job) error {
+	query := `
+		INSERT INTO ingest_jobs (id, tenant_name, file_name, file_size, storage_path, document_id, content_hash,
+			new_version, quarantine, status, steps, trace_context)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10, $11, $12)
+		RETURNING created_at, updated_at
+	`
+
+	return r.pool.QueryRow(ctx, query,
+		job.ID,
+		job.TenantName,
+		job.FileName,
+		job.FileSize,
+		job.StoragePath,
+		job.DocumentID,
+		job.ContentHash,
+		job.NewVersion,
+		job.Quarantine,
+		job.Status,
+		job.Steps,
+		job.TraceContext,
+	).Scan(&job.CreatedAt, &job.UpdatedAt)
+}
+
+// GetJob retrieves an ingest job by ID
+func (r *PostgresRepository) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM ingest_jobs WHERE id = $1`
+	return scanJob(r.pool.QueryRow(ctx, query, id))
+}
+
+// FindPendingJobByHash returns a queued or running job of a tenant for a
+// file with the given content hash. Returns pgx.ErrNoRows if there is none.
+func (r *PostgresRepository) FindPendingJobByHash(ctx context.Context, tenantName, contentHash string) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM ingest_jobs
+		WHERE tenant_name = $1 AND content_hash = $2 AND status IN ('queued', 'running')
+		ORDER BY created_at
+		LIMIT 1`
+	return scanJob(r.pool.QueryRow(ctx, query, tenantName, contentHash))
+}
+
+// ClaimNextJob atomically picks the oldest runnable job and leases it to the
+// caller. Running jobs whose lease expired (e.g. after a crash) are picked up
+// again. Returns pgx.ErrNoRows when no job is runnable.
+func (r *PostgresRepository) ClaimNextJob(ctx context.Context, lease time.Duration) (*models.Job, error) {
+	query := `
+		UPDATE ingest_jobs
+		SET status = 'running',
+			attempts = attempts + 1,
+			locked_until = NOW() + ($1 * INTERVAL '1 second'),
+			started_at = COALESCE(started_at, NOW()),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM ingest_jobs
+			WHERE (status = 'queued' AND run_after <= NOW())
+				OR (status = 'running' AND locked_until < NOW())
+			ORDER BY created_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + jobColumns
+
+	return scanJob(r.pool.QueryRow(ctx, query, int64(lease.Seconds())))
+}
+
+// UpdateJob persists the progress of a job claimed by the caller and the
+// document and stored file it ends up with, recording events in the outbox in the same
+// transaction. A running job's lease is extended by lease; a non-zero
+// retryAfter requeues the job to run again after that delay. Returns
+// pgx.ErrNoRows, recording nothing, if the job was claimed again since the
+// caller's claim (its attempts moved on) or is no longer running.
+func (r *PostgresRepository) UpdateJob(ctx context.Context, job *models.Job, lease, retryAfter time.Duration, events ...*models.OutboxEvent) error {
+	query := `
+		UPDATE ingest_jobs
+		SET status = $2,
+			steps = $3,
+			error = NULLIF($4, ''),
+			finished_at = $5,
+			run_after = NOW() + ($6 * INTERVAL '1 second'),
+			locked_until = CASE WHEN $2 = 'running' THEN NOW() + ($10 * INTERVAL '1 second') ELSE NULL END,
+			document_id = $7,
+			new_version = $8,
+			storage_path = $11,
+			updated_at = NOW()
+		WHERE id = $1 AND attempts = $9 AND status = 'running'
+		RETURNING updated_at
+	`
+
+	return r.withOutbox(ctx, events, func(q querier) error {
+		return q.QueryRow(ctx, query,
+			job.ID,
+			job.Status,
+			job.Steps,
+			job.Error,
+			job.FinishedAt,
+			int64(retryAfter.Seconds()),
+			job.DocumentID,
+			job.NewVersion,
+			job.Attempts,
+			int64(lease.Seconds()),
+			job.StoragePath,
+		).Scan(&job.UpdatedAt)
+	})
+}
+
+// ExtendJobLease extends the lease of a running job claimed by the caller,
+// identified by its attempt. Returns pgx.ErrNoRows if the job was claimed
+// again or is no longer running.
+func (r *PostgresRepository) ExtendJobLease(ctx context.Context, id string, attempt int, lease time.Duration) error {
+	query := `
+		UPDATE ingest_jobs
+		SET locked_until = NOW() + ($3 * INTERVAL '1 second')
+		WHERE id = $1 AND attempts = $2 AND status = 'running'
+	`
+
+	tag, err := r.pool.Exec(ctx, query, id, attempt, int64(lease.Seconds()))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
+
+// IsUniqueViolation reports whether err is a unique constraint violation
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// apiKeyColumns lists the api_keys columns scanned by scanAPIKey, including
+// the role of the key's user
+const apiKeyColumns = `id, name, scope, COALESCE(tenant_name, ''), user_id,
+	COALESCE((SELECT role FROM users WHERE users.id = api_keys.user_id), ''),
+	key_prefix, created_at, last_used_at, revoked_at`
+
+// scanAPIKey scans a row selected with apiKeyColumns
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	var userRole string
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.Scope,
+		&key.TenantName,
+		&key.UserID,
+		&userRole,
+		&key.Prefix,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case userRole != "":
+		key.Role = userRole
+	case key.Scope == models.ScopeAdmin:
+		key.Role = models.RolePlatformAdmin
+	default:
+		key.Role = models.RoleTenantAdmin
+	}
+	return &key, nil
+}
+
+// CreateAPIKey inserts an API key with the hash of its secret. An existing
+// key with the same hash is left untouched.
+func (r *PostgresRepository) CreateAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	query := `
+		INSERT INTO api_keys (id, name, scope, tenant_name, user_id, key_prefix, key_hash)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+		ON CONFLICT (key_hash) DO NOTHING
+	`
+
+	_, err := r.pool.Exec(ctx, query, key.ID, key.Name, key.Scope, key.TenantName, key.UserID, key.Prefix, keyHash)
+	return err
+}
+
+// AuthenticateAPIKey looks up an active key by hash and records its use.
+// Returns pgx.ErrNoRows for unknown or revoked keys and keys of disabled users.
+func (r *PostgresRepository) AuthenticateAPIKey(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE key_hash = $1 AND revoked_at IS NULL
+			AND (user_id IS NULL OR EXISTS (
+				SELECT 1 FROM users WHERE users.id = api_keys.user_id AND users.disabled_at IS NULL
+			))
+		RETURNING ` + apiKeyColumns
+
+	return scanAPIKey(r.pool.QueryRow(ctx, query, keyHash))
+}
+
+// GetAPIKey retrieves an API key by ID
+func (r *PostgresRepository) GetAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = $1`
+	return scanAPIKey(r.pool.QueryRow(ctx, query, id))
+}
+
+// ListAPIKeys lists API keys, optionally limited to one tenant
+func (r *PostgresRepository) ListAPIKeys(ctx context.Context, tenantName string, includeRevoked bool) ([]models.APIKey, error) {
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE ($1 = '' OR tenant_name = $1) AND ($2 OR revoked_at IS NULL)
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.pool.Query(ctx, query, tenantName, includeRevoked)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan API key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes an active key. Returns pgx.ErrNoRows if the key does
+// not exist or is already revoked.
+func (r *PostgresRepository) RevokeAPIKey(ctx context.Context, id string) (*models.APIKey, error) {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING ` + apiKeyColumns
+
+	return scanAPIKey(r.pool.QueryRow(ctx, query, id))
+}
+
+// RotateAPIKey revokes an active key and inserts its replacement in one
+// transaction, so a key is never left without a successor. Returns
+// pgx.ErrNoRows if the old key does not exist or is already revoked.
+func (r *PostgresRepository) RotateAPIKey(ctx context.Context, oldID string, key *models.APIKey, keyHash string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var revokedID string
+	err = tx.QueryRow(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING id
+	`, oldID).Scan(&revokedID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO api_keys (id, name, scope, tenant_name, user_id, key_prefix, key_hash)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)
+		RETURNING created_at
+	`, key.ID, key.Name, key.Scope, key.TenantName, key.UserID, key.Prefix, keyHash).Scan(&key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("unable to insert API key: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// userColumns selects users joined with their tenant, as scanned by scanUser
+const userColumns = `u.id, COALESCE(t.tenant_name, ''), u.email, COALESCE(u.name, ''), u.role,
+	u.disabled_at, u.created_at, u.updated_at
+	FROM users u LEFT JOIN tenants t ON t.id = u.tenant_id`
+
+// scanUser scans a row selected with userColumns
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.TenantName,
+		&user.Email,
+		&user.Name,
+		&user.Role,
+		&user.DisabledAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateUser inserts a user, resolving its tenant by name. An empty tenant
+// name creates a user without a tenant.
+func (r *PostgresRepository) CreateUser(ctx context.Context, user *models.User) error {
+	query := `
+		INSERT INTO users (tenant_id, email, name, role)
+		VALUES ((SELECT id FROM tenants WHERE tenant_name = $1 AND is_deleted = FALSE), $2, NULLIF($3, ''), $4)
+		RETURNING id, created_at, updated_at
+	`
+
+	return r.pool.QueryRow(ctx, query,
+		user.TenantName,
+		user.Email,
+		user.Name,
+		user.Role,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+}
+
+// GetUser retrieves a user by ID
+func (r *PostgresRepository) GetUser(ctx context.Context, id int) (*models.User, error) {
+	query := `SELECT ` + userColumns + ` WHERE u.id = $1`
+	return scanUser(r.pool.QueryRow(ctx, query, id))
+}
+
+// ListUsers lists users, optionally limited to one tenant
+func (r *PostgresRepository) ListUsers(ctx context.Context, tenantName string) ([]models.User, error) {
+	query := `SELECT ` + userColumns + `
+		WHERE ($1 = '' OR t.tenant_name = $1)
+		ORDER BY u.created_at DESC`
+
+	rows, err := r.pool.Query(ctx, query, tenantName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan user: %w", err)
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// DisableUser disables an enabled user. Returns pgx.ErrNoRows if the user
+// does not exist or is already disabled.
+func (r *PostgresRepository) DisableUser(ctx context.Context, id int) error {
+	query := `
+		UPDATE users
+		SET disabled_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND disabled_at IS NULL
+		RETURNING id
+	`
+
+	return r.pool.QueryRow(ctx, query, id).Scan(&id)
+}
+
+// InsertAuditLog appends an entry to the audit log
+func (r *PostgresRepository) InsertAuditLog(ctx context.Context, entry *models.AuditLog) error {
+	query := `
+		INSERT INTO audit_logs (tenant_name, action, resource_type, resource_id, actor, actor_role, api_key_id, request_id, diff, details)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), $9, $10)
+		RETURNING id, created_at
+	`
+
+	return r.pool.QueryRow(ctx, query,
+		entry.TenantName,
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.Actor,
+		entry.ActorRole,
+		entry.APIKeyID,
+		entry.RequestID,
+		entry.Diff,
+		entry.Details,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// ScanAuditLogs calls fn for every audit entry matching filter, newest first.
+// A zero filter.Limit returns all matching entries.
+func (r *PostgresRepository) ScanAuditLogs(ctx context.Context, filter models.AuditFilter, fn func(*models.AuditLog) error) error {
+	query := `
+		SELECT id, COALESCE(tenant_name, ''), COALESCE(action, ''), COALESCE(resource_type, ''),
+			COALESCE(resource_id, ''), COALESCE(actor, ''), COALESCE(actor_role, ''),
+			COALESCE(api_key_id, ''), COALESCE(request_id, ''), diff, details, created_at
+		FROM audit_logs
+		WHERE ($1 = '' OR tenant_name = $1)
+			AND ($2 = '' OR action = $2)
+			AND ($3 = '' OR actor = $3)
+			AND ($4::timestamp IS NULL OR created_at >= $4)
+			AND ($5::timestamp IS NULL OR created_at < $5)
+			AND ($6 = 0 OR id < $6)
+		ORDER BY id DESC
+	`
+	args := []interface{}{filter.TenantName, filter.Action, filter.Actor, filter.From, filter.To, filter.BeforeID}
+	if filter.Limit > 0 {
+		query += ` LIMIT $7`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("unable to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditLog
+		err := rows.Scan(
+			&entry.ID,
+			&entry.TenantName,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&entry.Actor,
+			&entry.ActorRole,
+			&entry.APIKeyID,
+			&entry.RequestID,
+			&entry.Diff,
+			&entry.Details,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to scan audit log: %w", err)
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// webhookColumns lists the webhooks columns scanned by scanWebhook
+const webhookColumns = `id, tenant_name, url, events, secret, created_at, updated_at`
+
+// scanWebhook scans a row selected with webhookColumns
+func scanWebhook(row pgx.Row) (*models.Webhook, error) {
+	var webhook models.Webhook
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.TenantName,
+		&webhook.URL,
+		&webhook.Events,
+		&webhook.Secret,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// CreateWebhook inserts a webhook with its signing secret
+func (r *PostgresRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	query := `
+		INSERT INTO webhooks (id, tenant_name, url, events, secret)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, updated_at
+	`
+
+	return r.pool.QueryRow(ctx, query,
+		webhook.ID,
+		webhook.TenantName,
+		webhook.URL,
+		webhook.Events,
+		webhook.Secret,
+	).Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+}
+
+// GetWebhook retrieves a webhook, including its secret, by ID
+func (r *PostgresRepository) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = $1`
+	return scanWebhook(r.pool.QueryRow(ctx, query, id))
+}
+
+// ListWebhooks lists the webhooks of a tenant, oldest first
+func (r *PostgresRepository) ListWebhooks(ctx context.Context, tenantName string) ([]models.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE tenant_name = $1 ORDER BY created_at`
+
+	rows, err := r.pool.Query(ctx, query, tenantName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes a webhook of a tenant along with its deliveries.
+// Returns pgx.ErrNoRows if the tenant has no such webhook.
+func (r *PostgresRepository) DeleteWebhook(ctx context.Context, tenantName, id string) error {
+	query := `DELETE FROM webhooks WHERE id = $1 AND tenant_name = $2 RETURNING id`
+	return r.pool.QueryRow(ctx, query, id, tenantName).Scan(&id)
+}
+
+// QueueWebhookDeliveries queues an event for every webhook of the tenant
+// subscribed to it and returns the number of deliveries queued. traceContext
+// is sent along with every delivery.
+func (r *PostgresRepository) QueueWebhookDeliveries(ctx context.Context, tenantName, event string, payload []byte, traceContext map[string]string) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, tenant_name, event, payload, trace_context)
+		SELECT gen_random_uuid(), id, tenant_name, $2, $3, $4
+		FROM webhooks
+		WHERE tenant_name = $1 AND $2 = ANY(events)
+	`
+
+	tag, err := r.pool.Exec(ctx, query, tenantName, event, payload, traceContext)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// deliveryColumns lists the webhook_deliveries columns scanned by scanDelivery
+const deliveryColumns = `id, webhook_id, tenant_name, event, payload, status, attempts, next_attempt_at,
+	COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, updated_at, delivered_at, trace_context`
+
+// scanDelivery scans a row selected with deliveryColumns
+func scanDelivery(row pgx.Row) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.TenantName,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&delivery.DeliveredAt,
+		&delivery.TraceContext,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ClaimNextDelivery atomically picks the oldest due delivery and leases it
+// to the caller, counting the attempt. Deliveries whose lease expired (e.g.
+// after a crash) are picked up again. Returns pgx.ErrNoRows when none is due.
+func (r *PostgresRepository) ClaimNextDelivery(ctx context.Context, lease time.Duration) (*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+			locked_until = NOW() + ($1 * INTERVAL '1 second'),
+			updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY next_attempt_at
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING ` + deliveryColumns
+
+	return scanDelivery(r.pool.QueryRow(ctx, query, int64(lease.Seconds())))
+}
+
+// UpdateDelivery records the outcome of a delivery attempt and releases its
+// lease
+func (r *PostgresRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2,
+			next_attempt_at = $3,
+			last_status_code = NULLIF($4, 0),
+			last_error = NULLIF($5, ''),
+			delivered_at = $6,
+			locked_until = NULL,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	return r.pool.QueryRow(ctx, query,
+		delivery.ID,
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.LastStatusCode,
+		delivery.LastError,
+		delivery.DeliveredAt,
+	).Scan(&delivery.UpdatedAt)
+}
+
+// GetDelivery retrieves a delivery of a tenant by ID
+func (r *PostgresRepository) GetDelivery(ctx context.Context, tenantName, id string) (*models.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = $1 AND tenant_name = $2`
+	return scanDelivery(r.pool.QueryRow(ctx, query, id, tenantName))
+}
+
+// ListDeliveries lists the deliveries of a tenant matching filter, newest
+// first
+func (r *PostgresRepository) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT ` + deliveryColumns + `
+		FROM webhook_deliveries
+		WHERE tenant_name = $1
+			AND ($2 = '' OR webhook_id::text = $2)
+			AND ($3 = '' OR status = $3)
+		ORDER BY created_at DESC
+		LIMIT $4
+	`
+
+	rows, err := r.pool.Query(ctx, query, filter.TenantName, filter.WebhookID, filter.Status, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// RequeueDelivery queues a dead or delivered delivery of a tenant to be sent
+// again with a fresh set of attempts. Returns pgx.ErrNoRows if the tenant
+// has no such delivery or it is still pending.
+func (r *PostgresRepository) RequeueDelivery(ctx context.Context, tenantName, id string) (*models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending',
+			attempts = 0,
+			next_attempt_at = NOW(),
+			delivered_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND tenant_name = $2 AND status <> 'pending'
+		RETURNING ` + deliveryColumns
+
+	return scanDelivery(r.pool.QueryRow(ctx, query, id, tenantName))
+}
+
+// querier runs queries on the pool or in a transaction
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// withOutbox runs fn and records events in the outbox in one transaction, so
+// an event exists exactly when its change is committed. Without events fn
+// runs directly on the pool.
+func (r *PostgresRepository) withOutbox(ctx context.Context, events []*models.OutboxEvent, fn func(q querier) error) error {
+	if len(events) == 0 {
+		return fn(r.pool)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := insertOutboxEvents(ctx, tx, events); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// insertOutboxEvents appends events to the outbox, numbering them per
+// tenant. The sequence row stays locked until the transaction ends, so a
+// tenant's events commit in sequence order.
+func insertOutboxEvents(ctx context.Context, q querier, events []*models.OutboxEvent) error {
+	for _, event := range events {
+		err := q.QueryRow(ctx, `
+			INSERT INTO outbox_sequences (tenant_name, last_sequence)
+			VALUES ($1, 1)
+			ON CONFLICT (tenant_name) DO UPDATE SET last_sequence = outbox_sequences.last_sequence + 1
+			RETURNING last_sequence
+		`, event.TenantName).Scan(&event.Sequence)
+		if err != nil {
+			return fmt.Errorf("unable to number outbox event: %w", err)
+		}
+
+		err = q.QueryRow(ctx, `
+			INSERT INTO outbox_events (event_id, tenant_name, sequence, event_type, data)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at
+		`, event.EventID, event.TenantName, event.Sequence, event.Type, event.Data).Scan(&event.ID, &event.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("unable to record outbox event: %w", err)
+		}
+	}
+	return nil
+}
+
+// AppendOutboxEvents records events for changes made outside the master
+// database, e.g. to tenant documents
+func (r *PostgresRepository) AppendOutboxEvents(ctx context.Context, events ...*models.OutboxEvent) error {
+	return r.withOutbox(ctx, events, func(querier) error { return nil })
+}
+
+// outboxRelayLock is the advisory lock held by the instance relaying the
+// outbox, so only one instance publishes at a time
+const outboxRelayLock = 0x6f7574626f78
+
+// RelayOutboxEvents passes up to limit unpublished events to publish in
+// outbox order and marks those it accepts as published. Once publish fails
+// for an event, later events of the same tenant are held back until the next
+// run, preserving per-tenant order. A non-empty tenants limits the relay to
+// those tenants' events. Returns the number published, or zero when another
+// instance is relaying.
+//
+// No transaction is open while events are published: the relaying instance
+// holds a session-level advisory lock on a dedicated connection instead, and
+// the outcome is recorded in a short transaction afterwards.
+func (r *PostgresRepository) RelayOutboxEvents(ctx context.Context, limit int, tenants []string, publish func(*models.OutboxEvent) error) (int, error) {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, outboxRelayLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("unable to lock outbox: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+	defer func() {
+		// A connection that cannot be unlocked is closed, releasing the lock,
+		// rather than returned to the pool still holding it
+		if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, outboxRelayLock); err != nil {
+			conn.Conn().Close(context.WithoutCancel(ctx))
+		}
+	}()
+
+	rows, err := conn.Query(ctx, `
+		SELECT id, event_id, tenant_name, sequence, event_type, data, created_at
+		FROM outbox_events
+		WHERE published_at IS NULL AND (COALESCE(cardinality($2::text[]), 0) = 0 OR tenant_name = ANY($2))
+		ORDER BY id
+		LIMIT $1
+	`, limit, tenants)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read outbox: %w", err)
+	}
+
+	var events []*models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		err := rows.Scan(&event.ID, &event.EventID, &event.TenantName, &event.Sequence, &event.Type, &event.Data, &event.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("unable to scan outbox event: %w", err)
+		}
+		events = append(events, &event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("unable to read outbox: %w", err)
+	}
+
+	held := make(map[string]bool)
+	var published []int64
+	failures := make(map[int64]string)
+	for _, event := range events {
+		if held[event.TenantName] {
+			continue
+		}
+		if err := publish(event); err != nil {
+			held[event.TenantName] = true
+			failures[event.ID] = err.Error()
+			continue
+		}
+		published = append(published, event.ID)
+	}
+
+	// Events published but not marked, e.g. on a crash before this commits,
+	// are published again by the next run
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for id, message := range failures {
+		_, err := tx.Exec(ctx, `UPDATE outbox_events SET attempts = attempts + 1, last_error = $2 WHERE id = $1`, id, message)
+		if err != nil {
+			return 0, fmt.Errorf("unable to record publish failure: %w", err)
+		}
+	}
+	if len(published) > 0 {
+		_, err = tx.Exec(ctx, `UPDATE outbox_events SET published_at = NOW(), last_error = NULL WHERE id = ANY($1)`, published)
+		if err != nil {
+			return 0, fmt.Errorf("unable to mark outbox events published: %w", err)
+		}
+	}
+
+	return len(published), tx.Commit(ctx)
+}
+
+// DeletePublishedOutboxEvents removes events published before cutoff
+func (r *PostgresRepository) DeletePublishedOutboxEvents(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM outbox_events WHERE published_at < $1`, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("unable to prune outbox: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
 // Close closes the database connection pool
 func (r *PostgresRepository) Close() {
 	r.pool.Close()
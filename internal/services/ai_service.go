@@ -1,157 +1,217 @@
 package services
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
+	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/bacancy/droadmap/internal/metrics"
+	"github.com/bacancy/droadmap/internal/models"
+)
+
+const (
+	defaultSummaryChunkChars  = 12000
+	defaultSummaryConcurrency = 3
+	// maxReduceRounds bounds how often combined chunk summaries are re-chunked
+	maxReduceRounds = 3
 )
 
-// AIService handles AI summarization using Google Gemini API
+// AIConfig holds the summarization provider settings
+type AIConfig struct {
+	Provider        string            // default provider; empty picks gemini if a key is set, else fallback
+	TenantProviders map[string]string // per-tenant provider overrides
+
+	GeminiAPIKey string
+	GeminiModel  string
+
+	OpenAIAPIKey  string
+	OpenAIBaseURL string // OpenAI-compatible endpoint, e.g. a local Ollama server
+	OpenAIModel   string
+
+	ChunkChars  int // maximum characters per summarizer call
+	Concurrency int // concurrent chunk summaries per document
+}
+
+// AIService selects a summarization provider per tenant and falls back to
+// extractive summaries when the provider fails
 type AIService struct {
-	apiKey string
-	client *http.Client
+	providers       map[string]Summarizer
+	defaultProvider string
+	tenantProviders map[string]string
+	fallback        Summarizer
+	chunkChars      int
+	concurrency     int
 }
 
-// NewAIService creates a new AI service with Google Gemini
-func NewAIService(geminiAPIKey string) *AIService {
+// NewAIService creates a new AI service with the providers available in cfg
+func NewAIService(cfg AIConfig) (*AIService, error) {
+	fallback := NewExtractiveSummarizer()
 	service := &AIService{
-		apiKey: geminiAPIKey,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
+		providers: map[string]Summarizer{
+			ProviderMock:     NewMockSummarizer(),
+			ProviderFallback: fallback,
 		},
+		tenantProviders: cfg.TenantProviders,
+		fallback:        fallback,
+		chunkChars:      cfg.ChunkChars,
+		concurrency:     cfg.Concurrency,
 	}
-
-	if geminiAPIKey != "" {
-		fmt.Println("✓ AI Provider: Google Gemini 2.5 Flash (Free Tier)")
-	} else {
-		fmt.Println("✓ AI Provider: Fallback (Text Extraction)")
+	if service.chunkChars <= 0 {
+		service.chunkChars = defaultSummaryChunkChars
+	}
+	if service.concurrency <= 0 {
+		service.concurrency = defaultSummaryConcurrency
 	}
 
-	return service
-}
-
-// GenerateSummary generates a summary of the given text using Google Gemini API
-func (s *AIService) GenerateSummary(ctx context.Context, text string) (string, error) {
-	if s.apiKey == "" {
-		return s.generateFallbackSummary(text), nil
+	if cfg.GeminiAPIKey != "" {
+		service.providers[ProviderGemini] = NewGeminiSummarizer(cfg.GeminiAPIKey, cfg.GeminiModel)
+	}
+	// Local OpenAI-compatible servers usually need no key, only a base URL
+	if cfg.OpenAIAPIKey != "" || cfg.OpenAIBaseURL != "" {
+		service.providers[ProviderOpenAI] = NewOpenAISummarizer(cfg.OpenAIAPIKey, cfg.OpenAIBaseURL, cfg.OpenAIModel)
 	}
 
-	maxChars := 30000
-	if len(text) > maxChars {
-		text = text[:maxChars] + "..."
+	service.defaultProvider = cfg.Provider
+	if service.defaultProvider == "" {
+		service.defaultProvider = ProviderFallback
+		if cfg.GeminiAPIKey != "" {
+			service.defaultProvider = ProviderGemini
+		}
 	}
 
-	summary, err := s.callGeminiAPI(ctx, text)
-	if err != nil {
-		fmt.Printf("⚠ Gemini API error: %v, using fallback\n", err)
-		return s.generateFallbackSummary(text), nil
+	if _, ok := service.providers[service.defaultProvider]; !ok {
+		return nil, fmt.Errorf("summarizer provider '%s' is not configured (available: %v)", service.defaultProvider, service.Providers())
+	}
+	for tenant, provider := range cfg.TenantProviders {
+		if _, ok := service.providers[provider]; !ok {
+			return nil, fmt.Errorf("summarizer provider '%s' for tenant '%s' is not configured (available: %v)", provider, tenant, service.Providers())
+		}
 	}
 
-	return summary, nil
+	slog.Info("summarizer configured",
+		"provider", service.defaultProvider,
+		"available", service.Providers(),
+		"tenant_overrides", cfg.TenantProviders,
+	)
+
+	return service, nil
 }
 
-// callGeminiAPI makes the HTTP request to Google Gemini API
-func (s *AIService) callGeminiAPI(ctx context.Context, text string) (string, error) {
-	// Using gemini-2.5-flash which is available in free tier
-	// This is the latest, fastest model available (v1 API is stable)
-	endpoint := "https://generativelanguage.googleapis.com/v1/models/gemini-2.5-flash:generateContent"
-	url := fmt.Sprintf("%s?key=%s", endpoint, s.apiKey)
-
-	// Build payload - NOTE: we don't use generationConfig as it can cause MAX_TOKENS issues
-	payload := map[string]interface{}{
-		"contents": []map[string]interface{}{
-			{
-				"parts": []map[string]interface{}{
-					{
-						"text": s.buildPrompt(text),
-					},
-				},
-			},
-		},
+// Providers returns the names of the configured providers
+func (s *AIService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("marshal request: %w", err)
+// SummarizerFor returns the provider used for a tenant
+func (s *AIService) SummarizerFor(tenantName string) Summarizer {
+	if name, ok := s.tenantProviders[tenantName]; ok {
+		return s.providers[name]
 	}
+	return s.providers[s.defaultProvider]
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("create request: %w", err)
+// GenerateSummary generates a summary of the given text with the tenant's
+// provider. Long documents are split into page- and paragraph-aligned chunks
+// that are summarized concurrently (map) and then combined (reduce); the
+// per-chunk summaries are returned alongside the final summary.
+func (s *AIService) GenerateSummary(ctx context.Context, tenantName, text string) (string, []models.ChunkSummary, error) {
+	summarizer := s.SummarizerFor(tenantName)
+
+	chunks := chunkText(text, s.chunkChars)
+	if len(chunks) <= 1 {
+		summary, err := s.summarize(ctx, summarizer, summaryUserPrompt, text)
+		return summary, nil, err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := s.client.Do(req)
+	slog.DebugContext(ctx, "summarizing chunks", "chunks", len(chunks), "provider", summarizer.Name(), "concurrency", s.concurrency)
+	chunkSummaries, err := s.summarizeChunks(ctx, summarizer, chunks)
 	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+		return "", nil, err
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("read response: %w", err)
+	// Reduce: combine chunk summaries, re-chunking if they are still too long
+	combined := joinChunkSummaries(chunkSummaries)
+	for round := 0; round < maxReduceRounds && len(combined) > s.chunkChars; round++ {
+		partials, err := s.summarizeChunks(ctx, summarizer, chunkText(combined, s.chunkChars))
+		if err != nil {
+			return "", nil, err
+		}
+		combined = joinChunkSummaries(partials)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("status %d: %s", resp.StatusCode, string(respBody))
+	summary, err := s.summarize(ctx, summarizer, reduceInstruction, truncateRunes(combined, s.chunkChars))
+	if err != nil {
+		return "", nil, err
 	}
 
-	var geminiResp GeminiResponse
-	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
-		return "", fmt.Errorf("parse response: %w", err)
+	return summary, chunkSummaries, nil
+}
+
+// summarizeChunks summarizes chunks concurrently with at most s.concurrency
+// calls in flight, preserving chunk order in the result
+func (s *AIService) summarizeChunks(ctx context.Context, summarizer Summarizer, chunks []textChunk) ([]models.ChunkSummary, error) {
+	results := make([]models.ChunkSummary, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, s.concurrency)
+	var wg sync.WaitGroup
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk textChunk) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summary, err := s.summarize(ctx, summarizer, summaryUserPrompt, chunk.Text)
+			errs[i] = err
+			results[i] = models.ChunkSummary{
+				Index:     i,
+				StartPage: chunk.StartPage,
+				EndPage:   chunk.EndPage,
+				Chars:     len(chunk.Text),
+				Summary:   summary,
+			}
+		}(i, chunk)
 	}
+	wg.Wait()
 
-	// Extract text from response
-	if len(geminiResp.Candidates) > 0 {
-		candidate := geminiResp.Candidates[0]
-		if len(candidate.Content.Parts) > 0 {
-			result := candidate.Content.Parts[0].Text
-			return strings.TrimSpace(result), nil
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return "", fmt.Errorf("no text in response")
+	return results, nil
 }
 
-// buildPrompt constructs the prompt for Gemini
-func (s *AIService) buildPrompt(text string) string {
-	sys := "You are a helpful assistant that summarizes documents in 2-3 sentences."
-	usr := "Provide a concise summary of this document:"
-	return sys + "\n\n" + usr + "\n\n" + text + "\n\nSummary:"
-}
-
-// GeminiResponse represents Gemini API response structure
-type GeminiResponse struct {
-	Candidates []struct {
-		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
-			Role string `json:"role"`
-		} `json:"content"`
-		FinishReason string `json:"finishReason"`
-		Index        int    `json:"index"`
-	} `json:"candidates"`
-}
-
-// generateFallbackSummary creates basic summary from text
-func (s *AIService) generateFallbackSummary(text string) string {
-	maxLen := 500
-	if len(text) < maxLen {
-		maxLen = len(text)
+// summarize calls the provider, falling back to an extractive summary on error
+func (s *AIService) summarize(ctx context.Context, summarizer Summarizer, instruction, text string) (string, error) {
+	start := time.Now()
+	summary, err := summarizer.Summarize(ctx, instruction, text)
+	metrics.ObserveSummarizerCall(summarizer.Name(), err, time.Since(start))
+	if err != nil {
+		slog.WarnContext(ctx, "summarizer failed, using fallback", "provider", summarizer.Name(), "error", err)
+		metrics.CountSummarizerFallback(summarizer.Name())
+		return s.fallback.Summarize(ctx, instruction, text)
 	}
+	return summary, nil
+}
 
-	summary := text[:maxLen]
-
-	if lastPeriod := strings.LastIndex(summary, "."); lastPeriod > 100 {
-		summary = summary[:lastPeriod+1]
+// joinChunkSummaries concatenates chunk summaries in order, separated by
+// blank lines so the chunker can split them again on paragraph boundaries
+func joinChunkSummaries(chunks []models.ChunkSummary) string {
+	parts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		parts[i] = chunk.Summary
 	}
-
-	return strings.TrimSpace(summary) + "..."
-}
\ No newline at end of file
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// pagedText returns a document of the given number of pages, each a few
+// sentences long
+func pagedText(pages int) string {
+	texts := make([]string, pages)
+	for i := range texts {
+		texts[i] = strings.Repeat(fmt.Sprintf("Page %d discusses the quarterly results in some detail. ", i+1), 4)
+	}
+	return strings.Join(texts, PageBreak)
+}
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxChars int
+		paged    bool
+	}{
+		{"single chunk", "A short document.", 100, false},
+		{"pages", pagedText(6), 300, true},
+		{"long paragraph", strings.Repeat("word ", 500), 120, false},
+		{"no separators", strings.Repeat("é", 400), 101, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkText(tt.text, tt.maxChars)
+			if len(chunks) == 0 {
+				t.Fatal("no chunks")
+			}
+
+			lastPage := 0
+			for i, chunk := range chunks {
+				if len(chunk.Text) > tt.maxChars {
+					t.Errorf("chunk %d has %d bytes, limit %d", i, len(chunk.Text), tt.maxChars)
+				}
+				if !utf8.ValidString(chunk.Text) {
+					t.Errorf("chunk %d splits a rune", i)
+				}
+				if !tt.paged {
+					if chunk.StartPage != 0 || chunk.EndPage != 0 {
+						t.Errorf("chunk %d has pages %d-%d without page breaks", i, chunk.StartPage, chunk.EndPage)
+					}
+					continue
+				}
+				if chunk.StartPage < lastPage || chunk.EndPage < chunk.StartPage {
+					t.Errorf("chunk %d has pages %d-%d after page %d", i, chunk.StartPage, chunk.EndPage, lastPage)
+				}
+				lastPage = chunk.EndPage
+			}
+		})
+	}
+}
+
+// recordingSummarizer records the instruction and text of every call and
+// fails calls whose instruction is failOn
+type recordingSummarizer struct {
+	mu     sync.Mutex
+	calls  []summarizerCall
+	failOn string
+}
+
+type summarizerCall struct {
+	instruction string
+	text        string
+}
+
+func (s *recordingSummarizer) Name() string { return "recording" }
+
+func (s *recordingSummarizer) Summarize(ctx context.Context, instruction, text string) (string, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, summarizerCall{instruction, text})
+	s.mu.Unlock()
+
+	if instruction == s.failOn {
+		return "", errors.New("provider unavailable")
+	}
+	return "Summary of " + strings.Fields(text)[1] + ".", nil
+}
+
+func TestGenerateSummaryReduce(t *testing.T) {
+	tests := []struct {
+		name   string
+		failOn string // instruction whose calls fail, so the fallback runs
+	}{
+		{"provider", ""},
+		{"provider fails on reduce", reduceInstruction},
+		{"provider fails everywhere", summaryUserPrompt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, err := NewAIService(AIConfig{ChunkChars: 300})
+			if err != nil {
+				t.Fatal(err)
+			}
+			recorder := &recordingSummarizer{failOn: tt.failOn}
+			service.providers[ProviderFallback] = recorder
+
+			summary, chunkSummaries, err := service.GenerateSummary(context.Background(), "acme", pagedText(6))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunkSummaries) < 2 {
+				t.Fatalf("expected a map-reduce, got %d chunk summaries", len(chunkSummaries))
+			}
+			if strings.Contains(summary, "The following are summaries") {
+				t.Errorf("summary contains the reduce instruction: %q", summary)
+			}
+
+			reduced := 0
+			for _, call := range recorder.calls {
+				if strings.Contains(call.text, "The following are summaries") {
+					t.Errorf("instruction passed as text: %q", call.text)
+				}
+				if call.instruction == reduceInstruction {
+					reduced++
+				}
+			}
+			if reduced != 1 {
+				t.Errorf("expected one reduce call, got %d", reduced)
+			}
+		})
+	}
+}
+
+func TestGenerateSummaryDefaultFallback(t *testing.T) {
+	// Without provider keys every call uses the extractive summarizer
+	service, err := NewAIService(AIConfig{ChunkChars: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	summary, chunkSummaries, err := service.GenerateSummary(context.Background(), "acme", pagedText(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunkSummaries) < 2 {
+		t.Fatalf("expected a map-reduce, got %d chunk summaries", len(chunkSummaries))
+	}
+	if !strings.HasPrefix(summary, "Page 1 discusses") {
+		t.Errorf("summary does not start with the document text: %q", summary)
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path"
+	"strings"
+)
+
+const (
+	// maxCompressionRatio is the largest uncompressed-to-compressed ratio
+	// accepted for an archive entry. PDFs are mostly compressed already, so
+	// anything far above it is a zip bomb rather than a document.
+	maxCompressionRatio = 100
+	// compressionRatioFloor is the uncompressed size below which the ratio
+	// is not checked, since tiny files compress unpredictably
+	compressionRatioFloor = 1 << 20
+)
+
+var (
+	// ErrInvalidArchive is returned when an uploaded archive cannot be read
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrBatchTooLarge is returned when a batch exceeds its file count or size limit
+	ErrBatchTooLarge = errors.New("batch too large")
+)
+
+// BatchLimits bounds what one batch upload may contain
+type BatchLimits struct {
+	MaxFiles    int   // files per batch, counting archive entries
+	MaxBytes    int64 // total uncompressed size of the batch
+	Concurrency int   // files processed at once
+}
+
+// ArchiveEntry is one file of an uploaded archive. File is nil when the
+// entry was refused, and Err says why.
+type ArchiveEntry struct {
+	Name string
+	File *FileUpload
+	Err  error
+}
+
+// ReadZipArchive lists the files of an uploaded ZIP archive without
+// extracting them. Entries are decompressed only when their FileUpload is
+// opened; archive/zip fails the read if an entry inflates past its declared
+// size, so the declared sizes can be trusted for limits.
+//
+// Entries with unsafe paths, symlinks, encryption or an implausible
+// compression ratio are refused individually. Directories and macOS
+// resource forks are skipped. The returned closer releases the archive and
+// must be closed after the entries are no longer needed.
+func ReadZipArchive(file *multipart.FileHeader, maxEntries int) ([]ArchiveEntry, io.Closer, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open archive: %w", err)
+	}
+
+	reader, err := zip.NewReader(src, file.Size)
+	if err != nil {
+		src.Close()
+		return nil, nil, fmt.Errorf("%w: '%s': %s", ErrInvalidArchive, file.Filename, err.Error())
+	}
+
+	entries := []ArchiveEntry{}
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		if len(entries) == maxEntries {
+			src.Close()
+			return nil, nil, fmt.Errorf("%w: '%s' has more than %d files", ErrBatchTooLarge, file.Filename, maxEntries)
+		}
+
+		entry := ArchiveEntry{Name: f.Name}
+		if err := checkArchiveEntry(f); err != nil {
+			entry.Err = err
+		} else {
+			f := f
+			entry.File = &FileUpload{
+				Filename: path.Base(f.Name),
+				Size:     int64(f.UncompressedSize64),
+				open: func() (io.ReadCloser, error) {
+					return f.Open()
+				},
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, src, nil
+}
+
+// checkArchiveEntry refuses entries that could escape extraction or expand
+// far beyond their stored size
+func checkArchiveEntry(f *zip.File) error {
+	name := f.Name
+	if name == "" || strings.ContainsAny(name, "\\\x00") || path.IsAbs(name) {
+		return fmt.Errorf("%w: unsafe path '%s'", ErrInvalidArchive, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return fmt.Errorf("%w: unsafe path '%s'", ErrInvalidArchive, name)
+		}
+	}
+
+	if !f.Mode().IsRegular() {
+		return fmt.Errorf("%w: '%s' is not a regular file", ErrInvalidArchive, name)
+	}
+	if f.Flags&0x1 != 0 {
+		return fmt.Errorf("%w: '%s' is encrypted", ErrInvalidArchive, name)
+	}
+
+	size, compressed := f.UncompressedSize64, f.CompressedSize64
+	if size > compressionRatioFloor && (compressed == 0 || size/compressed > maxCompressionRatio) {
+		return fmt.Errorf("%w: '%s' expands %d bytes to %d", ErrInvalidArchive, name, compressed, size)
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"strings"
+	"testing"
+)
+
+// zipEntry is a file written to a test archive
+type zipEntry struct {
+	name    string
+	content string
+	mode    os.FileMode // regular file when zero
+	flags   uint16
+	store   bool // stored rather than deflated
+}
+
+// zipUpload builds an archive in memory and returns it as an uploaded form file
+func zipUpload(t *testing.T, entries []zipEntry) *multipart.FileHeader {
+	t.Helper()
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, e := range entries {
+		header := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Flags: e.flags}
+		if e.store {
+			header.Method = zip.Store
+		}
+		if e.mode != 0 {
+			header.SetMode(e.mode)
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return formFile(t, "archive.zip", archive.Bytes())
+}
+
+// formFile returns data as a file of a parsed multipart form
+func formFile(t *testing.T, name string, data []byte) *multipart.FileHeader {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	w, _ := mw.CreateFormFile("files", name)
+	w.Write(data)
+	mw.Close()
+
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["files"][0]
+}
+
+func TestReadZipArchiveEntries(t *testing.T) {
+	bomb := strings.Repeat("\x00", 2*compressionRatioFloor)
+
+	tests := []struct {
+		name    string
+		entry   zipEntry
+		refused bool
+	}{
+		{"plain file", zipEntry{name: "report.pdf", content: "%PDF-1.7"}, false},
+		{"nested file", zipEntry{name: "q1/report.pdf", content: "%PDF-1.7"}, false},
+		{"dot dot", zipEntry{name: "../report.pdf"}, true},
+		{"nested dot dot", zipEntry{name: "q1/../../report.pdf"}, true},
+		{"dot dot in a directory name", zipEntry{name: "..q1/report.pdf"}, false},
+		{"absolute path", zipEntry{name: "/etc/report.pdf"}, true},
+		{"backslash", zipEntry{name: "..\\report.pdf"}, true},
+		{"NUL byte", zipEntry{name: "report.pdf\x00.txt"}, true},
+		{"symlink", zipEntry{name: "report.pdf", content: "/etc/passwd", mode: os.ModeSymlink | 0o777}, true},
+		{"encrypted", zipEntry{name: "report.pdf", content: "secret", flags: 0x1}, true},
+		{"compression bomb", zipEntry{name: "report.pdf", content: bomb}, true},
+		{"stored large file", zipEntry{name: "report.pdf", content: bomb, store: true}, false},
+		{"small compressible file", zipEntry{name: "report.pdf", content: bomb[:compressionRatioFloor]}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, closer, err := ReadZipArchive(zipUpload(t, []zipEntry{tt.entry}), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closer.Close()
+
+			if len(entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(entries))
+			}
+			entry := entries[0]
+			if entry.Name != tt.entry.name {
+				t.Errorf("name = %q, want %q", entry.Name, tt.entry.name)
+			}
+			if tt.refused {
+				if entry.File != nil || !errors.Is(entry.Err, ErrInvalidArchive) {
+					t.Errorf("expected the entry to be refused, got file %v, error %v", entry.File, entry.Err)
+				}
+				return
+			}
+			if entry.Err != nil {
+				t.Fatalf("unexpected error: %v", entry.Err)
+			}
+			if entry.File.Filename != "report.pdf" {
+				t.Errorf("file name = %q, want report.pdf", entry.File.Filename)
+			}
+
+			src, err := entry.File.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			content, err := io.ReadAll(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.entry.content {
+				t.Errorf("content has %d bytes, want %d", len(content), len(tt.entry.content))
+			}
+		})
+	}
+}
+
+func TestReadZipArchiveSkipsDirectories(t *testing.T) {
+	entries, closer, err := ReadZipArchive(zipUpload(t, []zipEntry{
+		{name: "q1/"},
+		{name: "q1/report.pdf", content: "%PDF-1.7"},
+		{name: "__MACOSX/q1/._report.pdf", content: "fork"},
+	}), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	if len(entries) != 1 || entries[0].Name != "q1/report.pdf" {
+		t.Errorf("entries = %+v, want only q1/report.pdf", entries)
+	}
+}
+
+func TestReadZipArchiveEntryCount(t *testing.T) {
+	files := []zipEntry{{name: "a.pdf"}, {name: "b.pdf"}, {name: "c.pdf"}}
+
+	entries, closer, err := ReadZipArchive(zipUpload(t, files), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closer.Close()
+	if len(entries) != 3 {
+		t.Errorf("got %d entries, want 3", len(entries))
+	}
+
+	if _, _, err := ReadZipArchive(zipUpload(t, files), 2); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected ErrBatchTooLarge, got %v", err)
+	}
+}
+
+func TestReadZipArchiveInvalid(t *testing.T) {
+	_, _, err := ReadZipArchive(formFile(t, "archive.zip", []byte("not a zip archive")), 10)
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Errorf("expected ErrInvalidArchive, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// ErrInvalidAuditQuery is returned for malformed audit log queries
+var ErrInvalidAuditQuery = errors.New("invalid audit query")
+
+// AuditService records mutating actions and serves them for review
+type AuditService struct {
+	postgresRepo *repository.PostgresRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(postgresRepo *repository.PostgresRepository) *AuditService {
+	return &AuditService{
+		postgresRepo: postgresRepo,
+	}
+}
+
+// Record appends an entry to the audit log. The action has already happened
+// by the time it is recorded, so failures are logged rather than returned.
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditLog) {
+	if err := s.postgresRepo.InsertAuditLog(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "failed to record audit log",
+			"action", entry.Action, "resource_type", entry.ResourceType, "resource_id", entry.ResourceID, "error", err)
+	}
+}
+
+// ListAuditLogs returns one page of matching entries, newest first
+func (s *AuditService) ListAuditLogs(ctx context.Context, filter models.AuditFilter) (*models.AuditPage, error) {
+	if err := ValidateAuditFilter(&filter); err != nil {
+		return nil, err
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		return nil, fmt.Errorf("%w: limit must be at most %d", ErrInvalidAuditQuery, maxAuditLimit)
+	}
+
+	page := &models.AuditPage{Entries: []models.AuditLog{}}
+	err := s.postgresRepo.ScanAuditLogs(ctx, filter, func(entry *models.AuditLog) error {
+		page.Entries = append(page.Entries, *entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(page.Entries) == filter.Limit {
+		page.NextBeforeID = page.Entries[len(page.Entries)-1].ID
+	}
+	return page, nil
+}
+
+// ExportAuditLogs writes every matching entry to w as JSON Lines, newest
+// first, streaming rows instead of loading them all
+func (s *AuditService) ExportAuditLogs(ctx context.Context, filter models.AuditFilter, w io.Writer) error {
+	if err := ValidateAuditFilter(&filter); err != nil {
+		return err
+	}
+	filter.Limit = 0
+
+	encoder := json.NewEncoder(w)
+	return s.postgresRepo.ScanAuditLogs(ctx, filter, func(entry *models.AuditLog) error {
+		return encoder.Encode(entry)
+	})
+}
+
+// ValidateAuditFilter checks the bounds of a filter. Exports validate up
+// front, since they cannot report an error once the download has started.
+func ValidateAuditFilter(filter *models.AuditFilter) error {
+	if filter.Limit < 0 || filter.BeforeID < 0 {
+		return fmt.Errorf("%w: limit and before_id must not be negative", ErrInvalidAuditQuery)
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidAuditQuery)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// apiKeyPrefix marks keys issued by this service
+	apiKeyPrefix = "drk_"
+	// apiKeyDisplayLen is how much of a key is kept in clear for identification
+	apiKeyDisplayLen = 12
+)
+
+var (
+	// ErrInvalidAPIKey is returned for missing, unknown or revoked keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyNotFound is returned when a key ID does not exist or is already revoked
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrInvalidAPIKeyRequest is returned for malformed issue requests
+	ErrInvalidAPIKeyRequest = errors.New("invalid API key request")
+)
+
+// AuthService issues and verifies API keys. Keys are random secrets; only
+// their SHA-256 hash is stored, so a database leak does not expose them.
+type AuthService struct {
+	postgresRepo  *repository.PostgresRepository
+	tenantService *TenantService
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(postgresRepo *repository.PostgresRepository, tenantService *TenantService) *AuthService {
+	return &AuthService{
+		postgresRepo:  postgresRepo,
+		tenantService: tenantService,
+	}
+}
+
+// Authenticate resolves a presented key to its record
+func (s *AuthService) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := s.postgresRepo.AuthenticateAPIKey(ctx, hashAPIKey(key))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("unable to verify API key: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+// EnsureBootstrapKey registers a configured admin key so the first keys can
+// be issued. It is a no-op if the key already exists.
+func (s *AuthService) EnsureBootstrapKey(ctx context.Context, key string) error {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return fmt.Errorf("bootstrap admin key must start with '%s'", apiKeyPrefix)
+	}
+
+	apiKey := &models.APIKey{
+		ID:     uuid.New().String(),
+		Name:   "bootstrap",
+		Scope:  models.ScopeAdmin,
+		Prefix: displayPrefix(key),
+	}
+	return s.postgresRepo.CreateAPIKey(ctx, apiKey, hashAPIKey(key))
+}
+
+// IssueKey creates a new key. Tenant keys are bound to a tenant, admin keys
+// to none. Keys issued for a user take the user's tenant and act with the
+// user's role.
+func (s *AuthService) IssueKey(ctx context.Context, req models.APIKeyRequest) (*models.IssuedAPIKey, error) {
+	var userID *int
+	if req.UserID != 0 {
+		user, err := s.postgresRepo.GetUser(ctx, req.UserID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, fmt.Errorf("%w: '%d'", ErrUserNotFound, req.UserID)
+			}
+			return nil, fmt.Errorf("unable to get user: %w", err)
+		}
+		if user.DisabledAt != nil {
+			return nil, fmt.Errorf("%w: user '%d' is disabled", ErrInvalidAPIKeyRequest, user.ID)
+		}
+
+		userID = &user.ID
+		req.TenantName = user.TenantName
+		req.Scope = models.ScopeTenant
+		if user.Role == models.RolePlatformAdmin {
+			req.Scope = models.ScopeAdmin
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			req.Name = user.Email
+		}
+	}
+
+	if req.Scope == "" {
+		req.Scope = models.ScopeTenant
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidAPIKeyRequest)
+	}
+
+	switch req.Scope {
+	case models.ScopeTenant:
+		if err := s.tenantService.ValidateTenantName(req.TenantName); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAPIKeyRequest, err.Error())
+		}
+	case models.ScopeAdmin:
+		if req.TenantName != "" {
+			return nil, fmt.Errorf("%w: admin keys cannot be bound to a tenant", ErrInvalidAPIKeyRequest)
+		}
+	default:
+		return nil, fmt.Errorf("%w: scope must be '%s' or '%s'", ErrInvalidAPIKeyRequest, models.ScopeTenant, models.ScopeAdmin)
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &models.IssuedAPIKey{
+		APIKey: models.APIKey{
+			ID:         uuid.New().String(),
+			Name:       strings.TrimSpace(req.Name),
+			Scope:      req.Scope,
+			TenantName: req.TenantName,
+			UserID:     userID,
+			Prefix:     displayPrefix(key),
+		},
+		Key: key,
+	}
+	if err := s.postgresRepo.CreateAPIKey(ctx, &issued.APIKey, hashAPIKey(key)); err != nil {
+		return nil, fmt.Errorf("unable to create API key: %w", err)
+	}
+
+	// Re-read to pick up database defaults
+	stored, err := s.postgresRepo.GetAPIKey(ctx, issued.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read API key: %w", err)
+	}
+	issued.APIKey = *stored
+
+	return issued, nil
+}
+
+// ListKeys lists keys, optionally for a single tenant
+func (s *AuthService) ListKeys(ctx context.Context, tenantName string, includeRevoked bool) ([]models.APIKey, error) {
+	return s.postgresRepo.ListAPIKeys(ctx, tenantName, includeRevoked)
+}
+
+// RotateKey replaces an active key with a new secret of the same name, scope
+// and tenant. The old key stops working immediately.
+func (s *AuthService) RotateKey(ctx context.Context, id string) (*models.IssuedAPIKey, error) {
+	old, err := s.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	issued := &models.IssuedAPIKey{
+		APIKey: models.APIKey{
+			ID:         uuid.New().String(),
+			Name:       old.Name,
+			Scope:      old.Scope,
+			TenantName: old.TenantName,
+			UserID:     old.UserID,
+			Role:       old.Role,
+			Prefix:     displayPrefix(key),
+		},
+		Key: key,
+	}
+	if err := s.postgresRepo.RotateAPIKey(ctx, old.ID, &issued.APIKey, hashAPIKey(key)); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrAPIKeyNotFound, id)
+		}
+		return nil, fmt.Errorf("unable to rotate API key: %w", err)
+	}
+
+	return issued, nil
+}
+
+// RevokeKey revokes an active key
+func (s *AuthService) RevokeKey(ctx context.Context, id string) (*models.APIKey, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrAPIKeyNotFound, id)
+	}
+
+	key, err := s.postgresRepo.RevokeAPIKey(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrAPIKeyNotFound, id)
+		}
+		return nil, fmt.Errorf("unable to revoke API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetKey retrieves an active key by ID
+func (s *AuthService) GetKey(ctx context.Context, id string) (*models.APIKey, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrAPIKeyNotFound, id)
+	}
+
+	key, err := s.postgresRepo.GetAPIKey(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrAPIKeyNotFound, id)
+		}
+		return nil, fmt.Errorf("unable to get API key: %w", err)
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: '%s' is revoked", ErrAPIKeyNotFound, id)
+	}
+
+	return key, nil
+}
+
+// generateAPIKey returns a new random key with 256 bits of entropy
+func generateAPIKey() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("unable to generate API key: %w", err)
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// hashAPIKey returns the hex SHA-256 of a key. A fast hash is sufficient
+// because keys are long random secrets, not passwords.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// displayPrefix returns the identifying start of a key
+func displayPrefix(key string) string {
+	if len(key) > apiKeyDisplayLen {
+		return key[:apiKeyDisplayLen]
+	}
+	return key
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// textChunk is a piece of document text small enough for one summarizer call
+type textChunk struct {
+	Text      string
+	StartPage int // 1-based; 0 when the text has no page breaks
+	EndPage   int
+}
+
+// chunkText splits text into chunks of at most maxChars bytes. Splits prefer
+// page boundaries, then paragraphs, then lines, then whitespace, and never
+// fall inside a UTF-8 rune.
+func chunkText(text string, maxChars int) []textChunk {
+	paged := strings.Contains(text, PageBreak)
+
+	var chunks []textChunk
+	var current strings.Builder
+	startPage := 0
+	endPage := 0
+
+	flush := func() {
+		if t := strings.TrimSpace(current.String()); t != "" {
+			chunks = append(chunks, textChunk{Text: t, StartPage: startPage, EndPage: endPage})
+		}
+		current.Reset()
+		startPage = 0
+	}
+
+	for i, page := range strings.Split(text, PageBreak) {
+		pageNum := 0
+		if paged {
+			pageNum = i + 1
+		}
+
+		for _, piece := range splitBounded(page, maxChars) {
+			// +2 accounts for the paragraph separator added between pieces
+			if current.Len() > 0 && current.Len()+len(piece)+2 > maxChars {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n\n")
+			}
+			if startPage == 0 {
+				startPage = pageNum
+			}
+			current.WriteString(piece)
+			endPage = pageNum
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// splitBounded splits text into pieces of at most maxChars bytes, trying
+// each separator in turn before falling back to a hard rune-safe cut
+func splitBounded(text string, maxChars int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if len(text) <= maxChars {
+		return []string{text}
+	}
+
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		parts := strings.Split(text, sep)
+		if len(parts) < 2 {
+			continue
+		}
+
+		var pieces []string
+		var current strings.Builder
+		for i, part := range parts {
+			if i < len(parts)-1 && sep == ". " {
+				part += "."
+			}
+			if current.Len() > 0 && current.Len()+len(sep)+len(part) > maxChars {
+				pieces = append(pieces, splitBounded(current.String(), maxChars)...)
+				current.Reset()
+			}
+			if current.Len() > 0 {
+				current.WriteString(strings.TrimPrefix(sep, "."))
+			}
+			current.WriteString(part)
+		}
+		pieces = append(pieces, splitBounded(current.String(), maxChars)...)
+		return pieces
+	}
+
+	// No separators left: cut at the last rune boundary within the limit
+	cut := maxChars
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		_, size := utf8.DecodeRuneInString(text)
+		cut = size
+	}
+	return append([]string{text[:cut]}, splitBounded(text[cut:], maxChars)...)
+}
+
+// truncateRunes cuts s to at most maxBytes without splitting a UTF-8 rune
+func truncateRunes(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes]
+}
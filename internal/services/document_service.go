@@ -0,0 +1,515 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultDocumentPageSize = 20
+	maxDocumentPageSize     = 100
+	defaultSearchPageSize   = 10
+	maxSearchPageSize       = 50
+)
+
+var (
+	// ErrTenantNotFound is returned when the tenant does not exist or is deleted
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrInvalidDocumentQuery is returned when listing options are invalid
+	ErrInvalidDocumentQuery = errors.New("invalid document query")
+	// ErrInvalidDocumentID is returned when a document ID is not a valid ObjectID
+	ErrInvalidDocumentID = errors.New("invalid document ID")
+	// ErrInvalidDocumentUpdate is returned when a metadata update is invalid
+	ErrInvalidDocumentUpdate = errors.New("invalid document update")
+	// ErrDocumentNotFound is returned when the document does not exist
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrDocumentConflict is returned when the document is in the wrong state for the operation
+	ErrDocumentConflict = errors.New("document state conflict")
+)
+
+// DocumentService handles read and management operations on tenant documents
+type DocumentService struct {
+	postgresRepo     *repository.PostgresRepository
+	mongoRepo        *repository.MongoRepository
+	storageService   *StorageService
+	webhooks         *WebhookService
+	outbox           *OutboxService
+	defaultURLExpiry time.Duration
+	maxURLExpiry     time.Duration
+}
+
+// NewDocumentService creates a new document service
+func NewDocumentService(
+	postgresRepo *repository.PostgresRepository,
+	mongoRepo *repository.MongoRepository,
+	storageService *StorageService,
+	webhooks *WebhookService,
+	outbox *OutboxService,
+	defaultURLExpiry, maxURLExpiry time.Duration,
+) *DocumentService {
+	return &DocumentService{
+		postgresRepo:     postgresRepo,
+		mongoRepo:        mongoRepo,
+		storageService:   storageService,
+		webhooks:         webhooks,
+		outbox:           outbox,
+		defaultURLExpiry: defaultURLExpiry,
+		maxURLExpiry:     maxURLExpiry,
+	}
+}
+
+// ListDocuments returns a page of documents for an existing tenant
+func (s *DocumentService) ListDocuments(ctx context.Context, tenantName string, filter models.DocumentFilter) (*models.DocumentPage, error) {
+	if err := s.ensureTenant(ctx, tenantName); err != nil {
+		return nil, err
+	}
+
+	if err := normalizeDocumentFilter(&filter); err != nil {
+		return nil, err
+	}
+
+	page, err := s.mongoRepo.ListDocuments(ctx, tenantName, filter)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidDocumentQuery, err.Error())
+		}
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// SearchDocuments runs a ranked full-text search over a tenant's active
+// documents and attaches highlighted snippets to each hit
+func (s *DocumentService) SearchDocuments(ctx context.Context, tenantName, query string, limit, offset int64) (*models.SearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidDocumentQuery)
+	}
+	if limit == 0 {
+		limit = defaultSearchPageSize
+	}
+	if limit < 0 || limit > maxSearchPageSize {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidDocumentQuery, maxSearchPageSize)
+	}
+	if offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrInvalidDocumentQuery)
+	}
+
+	if err := s.ensureTenant(ctx, tenantName); err != nil {
+		return nil, err
+	}
+
+	hits, err := s.mongoRepo.SearchDocuments(ctx, tenantName, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	terms := searchTerms(query)
+	for i := range hits {
+		hit := &hits[i]
+		hit.Snippets = pageSnippets(hit.Pages, terms)
+		if len(hit.Snippets) == 0 {
+			// Documents ingested before per-page extraction
+			hit.Snippets = buildSnippets("extracted_text", hit.ExtractedText, terms)
+		}
+		if len(hit.Snippets) == 0 {
+			hit.Snippets = buildSnippets("summary", hit.Summary, terms)
+		}
+		if len(hit.Snippets) == 0 {
+			hit.Snippets = buildSnippets("file_name", hit.FileName, terms)
+		}
+		if hit.Snippets == nil {
+			hit.Snippets = []models.SearchSnippet{}
+		}
+		// Full text is only needed for snippets; keep responses small
+		hit.ExtractedText = ""
+		hit.Pages = nil
+	}
+
+	return &models.SearchResult{
+		Query:  query,
+		Hits:   hits,
+		Count:  len(hits),
+		Offset: offset,
+	}, nil
+}
+
+// GetDocument retrieves a single document, optionally including its extracted text
+func (s *DocumentService) GetDocument(ctx context.Context, tenantName, documentID string, includeText bool) (*models.Document, error) {
+	id, err := parseDocumentID(documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ensureTenant(ctx, tenantName); err != nil {
+		return nil, err
+	}
+
+	doc, err := s.mongoRepo.GetDocument(ctx, tenantName, id, includeText)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: '%s'", ErrDocumentNotFound, documentID)
+		}
+		return nil, fmt.Errorf("unable to get document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// UpdateDocument updates the metadata of an active document, returning the
+// updated document and its previous version
+func (s *DocumentService) UpdateDocument(ctx context.Context, tenantName, documentID string, update models.DocumentUpdate) (*models.Document, *models.Document, error) {
+	id, err := parseDocumentID(documentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateDocumentUpdate(&update); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.ensureTenant(ctx, tenantName); err != nil {
+		return nil, nil, err
+	}
+
+	before, after, err := s.mongoRepo.UpdateDocumentMetadata(ctx, tenantName, id, update)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil, s.explainMissing(ctx, tenantName, id, "document is deleted; restore it before editing")
+		}
+		return nil, nil, fmt.Errorf("unable to update document: %w", err)
+	}
+
+	return after, before, nil
+}
+
+// DeleteDocument soft deletes a single document
+func (s *DocumentService) DeleteDocument(ctx context.Context, tenantName, documentID string) error {
+	id, err := parseDocumentID(documentID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ensureTenant(ctx, tenantName); err != nil {
+		return err
+	}
+
+	err = s.mongoRepo.SoftDeleteDocument(ctx, tenantName, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return s.explainMissing(ctx, tenantName, id, "document is already deleted")
+	}
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{"document_id": documentID}
+	s.outbox.Record(ctx, tenantName, models.EventDocumentDeleted, data)
+	s.webhooks.Publish(ctx, tenantName, models.EventDocumentDeleted, data)
+	return nil
+}
+
+// RestoreDocument restores a single soft-deleted document
+func (s *DocumentService) RestoreDocument(ctx context.Context, tenantName, documentID string) error {
+	id, err := parseDocumentID(documentID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ensureTenant(ctx, tenantName); err != nil {
+		return err
+	}
+
+	err = s.mongoRepo.RestoreDocument(ctx, tenantName, id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return s.explainMissing(ctx, tenantName, id, "document is not deleted")
+	}
+	return err
+}
+
+// ListDocumentVersions returns every version of a document, oldest first,
+// marking the current one
+func (s *DocumentService) ListDocumentVersions(ctx context.Context, tenantName, documentID string) (*models.DocumentVersionList, error) {
+	doc, err := s.GetDocument(ctx, tenantName, documentID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := s.mongoRepo.ListDocumentVersions(ctx, tenantName, doc.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		// Stored before versions were recorded: the document is its only version
+		version, err := s.mongoRepo.GetDocumentVersion(ctx, tenantName, doc.ID, 1, false)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get document version: %w", err)
+		}
+		versions = append(versions, *version)
+	}
+
+	current := currentVersion(doc)
+	for i := range versions {
+		versions[i].Current = versions[i].Version == current
+	}
+
+	return &models.DocumentVersionList{
+		DocumentID:     doc.ID.Hex(),
+		CurrentVersion: current,
+		Versions:       versions,
+	}, nil
+}
+
+// GetDocumentVersion retrieves one version of a document, optionally
+// including its extracted text
+func (s *DocumentService) GetDocumentVersion(ctx context.Context, tenantName, documentID string, number int, includeText bool) (*models.DocumentVersion, error) {
+	doc, err := s.GetDocument(ctx, tenantName, documentID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.mongoRepo.GetDocumentVersion(ctx, tenantName, doc.ID, number, includeText)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: version %d of '%s'", ErrDocumentNotFound, number, documentID)
+		}
+		return nil, fmt.Errorf("unable to get document version: %w", err)
+	}
+	version.Current = version.Version == currentVersion(doc)
+
+	return version, nil
+}
+
+// RollbackDocument makes an earlier version of an active document current
+// again, returning the version and the number of the version it replaced
+func (s *DocumentService) RollbackDocument(ctx context.Context, tenantName, documentID string, number int) (*models.DocumentVersion, int, error) {
+	doc, err := s.GetDocument(ctx, tenantName, documentID, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	if doc.IsDeleted {
+		return nil, 0, fmt.Errorf("%w: document is deleted; restore it before rolling back", ErrDocumentConflict)
+	}
+
+	version, err := s.mongoRepo.RollbackDocument(ctx, tenantName, doc.ID, number)
+	if err != nil {
+		switch {
+		case errors.Is(err, mongo.ErrNoDocuments):
+			return nil, 0, s.explainMissingVersion(ctx, tenantName, doc.ID, number)
+		case errors.Is(err, repository.ErrContentConflict):
+			return nil, 0, fmt.Errorf("%w: %s", ErrDocumentConflict, err.Error())
+		}
+		return nil, 0, fmt.Errorf("unable to roll back document: %w", err)
+	}
+	version.Current = true
+
+	return version, currentVersion(doc), nil
+}
+
+// OpenDocumentVersionFile opens the original PDF of one version of an active
+// document for streaming. The caller must close the returned reader.
+func (s *DocumentService) OpenDocumentVersionFile(ctx context.Context, tenantName, documentID string, number int) (*models.DocumentVersion, io.ReadCloser, int64, error) {
+	doc, err := s.GetDocument(ctx, tenantName, documentID, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if doc.IsDeleted {
+		return nil, nil, 0, fmt.Errorf("%w: document is deleted", ErrDocumentConflict)
+	}
+
+	version, err := s.GetDocumentVersion(ctx, tenantName, documentID, number, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if version.Quarantine != nil {
+		return nil, nil, 0, fmt.Errorf("%w: version is quarantined", ErrDocumentConflict)
+	}
+
+	reader, size, err := s.storageService.GetFile(ctx, version.StoragePath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return version, reader, size, nil
+}
+
+// OpenDocumentFile opens the original PDF of an active document for streaming.
+// Quarantined files are never served. The caller must close the returned reader.
+func (s *DocumentService) OpenDocumentFile(ctx context.Context, tenantName, documentID string) (*models.Document, io.ReadCloser, int64, error) {
+	doc, err := s.GetDocument(ctx, tenantName, documentID, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if doc.IsDeleted {
+		return nil, nil, 0, fmt.Errorf("%w: document is deleted", ErrDocumentConflict)
+	}
+	if doc.Quarantine != nil {
+		return nil, nil, 0, fmt.Errorf("%w: document is quarantined", ErrDocumentConflict)
+	}
+
+	reader, size, err := s.storageService.GetFile(ctx, doc.StoragePath)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return doc, reader, size, nil
+}
+
+// PresignDocumentURL generates a time-limited download URL for an active document.
+// A zero expiry uses the configured default.
+func (s *DocumentService) PresignDocumentURL(ctx context.Context, tenantName, documentID string, expiry time.Duration) (string, time.Time, error) {
+	if expiry == 0 {
+		expiry = s.defaultURLExpiry
+	}
+	if expiry < time.Second || expiry > s.maxURLExpiry {
+		return "", time.Time{}, fmt.Errorf("%w: expiry must be between 1s and %s", ErrInvalidDocumentQuery, s.maxURLExpiry)
+	}
+
+	doc, err := s.GetDocument(ctx, tenantName, documentID, false)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if doc.IsDeleted {
+		return "", time.Time{}, fmt.Errorf("%w: document is deleted", ErrDocumentConflict)
+	}
+	if doc.Quarantine != nil {
+		return "", time.Time{}, fmt.Errorf("%w: document is quarantined", ErrDocumentConflict)
+	}
+
+	expiresAt := time.Now().Add(expiry)
+	url, err := s.storageService.PresignedURL(ctx, doc.StoragePath, doc.FileName, expiry)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return url, expiresAt, nil
+}
+
+// explainMissing distinguishes a missing document from one that exists but
+// was filtered out by its deletion state
+func (s *DocumentService) explainMissing(ctx context.Context, tenantName string, id primitive.ObjectID, conflict string) error {
+	_, err := s.mongoRepo.GetDocument(ctx, tenantName, id, false)
+	if err == nil {
+		return fmt.Errorf("%w: %s", ErrDocumentConflict, conflict)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("%w: '%s'", ErrDocumentNotFound, id.Hex())
+	}
+	return fmt.Errorf("unable to get document: %w", err)
+}
+
+// explainMissingVersion distinguishes a missing version from a document that
+// was deleted meanwhile
+func (s *DocumentService) explainMissingVersion(ctx context.Context, tenantName string, id primitive.ObjectID, number int) error {
+	if _, err := s.mongoRepo.GetDocumentVersion(ctx, tenantName, id, number, false); err == nil {
+		return fmt.Errorf("%w: document is deleted; restore it before rolling back", ErrDocumentConflict)
+	}
+	return fmt.Errorf("%w: version %d of '%s'", ErrDocumentNotFound, number, id.Hex())
+}
+
+// currentVersion is the number of the version a document holds; documents
+// stored before versions were recorded hold version 1
+func currentVersion(doc *models.Document) int {
+	if doc.CurrentVersion == 0 {
+		return 1
+	}
+	return doc.CurrentVersion
+}
+
+// ensureTenant checks that the tenant exists in the master database
+func (s *DocumentService) ensureTenant(ctx context.Context, tenantName string) error {
+	_, err := s.postgresRepo.GetTenantByName(ctx, tenantName)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("%w: '%s'", ErrTenantNotFound, tenantName)
+		}
+		return fmt.Errorf("error checking tenant: %w", err)
+	}
+	return nil
+}
+
+// parseDocumentID converts a hex string into a document ObjectID
+func parseDocumentID(documentID string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(documentID)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: '%s'", ErrInvalidDocumentID, documentID)
+	}
+	return id, nil
+}
+
+// validateDocumentUpdate trims and validates the fields of a metadata update
+func validateDocumentUpdate(update *models.DocumentUpdate) error {
+	if update.FileName == nil && update.Summary == nil {
+		return fmt.Errorf("%w: at least one of file_name or summary is required", ErrInvalidDocumentUpdate)
+	}
+
+	if update.FileName != nil {
+		name := strings.TrimSpace(*update.FileName)
+		if name == "" {
+			return fmt.Errorf("%w: file_name must not be empty", ErrInvalidDocumentUpdate)
+		}
+		if len(name) > 255 {
+			return fmt.Errorf("%w: file_name must be less than 256 characters", ErrInvalidDocumentUpdate)
+		}
+		update.FileName = &name
+	}
+
+	if update.Summary != nil {
+		summary := strings.TrimSpace(*update.Summary)
+		update.Summary = &summary
+	}
+
+	return nil
+}
+
+// normalizeDocumentFilter applies defaults and validates listing options
+func normalizeDocumentFilter(filter *models.DocumentFilter) error {
+	switch filter.SortBy {
+	case "":
+		filter.SortBy = "uploaded_at"
+	case "uploaded_at", "file_name", "file_size":
+	default:
+		return fmt.Errorf("%w: sort must be one of uploaded_at, file_name, file_size", ErrInvalidDocumentQuery)
+	}
+
+	switch filter.SortOrder {
+	case "":
+		filter.SortOrder = "desc"
+	case "asc", "desc":
+	default:
+		return fmt.Errorf("%w: order must be asc or desc", ErrInvalidDocumentQuery)
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultDocumentPageSize
+	}
+	if filter.Limit < 0 || filter.Limit > maxDocumentPageSize {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidDocumentQuery, maxDocumentPageSize)
+	}
+
+	if filter.MinPages != nil && filter.MaxPages != nil && *filter.MinPages > *filter.MaxPages {
+		return fmt.Errorf("%w: min_pages must not exceed max_pages", ErrInvalidDocumentQuery)
+	}
+
+	if filter.MinSize != nil && filter.MaxSize != nil && *filter.MinSize > *filter.MaxSize {
+		return fmt.Errorf("%w: min_size must not exceed max_size", ErrInvalidDocumentQuery)
+	}
+
+	if filter.UploadedFrom != nil && filter.UploadedTo != nil && filter.UploadedFrom.After(*filter.UploadedTo) {
+		return fmt.Errorf("%w: uploaded_from must be before uploaded_to", ErrInvalidDocumentQuery)
+	}
+
+	return nil
+}
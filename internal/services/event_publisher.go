@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Event publisher kinds
+const (
+	PublisherNone  = "none"
+	PublisherFile  = "file"
+	PublisherNATS  = "nats"
+	PublisherKafka = "kafka"
+)
+
+// maxResponseSnippet is how much of a failed Kafka REST proxy response is
+// kept as its error
+const maxResponseSnippet = 512
+
+// EventPublisher delivers outbox events to an event bus. Publish returns once
+// the bus has durably accepted the event. The relay calls it for one event
+// at a time, in outbox order, and may repeat an event after a failure.
+type EventPublisher interface {
+	Publish(ctx context.Context, event *models.OutboxEvent) error
+	Close() error
+}
+
+// EventBusConfig selects and configures the event publisher
+type EventBusConfig struct {
+	Publisher     string // none, file, nats or kafka
+	FilePath      string
+	NATSURL       string
+	NATSStream    string
+	SubjectPrefix string // NATS subjects are <prefix>.<tenant>.<event type>
+	KafkaRESTURL  string
+	KafkaTopic    string
+	Timeout       time.Duration
+}
+
+// NewEventPublisher creates the configured publisher. It returns nil when
+// events are not published.
+func NewEventPublisher(ctx context.Context, config EventBusConfig) (EventPublisher, error) {
+	switch config.Publisher {
+	case "", PublisherNone:
+		return nil, nil
+	case PublisherFile:
+		return NewFilePublisher(config.FilePath)
+	case PublisherNATS:
+		return NewNATSPublisher(ctx, config.NATSURL, config.NATSStream, config.SubjectPrefix)
+	case PublisherKafka:
+		return NewKafkaRESTPublisher(config.KafkaRESTURL, config.KafkaTopic, config.Timeout)
+	default:
+		return nil, fmt.Errorf("unknown event publisher '%s' (use none, file, nats or kafka)", config.Publisher)
+	}
+}
+
+// MemoryPublisher keeps published events in memory, for tests
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []models.OutboxEvent
+	// Fail, if set, is called before each event is accepted; a non-nil
+	// result fails the publish
+	Fail func(*models.OutboxEvent) error
+}
+
+// NewMemoryPublisher creates an empty in-memory publisher
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+// Publish records the event
+func (p *MemoryPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Fail != nil {
+		if err := p.Fail(event); err != nil {
+			return err
+		}
+	}
+	p.events = append(p.events, *event)
+	return nil
+}
+
+// Events returns the events published so far, in publish order
+func (p *MemoryPublisher) Events() []models.OutboxEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]models.OutboxEvent(nil), p.events...)
+}
+
+// Close does nothing
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
+
+// FilePublisher appends events to a file as JSON Lines, syncing each one to
+// disk before it counts as published
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher opens path for appending, creating it if needed
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if path == "" {
+		return nil, fmt.Errorf("event file path is required")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open event file: %w", err)
+	}
+	return &FilePublisher{file: file}, nil
+}
+
+// Publish appends the event as one line
+func (p *FilePublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to write event: %w", err)
+	}
+	return p.file.Sync()
+}
+
+// Close closes the file
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// NATSPublisher publishes events to a JetStream stream. The event ID is the
+// message ID, so JetStream drops events republished within its duplicate
+// window.
+type NATSPublisher struct {
+	conn          *nats.Conn
+	js            jetstream.JetStream
+	subjectPrefix string
+}
+
+// NewNATSPublisher connects to NATS and creates the stream if it does not
+// exist yet
+func NewNATSPublisher(ctx context.Context, natsURL, stream, subjectPrefix string) (*NATSPublisher, error) {
+	conn, err := nats.Connect(natsURL, nats.Name("pdf-ingestion-outbox"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to NATS: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to open JetStream: %w", err)
+	}
+
+	_, err = js.Stream(ctx, stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     stream,
+			Subjects: []string{subjectPrefix + ".>"},
+			Storage:  jetstream.FileStorage,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to set up stream '%s': %w", stream, err)
+	}
+
+	return &NATSPublisher{conn: conn, js: js, subjectPrefix: subjectPrefix}, nil
+}
+
+// Publish sends the event and waits for the stream to acknowledge it
+func (p *NATSPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %w", err)
+	}
+
+	subject := fmt.Sprintf("%s.%s.%s", p.subjectPrefix, event.TenantName, event.Type)
+	if _, err := p.js.Publish(ctx, subject, payload, jetstream.WithMsgID(event.EventID)); err != nil {
+		return fmt.Errorf("unable to publish to %s: %w", subject, err)
+	}
+	return nil
+}
+
+// Close drains the connection
+func (p *NATSPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+// KafkaRESTPublisher produces events to a Kafka topic through a Kafka REST
+// Proxy (v2 API). Records are keyed by tenant, so each tenant's events land
+// in one partition, in order.
+type KafkaRESTPublisher struct {
+	endpoint string
+	client   *http.Client
+}
+
+// kafkaRecords is the body of a produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string              `json:"key"`
+	Value *models.OutboxEvent `json:"value"`
+}
+
+// kafkaOffsets is the response to a produce request
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// NewKafkaRESTPublisher creates a publisher producing to topic through the
+// REST proxy at restURL
+func NewKafkaRESTPublisher(restURL, topic string, timeout time.Duration) (*KafkaRESTPublisher, error) {
+	if restURL == "" || topic == "" {
+		return nil, fmt.Errorf("Kafka REST URL and topic are required")
+	}
+	return &KafkaRESTPublisher{
+		endpoint: strings.TrimRight(restURL, "/") + "/topics/" + url.PathEscape(topic),
+		client:   &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Publish produces the event and checks that the proxy accepted it
+func (p *KafkaRESTPublisher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: event.TenantName, Value: event}}})
+	if err != nil {
+		return fmt.Errorf("unable to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach Kafka REST proxy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSnippet))
+		return fmt.Errorf("Kafka REST proxy responded %s: %s", resp.Status, snippet)
+	}
+
+	var offsets kafkaOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return fmt.Errorf("unable to decode Kafka REST proxy response: %w", err)
+	}
+	for _, offset := range offsets.Offsets {
+		if offset.ErrorCode != nil {
+			return fmt.Errorf("Kafka rejected event %s: %s (code %d)", event.EventID, offset.Error, *offset.ErrorCode)
+		}
+	}
+	return nil
+}
+
+// Close releases idle connections to the proxy
+func (p *KafkaRESTPublisher) Close() error {
+	p.client.CloseIdleConnections()
+	return nil
+}
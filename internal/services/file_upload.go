@@ -0,0 +1,32 @@
+package services
+
+import (
+	"io"
+	"mime/multipart"
+)
+
+// FileUpload is a file submitted for ingestion: a multipart form file, a
+// streamed upload or an entry of an uploaded ZIP archive
+type FileUpload struct {
+	Filename string
+	Size     int64
+	// Stored is set when the file was streamed to storage as it arrived
+	Stored *StoredFile
+	open   func() (io.ReadCloser, error)
+}
+
+// NewFileUpload wraps a multipart form file
+func NewFileUpload(file *multipart.FileHeader) *FileUpload {
+	return &FileUpload{
+		Filename: file.Filename,
+		Size:     file.Size,
+		open: func() (io.ReadCloser, error) {
+			return file.Open()
+		},
+	}
+}
+
+// Open opens the content of the file. Every call reads it from the start.
+func (f *FileUpload) Open() (io.ReadCloser, error) {
+	return f.open()
+}
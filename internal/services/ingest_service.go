@@ -0,0 +1,768 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/metrics"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/bacancy/droadmap/internal/tracing"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// jobLease is how long a worker owns a claimed job before another worker
+	// may pick it up again (covers crashes and restarts mid-job). Workers
+	// extend it every jobHeartbeat while they process the job.
+	jobLease     = 10 * time.Minute
+	jobHeartbeat = jobLease / 4
+	// maxJobAttempts is the number of times a job is tried before it fails
+	maxJobAttempts = 3
+	// jobPollInterval is how often idle workers check for runnable jobs
+	jobPollInterval = 2 * time.Second
+	// summaryFailedMessage replaces the summary when summarization fails; it
+	// is never reused for identical uploads
+	summaryFailedMessage = "Summary generation failed. Please check AI service configuration."
+)
+
+var (
+	// ErrJobNotFound is returned when an ingest job does not exist
+	ErrJobNotFound = errors.New("job not found")
+	// ErrDuplicateDocument is returned when an upload's content is already stored
+	ErrDuplicateDocument = errors.New("duplicate document")
+	// ErrInvalidDuplicateMode is returned for an unknown duplicate handling mode
+	ErrInvalidDuplicateMode = errors.New("invalid duplicate mode")
+	// ErrJobLost is returned when a worker's lease on a job expired and
+	// another worker claimed it
+	ErrJobLost = errors.New("job lease lost")
+)
+
+// UploadResult is the outcome of an upload
+type UploadResult struct {
+	// Job is the queued ingest job, or the job of an identical upload that
+	// is still being ingested when DuplicateJob is set
+	Job          *models.Job
+	DuplicateJob bool
+	// Duplicate is the stored document with identical content, if any
+	Duplicate *models.Document
+}
+
+// IngestService runs the asynchronous ingest pipeline. Jobs are persisted in
+// the master database and processed by a pool of workers.
+type IngestService struct {
+	postgresRepo   *repository.PostgresRepository
+	mongoRepo      *repository.MongoRepository
+	pdfService     *PDFService
+	aiService      *AIService
+	storageService *StorageService
+	webhooks       *WebhookService
+	outbox         *OutboxService
+	spool          *UploadSpool
+	workers        int
+	storeChunks    bool
+	wake           chan struct{}
+}
+
+// NewIngestService creates a new ingest service with the given worker count.
+// storeChunks keeps the per-chunk summaries of long documents on the document.
+func NewIngestService(
+	postgresRepo *repository.PostgresRepository,
+	mongoRepo *repository.MongoRepository,
+	pdfService *PDFService,
+	aiService *AIService,
+	storageService *StorageService,
+	webhooks *WebhookService,
+	outbox *OutboxService,
+	spool *UploadSpool,
+	workers int,
+	storeChunks bool,
+) *IngestService {
+	if workers < 1 {
+		workers = 1
+	}
+	return &IngestService{
+		postgresRepo:   postgresRepo,
+		mongoRepo:      mongoRepo,
+		pdfService:     pdfService,
+		aiService:      aiService,
+		storageService: storageService,
+		webhooks:       webhooks,
+		outbox:         outbox,
+		spool:          spool,
+		workers:        workers,
+		storeChunks:    storeChunks,
+		wake:           make(chan struct{}, workers),
+	}
+}
+
+// StreamUpload writes an uploaded file to storage as it arrives, in a single
+// pass that hashes it and enforces the size limit, and keeps one local copy
+// for inspection and extraction. A positive maxSize, such as the tenant's
+// file size quota, lowers the limit; exceeding it returns ErrQuotaExceeded.
+// The returned file is already stored: pass it to Enqueue, or to Discard if
+// it is refused.
+func (s *IngestService) StreamUpload(ctx context.Context, tenantName, fileName string, src io.Reader, maxSize int64) (*FileUpload, error) {
+	local, err := s.spool.Create()
+	if err != nil {
+		return nil, err
+	}
+	path := local.Name()
+
+	limit := int64(maxPDFSize)
+	if maxSize > 0 && maxSize < limit {
+		limit = maxSize
+	}
+	stored, err := s.storageService.StreamFile(ctx, tenantName, fileName, src, -1, limit, local)
+	if closeErr := local.Close(); err == nil && closeErr != nil {
+		s.discardFile(ctx, stored.StoragePath)
+		err = fmt.Errorf("unable to write spool file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(path)
+		if errors.Is(err, ErrFileTooLarge) && limit < maxPDFSize {
+			// The tenant's own limit, not the service's, was exceeded
+			err = fmt.Errorf("%w: file size exceeds the limit of %d bytes", ErrQuotaExceeded, limit)
+		}
+		return nil, err
+	}
+	s.spool.Keep(stored.StoragePath, path)
+
+	return &FileUpload{
+		Filename: fileName,
+		Size:     stored.Size,
+		Stored:   stored,
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}, nil
+}
+
+// Discard removes a file stored by StreamUpload that was refused
+func (s *IngestService) Discard(ctx context.Context, file *FileUpload) {
+	if file.Stored != nil {
+		s.discardFile(ctx, file.Stored.StoragePath)
+	}
+}
+
+// Enqueue stores the uploaded file, unless StreamUpload already did, and
+// creates a queued ingest job for it.
+// Quarantined files are stored but never extracted or summarized.
+//
+// Files whose content is already stored, or is being ingested, are handled
+// according to onDuplicate: DuplicateReject fails with ErrDuplicateDocument,
+// DuplicateExisting returns the existing document or job without storing the
+// file, and DuplicateVersion queues the file as a new version of the existing
+// document, reusing its extracted text and summary.
+func (s *IngestService) Enqueue(ctx context.Context, tenantName string, file *FileUpload, quarantine *models.Quarantine, onDuplicate string) (*UploadResult, error) {
+	if err := ValidateDuplicateMode(onDuplicate); err != nil {
+		return nil, err
+	}
+
+	stored := file.Stored
+	if stored == nil {
+		var err error
+		if stored, err = s.storageService.UploadFile(ctx, tenantName, file); err != nil {
+			return nil, err
+		}
+	}
+	storagePath := stored.StoragePath
+	metrics.ObserveUploadSize(stored.Size)
+	metrics.ObserveIngestStep(models.StepUpload, nil, stored.FinishedAt.Sub(stored.StartedAt))
+
+	job := &models.Job{
+		ID:          uuid.New().String(),
+		TenantName:  tenantName,
+		FileName:    file.Filename,
+		FileSize:    stored.Size,
+		StoragePath: storagePath,
+		DocumentID:  primitive.NewObjectID().Hex(),
+		ContentHash: stored.ContentHash,
+		Quarantine:  quarantine,
+		Status:      models.JobStatusQueued,
+		// The job's spans join the trace of the upload
+		TraceContext: tracing.Inject(ctx),
+		Steps: []models.JobStep{
+			{
+				Name:       models.StepUpload,
+				Status:     models.StepStatusCompleted,
+				StartedAt:  &stored.StartedAt,
+				FinishedAt: &stored.FinishedAt,
+				DurationMs: stored.FinishedAt.Sub(stored.StartedAt).Milliseconds(),
+			},
+			{Name: models.StepExtract, Status: models.StepStatusPending},
+			{Name: models.StepSummarize, Status: models.StepStatusPending},
+			{Name: models.StepStore, Status: models.StepStatusPending},
+		},
+	}
+
+	result, err := s.checkDuplicate(ctx, job, onDuplicate)
+	if err != nil || result != nil {
+		// Only a new version keeps the file
+		if result == nil || !job.NewVersion {
+			s.discardFile(ctx, storagePath)
+		}
+		if err != nil || !job.NewVersion {
+			return result, err
+		}
+	}
+
+	// Re-uploads under an existing file name are revisions of that document
+	if err := s.matchDocumentName(ctx, job); err != nil {
+		s.discardFile(ctx, storagePath)
+		return nil, err
+	}
+
+	if err := s.postgresRepo.CreateJob(ctx, job); err != nil {
+		// Don't leave an object behind that no job will ever process
+		s.discardFile(ctx, storagePath)
+		return nil, fmt.Errorf("unable to create job: %w", err)
+	}
+
+	// Wake an idle worker without blocking if all are busy
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	if result == nil {
+		result = &UploadResult{}
+	}
+	result.Job = job
+	return result, nil
+}
+
+// ValidateDuplicateMode checks that mode is a known duplicate handling mode
+func ValidateDuplicateMode(mode string) error {
+	switch mode {
+	case models.DuplicateReject, models.DuplicateExisting, models.DuplicateVersion:
+		return nil
+	}
+	return fmt.Errorf("%w: '%s' (use reject, existing or version)", ErrInvalidDuplicateMode, mode)
+}
+
+// checkDuplicate looks for a stored document or pending job with the same
+// content as job. It returns nil when there is none; in version mode with a
+// stored document, job is turned into a new version of it.
+func (s *IngestService) checkDuplicate(ctx context.Context, job *models.Job, onDuplicate string) (*UploadResult, error) {
+	existing, err := s.mongoRepo.FindDocumentByHash(ctx, job.TenantName, job.ContentHash)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("unable to check for duplicates: %w", err)
+	}
+	if err == nil {
+		// The tenant cannot see a deleted document, so neither point the
+		// upload at it nor store the content again beside it
+		if existing.IsDeleted {
+			return nil, fmt.Errorf("%w: content matches deleted document %s; restore it first", ErrDocumentConflict, existing.ID.Hex())
+		}
+
+		result := &UploadResult{Duplicate: existing}
+		switch onDuplicate {
+		case models.DuplicateReject:
+			return result, fmt.Errorf("%w: content matches document %s", ErrDuplicateDocument, existing.ID.Hex())
+		case models.DuplicateVersion:
+			job.DocumentID = existing.ID.Hex()
+			job.NewVersion = true
+		}
+		return result, nil
+	}
+
+	pending, err := s.postgresRepo.FindPendingJobByHash(ctx, job.TenantName, job.ContentHash)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to check for duplicates: %w", err)
+	}
+
+	result := &UploadResult{Job: pending, DuplicateJob: true}
+	if onDuplicate == models.DuplicateReject {
+		return result, fmt.Errorf("%w: content matches job %s, which is still being ingested", ErrDuplicateDocument, pending.ID)
+	}
+	return result, nil
+}
+
+// matchDocumentName turns job into a new version of the active document with
+// the same file name, if there is one
+func (s *IngestService) matchDocumentName(ctx context.Context, job *models.Job) error {
+	if job.NewVersion {
+		return nil
+	}
+
+	existing, err := s.mongoRepo.FindDocumentByName(ctx, job.TenantName, job.FileName)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to look up document by name: %w", err)
+	}
+
+	if existing.ID.Hex() != job.DocumentID {
+		job.DocumentID = existing.ID.Hex()
+		job.NewVersion = true
+	}
+	return nil
+}
+
+// discardFile removes a stored file that no job will process
+func (s *IngestService) discardFile(ctx context.Context, storagePath string) {
+	s.spool.Release(storagePath)
+	if err := s.storageService.DeleteFile(ctx, storagePath); err != nil {
+		slog.WarnContext(ctx, "failed to remove orphaned object", "storage_path", storagePath, "error", err)
+	}
+}
+
+// GetJob retrieves an ingest job by ID
+func (s *IngestService) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrJobNotFound, id)
+	}
+
+	job, err := s.postgresRepo.GetJob(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrJobNotFound, id)
+		}
+		return nil, fmt.Errorf("unable to get job: %w", err)
+	}
+
+	return job, nil
+}
+
+// Start launches the worker pool. Workers stop when ctx is cancelled.
+func (s *IngestService) Start(ctx context.Context) {
+	for i := 0; i < s.workers; i++ {
+		go s.worker(ctx)
+	}
+	slog.Info("ingest workers started", "workers", s.workers)
+}
+
+// worker claims and processes jobs until ctx is cancelled
+func (s *IngestService) worker(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain all runnable jobs before going idle
+		for {
+			job, err := s.postgresRepo.ClaimNextJob(ctx, jobLease)
+			if err != nil {
+				if err != pgx.ErrNoRows && ctx.Err() == nil {
+					slog.ErrorContext(ctx, "failed to claim ingest job", "error", err)
+				}
+				break
+			}
+			s.process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// process runs the remaining pipeline steps for a claimed job
+func (s *IngestService) process(ctx context.Context, job *models.Job) {
+	ctx = logging.With(ctx,
+		logging.KeyJobID, job.ID,
+		logging.KeyTenant, job.TenantName,
+		logging.KeyDocumentID, job.DocumentID,
+	)
+	defer s.spool.Release(job.StoragePath)
+
+	ctx, span := tracing.Start(tracing.Extract(ctx, job.TraceContext), "ingest.job",
+		attribute.String("job.id", job.ID),
+		attribute.String("tenant.name", job.TenantName),
+		attribute.Int("job.attempt", job.Attempts),
+	)
+	defer span.End()
+	slog.InfoContext(ctx, "processing job", "file_name", job.FileName, "attempt", job.Attempts)
+
+	// Keep the lease while steps run; once it is lost another worker owns
+	// the job and this attempt stops
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go s.heartbeat(ctx, job, cancel)
+
+	// Earlier attempts may have left steps running or failed; rerun them all
+	for i := range job.Steps {
+		if job.Steps[i].Name != models.StepUpload {
+			job.Steps[i] = models.JobStep{Name: job.Steps[i].Name, Status: models.StepStatusPending}
+		}
+	}
+	job.Error = ""
+
+	var content *PDFContent
+	var summary string
+	var chunkSummaries []models.ChunkSummary
+
+	if job.Quarantine != nil {
+		// Never parse or send unsafe content to a provider; only record it
+		job.Step(models.StepExtract).Status = models.StepStatusSkipped
+		job.Step(models.StepSummarize).Status = models.StepStatusSkipped
+		content = &PDFContent{Metadata: models.PDFMetadata{
+			ExtractionNote: fmt.Sprintf("PDF file: %s (Quarantined: %s)", job.FileName, job.Quarantine.Reason),
+		}}
+		err := s.runStep(ctx, job, models.StepStore, func(ctx context.Context) error {
+			return s.storeDocument(ctx, job, content, "", nil)
+		})
+		s.finish(ctx, job, err)
+		return
+	}
+
+	// Identical content was extracted and summarized before; reuse it rather
+	// than paying for another summary
+	if cached := s.cachedContent(ctx, job); cached != nil {
+		note := fmt.Sprintf("reused from document %s version %d", cached.DocumentID.Hex(), cached.Version)
+		for _, name := range []string{models.StepExtract, models.StepSummarize} {
+			job.Step(name).Status = models.StepStatusSkipped
+			job.Step(name).Note = note
+		}
+		content = &PDFContent{Pages: cached.Pages, Metadata: cached.Metadata}
+		if len(cached.Pages) == 0 && cached.ExtractedText != "" {
+			content.Pages = []models.PDFPage{{Number: 1, Text: cached.ExtractedText, CharCount: len(cached.ExtractedText)}}
+		}
+		err := s.runStep(ctx, job, models.StepStore, func(ctx context.Context) error {
+			chunkSummaries := cached.ChunkSummaries
+			if !s.storeChunks {
+				chunkSummaries = nil
+			}
+			return s.storeDocument(ctx, job, content, cached.Summary, chunkSummaries)
+		})
+		s.finish(ctx, job, err)
+		return
+	}
+
+	err := s.runStep(ctx, job, models.StepExtract, func(ctx context.Context) error {
+		// Read the copy spooled on upload; later attempts, and jobs of
+		// other instances, download the file instead
+		if path, ok := s.spool.Path(job.StoragePath); ok {
+			var err error
+			if content, err = s.pdfService.ExtractTextFromFile(path, job.FileName); err == nil {
+				return nil
+			}
+		}
+
+		reader, _, err := s.storageService.GetFile(ctx, job.StoragePath)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		content, err = s.pdfService.ExtractTextFromReader(reader, job.FileName)
+		return err
+	})
+	if err == nil {
+		metrics.ObserveExtractedChars(content.CharCount())
+	}
+
+	if err == nil {
+		err = s.runStep(ctx, job, models.StepSummarize, func(ctx context.Context) error {
+			var err error
+			summary, chunkSummaries, err = s.aiService.GenerateSummary(ctx, job.TenantName, content.Text())
+			if err != nil {
+				// A missing summary should not fail the whole ingest
+				slog.WarnContext(ctx, "summarization failed", "error", err)
+				summary = summaryFailedMessage
+			}
+			return nil
+		})
+	}
+
+	if err == nil {
+		err = s.runStep(ctx, job, models.StepStore, func(ctx context.Context) error {
+			if !s.storeChunks {
+				chunkSummaries = nil
+			}
+			return s.storeDocument(ctx, job, content, summary, chunkSummaries)
+		})
+	}
+
+	s.finish(ctx, job, err)
+}
+
+// heartbeat extends the lease of a job until ctx is done, cancelling ctx
+// with ErrJobLost once the job was claimed by another worker
+func (s *IngestService) heartbeat(ctx context.Context, job *models.Job, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := s.postgresRepo.ExtendJobLease(ctx, job.ID, job.Attempts, jobLease)
+		switch {
+		case err == pgx.ErrNoRows:
+			cancel(ErrJobLost)
+			return
+		case err != nil && ctx.Err() == nil:
+			// The lease outlasts several heartbeats; try again on the next
+			slog.WarnContext(ctx, "failed to extend job lease", "error", err)
+		}
+	}
+}
+
+// cachedContent returns a stored version with the same content as job whose
+// extraction and summary can be reused, or nil
+func (s *IngestService) cachedContent(ctx context.Context, job *models.Job) *models.DocumentVersion {
+	if job.ContentHash == "" {
+		return nil
+	}
+	cached, err := s.mongoRepo.FindVersionByHash(ctx, job.TenantName, job.ContentHash)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			slog.WarnContext(ctx, "failed to look up cached content", "error", err)
+		}
+		return nil
+	}
+	if cached.Summary == "" || cached.Summary == summaryFailedMessage {
+		return nil
+	}
+	return cached
+}
+
+// storeDocument inserts the document under its pre-allocated ID, or adds a
+// version to it for new-version jobs. A duplicate key means an earlier
+// attempt already stored it, or that an identical upload won a race.
+func (s *IngestService) storeDocument(ctx context.Context, job *models.Job, content *PDFContent, summary string, chunkSummaries []models.ChunkSummary) error {
+	// A document with the same name may have been stored while this job
+	// was queued
+	if err := s.matchDocumentName(ctx, job); err != nil {
+		return err
+	}
+
+	id, err := primitive.ObjectIDFromHex(job.DocumentID)
+	if err != nil {
+		return fmt.Errorf("invalid document ID: %w", err)
+	}
+
+	version := &models.DocumentVersion{
+		DocumentID:     id,
+		JobID:          job.ID,
+		FileName:       job.FileName,
+		FileSize:       job.FileSize,
+		StoragePath:    job.StoragePath,
+		ContentHash:    job.ContentHash,
+		Pages:          content.Pages,
+		Metadata:       content.Metadata,
+		Summary:        summary,
+		ChunkSummaries: chunkSummaries,
+		Quarantine:     job.Quarantine,
+		UploadedAt:     job.CreatedAt,
+	}
+
+	if job.NewVersion {
+		err := s.mongoRepo.AddDocumentVersion(ctx, job.TenantName, version)
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("document %s no longer exists", job.DocumentID)
+		}
+		if err == nil {
+			job.Step(models.StepStore).Note = fmt.Sprintf("stored as version %d", version.Version)
+		}
+		return err
+	}
+
+	document := &models.Document{
+		ID:            id,
+		TenantName:    job.TenantName,
+		FileName:      job.FileName,
+		FileSize:      job.FileSize,
+		StoragePath:   job.StoragePath,
+		Pages:         content.Pages,
+		Metadata:      content.Metadata,
+		Summary:       summary,
+		UploadedAt:    job.CreatedAt,
+		IsDeleted:     false,
+		DeletedAt:     nil,
+
+		ChunkSummaries: chunkSummaries,
+		Quarantine:     job.Quarantine,
+		ContentHash:    job.ContentHash,
+		CurrentVersion: 1,
+	}
+
+	err = s.mongoRepo.InsertDocument(ctx, job.TenantName, document)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	if err != nil {
+		if _, getErr := s.mongoRepo.GetDocument(ctx, job.TenantName, id, false); getErr != mongo.ErrNoDocuments {
+			// Stored by an earlier attempt (or the lookup failed and the
+			// version insert below reports it)
+			err = nil
+		} else if existing, findErr := s.mongoRepo.FindDocumentByHash(ctx, job.TenantName, job.ContentHash); findErr == nil {
+			if existing.IsDeleted {
+				return fmt.Errorf("%w: content matches deleted document %s; restore it first", ErrDocumentConflict, existing.ID.Hex())
+			}
+			// An identical upload was stored first; point the job at it and
+			// its file
+			s.discardFile(ctx, job.StoragePath)
+			job.DocumentID = existing.ID.Hex()
+			job.StoragePath = existing.StoragePath
+			job.Step(models.StepStore).Note = "identical content was stored concurrently; using that document"
+			return nil
+		} else {
+			return err
+		}
+	}
+
+	version.Version = 1
+	return s.mongoRepo.InsertDocumentVersion(ctx, job.TenantName, version)
+}
+
+// runStep executes fn as the named step, recording status and timing and
+// persisting progress so GET /jobs/:id reflects it
+func (s *IngestService) runStep(ctx context.Context, job *models.Job, name string, fn func(ctx context.Context) error) error {
+	step := job.Step(name)
+	start := time.Now()
+	step.Status = models.StepStatusRunning
+	step.StartedAt = &start
+	if err := s.saveProgress(ctx, job, 0); errors.Is(err, ErrJobLost) {
+		return err
+	}
+
+	stepCtx, span := tracing.Start(logging.With(ctx, logging.KeyStage, name), "ingest."+name)
+	err := fn(stepCtx)
+	tracing.End(span, err)
+
+	end := time.Now()
+	step.FinishedAt = &end
+	step.DurationMs = end.Sub(start).Milliseconds()
+	metrics.ObserveIngestStep(name, err, end.Sub(start))
+	if err != nil {
+		step.Status = models.StepStatusFailed
+		step.Error = err.Error()
+		slog.WarnContext(stepCtx, "step failed", "duration_ms", step.DurationMs, "error", err)
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	step.Status = models.StepStatusCompleted
+	slog.InfoContext(stepCtx, "step completed", "duration_ms", step.DurationMs)
+	return nil
+}
+
+// finish records the outcome of an attempt, requeueing failed jobs with
+// backoff until maxJobAttempts is reached
+func (s *IngestService) finish(ctx context.Context, job *models.Job, err error) {
+	if errors.Is(err, ErrJobLost) || errors.Is(context.Cause(ctx), ErrJobLost) {
+		// The worker that claimed the job again records its outcome
+		tracing.RecordError(ctx, ErrJobLost)
+		slog.WarnContext(ctx, "job lease lost to another worker, abandoning attempt", "attempt", job.Attempts)
+		return
+	}
+
+	var retryAfter time.Duration
+	tracing.RecordError(ctx, err)
+
+	switch {
+	case err == nil:
+		now := time.Now()
+		job.Status = models.JobStatusSucceeded
+		job.FinishedAt = &now
+		slog.InfoContext(ctx, "job succeeded", logging.KeyDocumentID, job.DocumentID)
+	case job.Attempts < maxJobAttempts && !errors.Is(err, ErrDocumentConflict):
+		// Conflicts with a document's state fail at once; retrying cannot
+		// change them
+		job.Status = models.JobStatusQueued
+		job.Error = err.Error()
+		retryAfter = time.Duration(job.Attempts*job.Attempts) * 10 * time.Second
+		slog.WarnContext(ctx, "job failed, retrying", "attempt", job.Attempts, "retry_after", retryAfter.String(), "error", err)
+	default:
+		now := time.Now()
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+		job.FinishedAt = &now
+		slog.ErrorContext(ctx, "job failed", "attempts", job.Attempts, "error", err)
+	}
+
+	// The outcome event commits with the job's final state, and only if this
+	// worker still owns the job; webhooks are notified after it is saved so
+	// receivers see it when they look it up
+	eventType, data := jobOutcome(job)
+	var events []*models.OutboxEvent
+	if eventType != "" {
+		events = s.outbox.NewEvents(job.TenantName, eventType, data)
+	}
+	if err := s.saveProgress(ctx, job, retryAfter, events...); err != nil {
+		return
+	}
+
+	metrics.CountIngestJob(job.Status)
+	if job.Status == models.JobStatusFailed {
+		s.removeOrphanedFile(ctx, job)
+	}
+	if eventType != "" {
+		s.webhooks.Publish(ctx, job.TenantName, eventType, data)
+	}
+}
+
+// jobOutcome returns the event describing a finished job, or no event while
+// the job will be retried
+func jobOutcome(job *models.Job) (string, map[string]interface{}) {
+	switch job.Status {
+	case models.JobStatusSucceeded:
+		return models.EventDocumentIngested, map[string]interface{}{
+			"document_id": job.DocumentID,
+			"job_id":      job.ID,
+			"file_name":   job.FileName,
+			"new_version": job.NewVersion,
+			"quarantined": job.Quarantine != nil,
+		}
+	case models.JobStatusFailed:
+		return models.EventDocumentFailed, map[string]interface{}{
+			"document_id": job.DocumentID,
+			"job_id":      job.ID,
+			"file_name":   job.FileName,
+			"attempts":    job.Attempts,
+			"error":       job.Error,
+		}
+	default:
+		return "", nil
+	}
+}
+
+// removeOrphanedFile deletes the stored file of a failed job unless a
+// document or version referring to it was stored despite the error. For a new
+// version the document itself always exists, so the file is what counts.
+// Files left behind are removed by reconciliation.
+func (s *IngestService) removeOrphanedFile(ctx context.Context, job *models.Job) {
+	referenced, err := s.mongoRepo.FileReferenced(ctx, job.TenantName, job.StoragePath)
+	if err != nil || referenced {
+		return
+	}
+
+	if err := s.storageService.DeleteFile(ctx, job.StoragePath); err != nil {
+		slog.WarnContext(ctx, "failed to remove file of failed job", "storage_path", job.StoragePath, "error", err)
+	}
+}
+
+// saveProgress persists the job and extends its lease. Errors are logged:
+// the lease guarantees the job is retried if its state is lost. ErrJobLost
+// is returned once another worker claimed the job; nothing was saved.
+func (s *IngestService) saveProgress(ctx context.Context, job *models.Job, retryAfter time.Duration, events ...*models.OutboxEvent) error {
+	err := s.postgresRepo.UpdateJob(ctx, job, jobLease, retryAfter, events...)
+	if err == pgx.ErrNoRows {
+		err = ErrJobLost
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to update job", "error", err)
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxRelayBackoff caps how long the relay waits after failed publishes
+	maxRelayBackoff = time.Minute
+	// outboxPruneInterval is how often published events are pruned
+	outboxPruneInterval = time.Hour
+)
+
+// OutboxConfig configures the outbox relay
+type OutboxConfig struct {
+	PollInterval   time.Duration // how often the outbox is checked for new events
+	BatchSize      int           // events relayed per transaction
+	Retention      time.Duration // how long published events are kept
+	PublishTimeout time.Duration // per event
+}
+
+// OutboxService records events in the outbox of the master database along
+// with the changes they describe, and relays them to the event publisher.
+// Events are published at least once and in order per tenant. Without a
+// publisher no events are recorded.
+type OutboxService struct {
+	postgresRepo *repository.PostgresRepository
+	publisher    EventPublisher
+	config       OutboxConfig
+	// tenants limits the relay to these tenants' events; set by tests that
+	// share a database
+	tenants []string
+}
+
+// NewOutboxService creates a new outbox service. A nil publisher disables
+// the outbox.
+func NewOutboxService(postgresRepo *repository.PostgresRepository, publisher EventPublisher, config OutboxConfig) *OutboxService {
+	if config.BatchSize < 1 {
+		config.BatchSize = 1
+	}
+	return &OutboxService{
+		postgresRepo: postgresRepo,
+		publisher:    publisher,
+		config:       config,
+	}
+}
+
+// NewEvents returns the event to record in the transaction of a change, or
+// nil when the outbox is disabled. Repository methods that take events
+// commit them with the change.
+func (s *OutboxService) NewEvents(tenantName, eventType string, data map[string]interface{}) []*models.OutboxEvent {
+	if s.publisher == nil {
+		return nil
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("failed to encode event", "event", eventType, logging.KeyTenant, tenantName, "error", err)
+		return nil
+	}
+
+	return []*models.OutboxEvent{{
+		EventID:    uuid.New().String(),
+		Type:       eventType,
+		TenantName: tenantName,
+		Data:       encoded,
+	}}
+}
+
+// Record adds an event for a change made outside the master database, once
+// that change is done. The change cannot be undone, so failures are logged
+// rather than returned.
+func (s *OutboxService) Record(ctx context.Context, tenantName, eventType string, data map[string]interface{}) {
+	events := s.NewEvents(tenantName, eventType, data)
+	if len(events) == 0 {
+		return
+	}
+	if err := s.postgresRepo.AppendOutboxEvents(ctx, events...); err != nil {
+		slog.ErrorContext(ctx, "failed to record event", "event", eventType, logging.KeyTenant, tenantName, "error", err)
+	}
+}
+
+// Start launches the relay, which stops when ctx is cancelled. Only one
+// instance relays at a time; the others stand by.
+func (s *OutboxService) Start(ctx context.Context) {
+	if s.publisher == nil {
+		return
+	}
+
+	go func() {
+		defer s.publisher.Close()
+
+		backoff := s.config.PollInterval
+		lastPrune := time.Time{}
+		for {
+			published, failed, err := s.relay(ctx)
+			switch {
+			case err != nil && ctx.Err() == nil:
+				slog.ErrorContext(ctx, "outbox relay failed", "error", err)
+			case published > 0:
+				slog.DebugContext(ctx, "published outbox events", "count", published)
+			}
+
+			// Back off while the bus rejects events; keep draining while it
+			// accepts full batches
+			wait := s.config.PollInterval
+			switch {
+			case err != nil || failed:
+				backoff = min(backoff*2, maxRelayBackoff)
+				wait = backoff
+			case published == s.config.BatchSize:
+				backoff = s.config.PollInterval
+				wait = 0
+			default:
+				backoff = s.config.PollInterval
+			}
+
+			if time.Since(lastPrune) > outboxPruneInterval {
+				lastPrune = time.Now()
+				s.prune(ctx)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+	slog.Info("outbox relay started")
+}
+
+// relay publishes one batch of events, reporting whether any failed
+func (s *OutboxService) relay(ctx context.Context) (int, bool, error) {
+	failed := false
+	published, err := s.postgresRepo.RelayOutboxEvents(ctx, s.config.BatchSize, s.tenants, func(event *models.OutboxEvent) error {
+		publishCtx, cancel := context.WithTimeout(ctx, s.config.PublishTimeout)
+		defer cancel()
+
+		if err := s.publisher.Publish(publishCtx, event); err != nil {
+			failed = true
+			slog.WarnContext(ctx, "failed to publish event",
+				"event", event.Type, "sequence", event.Sequence, logging.KeyTenant, event.TenantName, "error", err)
+			return err
+		}
+		return nil
+	})
+	return published, failed, err
+}
+
+// prune removes events published longer ago than the retention period
+func (s *OutboxService) prune(ctx context.Context) {
+	removed, err := s.postgresRepo.DeletePublishedOutboxEvents(ctx, time.Now().Add(-s.config.Retention))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to prune outbox events", "error", err)
+		return
+	}
+	if removed > 0 {
+		slog.InfoContext(ctx, "pruned published outbox events", "count", removed)
+	}
+}
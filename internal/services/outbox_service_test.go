@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+)
+
+// newTestOutboxService returns an outbox service relaying the events of
+// tenants, and no others, to a MemoryPublisher. The tenants' rows are removed
+// when the test is done.
+func newTestOutboxService(t *testing.T, tenants ...string) (*OutboxService, *MemoryPublisher, *repository.PostgresRepository) {
+	t.Helper()
+
+	postgresRepo, pool := testPostgres(t)
+	cleanupTenants(t, pool, tenants...)
+
+	publisher := NewMemoryPublisher()
+	service := NewOutboxService(postgresRepo, publisher, OutboxConfig{BatchSize: 100, PublishTimeout: time.Second})
+	service.tenants = tenants
+	return service, publisher, postgresRepo
+}
+
+// publishedOf returns the published events of the given tenants as
+// tenant:sequence, in publish order
+func publishedOf(publisher *MemoryPublisher, tenants ...string) []string {
+	var published []string
+	for _, event := range publisher.Events() {
+		for _, tenant := range tenants {
+			if event.TenantName == tenant {
+				published = append(published, fmt.Sprintf("%s:%d", tenant, event.Sequence))
+			}
+		}
+	}
+	return published
+}
+
+// TestRelayOutboxEventsHoldsBackTenant fails one event and checks that the
+// later events of its tenant wait for it while other tenants carry on
+func TestRelayOutboxEventsHoldsBackTenant(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	a, b := fmt.Sprintf("outbox_a_%d", suffix), fmt.Sprintf("outbox_b_%d", suffix)
+	service, publisher, _ := newTestOutboxService(t, a, b)
+	ctx := context.Background()
+	for _, tenant := range []string{a, b, a, b, a} {
+		service.Record(ctx, tenant, models.EventDocumentIngested, nil)
+	}
+
+	publisher.Fail = func(event *models.OutboxEvent) error {
+		if event.TenantName == a && event.Sequence == 2 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}
+	if _, failed, err := service.relay(ctx); err != nil || !failed {
+		t.Fatalf("relay: failed %v, error %v", failed, err)
+	}
+	want := []string{a + ":1", b + ":1", b + ":2"}
+	if got := publishedOf(publisher, a, b); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("published %v, want %v", got, want)
+	}
+
+	publisher.Fail = nil
+	if _, failed, err := service.relay(ctx); err != nil || failed {
+		t.Fatalf("relay: failed %v, error %v", failed, err)
+	}
+	want = append(want, a+":2", a+":3")
+	if got := publishedOf(publisher, a, b); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+// TestWithOutboxAtomicity checks that events are recorded exactly when the
+// change they describe commits
+func TestWithOutboxAtomicity(t *testing.T) {
+	suffix := time.Now().UnixNano()
+	missing, existing := fmt.Sprintf("outbox_missing_%d", suffix), fmt.Sprintf("outbox_existing_%d", suffix)
+	service, publisher, postgresRepo := newTestOutboxService(t, missing, existing)
+	ctx := context.Background()
+
+	// The change fails, so its event must not be recorded
+	err := postgresRepo.DeleteTenant(ctx, missing, service.NewEvents(missing, models.EventTenantDeleted, nil)...)
+	if err == nil {
+		t.Fatal("expected deleting a missing tenant to fail")
+	}
+
+	tenant := &models.Tenant{TenantName: existing, DBName: existing, Status: models.TenantStatusActive}
+	if err := postgresRepo.CreateTenant(ctx, tenant); err != nil {
+		t.Fatal(err)
+	}
+	if err := postgresRepo.DeleteTenant(ctx, existing, service.NewEvents(existing, models.EventTenantDeleted, nil)...); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := service.relay(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := publishedOf(publisher, missing); len(got) != 0 {
+		t.Errorf("published %v for a change that was rolled back", got)
+	}
+	if got, want := publishedOf(publisher, existing), []string{existing + ":1"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
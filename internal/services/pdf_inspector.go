@@ -0,0 +1,272 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PDF validation error and finding codes returned to clients
+const (
+	PDFCodeNotPDF       = "PDF_NOT_PDF"
+	PDFCodeMalformed    = "PDF_MALFORMED"
+	PDFCodeEncrypted    = "PDF_ENCRYPTED"
+	PDFCodeJavaScript   = "PDF_JAVASCRIPT"
+	PDFCodeLaunchAction = "PDF_LAUNCH_ACTION"
+	PDFCodeEmbeddedFile = "PDF_EMBEDDED_FILE"
+)
+
+const (
+	// headerWindow is how far into the file the %PDF- header may appear
+	headerWindow = 1024
+	// trailerWindow is how much of the file end is searched for startxref and %%EOF
+	trailerWindow = 2048
+	// maxInflatedStream and maxInflatedTotal bound decompression while scanning
+	maxInflatedStream = 10 * 1024 * 1024
+	maxInflatedTotal  = 100 * 1024 * 1024
+	// scanWindow is how much of the file or an inflated stream is held in
+	// memory while scanning; consecutive windows overlap by scanOverlap bytes
+	// so names and stream markers split across a boundary are seen whole
+	scanWindow  = 1024 * 1024
+	scanOverlap = 256
+	// xrefWindow is how much is read at the startxref offset
+	xrefWindow = 256
+)
+
+// PDF security policies for files with risky features
+const (
+	PDFPolicyReject     = "reject"
+	PDFPolicyQuarantine = "quarantine"
+)
+
+// PDFValidationError is returned when a file is not a structurally valid PDF,
+// or when it has risky features and the policy is to reject them
+type PDFValidationError struct {
+	Code     string
+	Reason   string
+	Findings []PDFFinding // set when rejected for unsafe content
+}
+
+func (e *PDFValidationError) Error() string {
+	return e.Reason
+}
+
+// PDFFinding is a potentially dangerous feature found in a PDF
+type PDFFinding struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// riskyNames maps PDF name objects to the finding they indicate
+var riskyNames = map[string]PDFFinding{
+	"Encrypt":       {Code: PDFCodeEncrypted, Reason: "document is encrypted"},
+	"JavaScript":    {Code: PDFCodeJavaScript, Reason: "document contains embedded JavaScript"},
+	"JS":            {Code: PDFCodeJavaScript, Reason: "document contains embedded JavaScript"},
+	"Launch":        {Code: PDFCodeLaunchAction, Reason: "document contains a launch action"},
+	"EmbeddedFile":  {Code: PDFCodeEmbeddedFile, Reason: "document contains embedded files"},
+	"EmbeddedFiles": {Code: PDFCodeEmbeddedFile, Reason: "document contains embedded files"},
+}
+
+var (
+	pdfNamePattern   = regexp.MustCompile(`/[^\s/<>\[\]()%{}]+`)
+	xrefObjPattern   = regexp.MustCompile(`^\d+\s+\d+\s+obj`)
+	streamPattern    = regexp.MustCompile(`stream\r?\n`)
+	pdfVersionPrefix = []byte("%PDF-")
+)
+
+// InspectPDF validates the structure of a PDF of size bytes read from r and
+// reports risky features. The file is scanned window by window rather than
+// loaded into memory. A *PDFValidationError is returned when the file is not
+// a usable PDF.
+func InspectPDF(r io.ReaderAt, size int64) ([]PDFFinding, error) {
+	if err := checkPDFStructure(r, size); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var findings []PDFFinding
+	collect := func(window []byte, last bool) {
+		for _, finding := range scanPDFNames(window, last) {
+			if !seen[finding.Code] {
+				seen[finding.Code] = true
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	// Dictionaries may be hidden in compressed object streams, so scan the
+	// raw bytes and every stream that inflates
+	inflated := int64(0)
+	lastStream := int64(-1)
+	_, err := scanWindows(io.NewSectionReader(r, 0, size), func(window []byte, offset int64, last bool) {
+		collect(window, last)
+		for _, loc := range streamPattern.FindAllIndex(window, -1) {
+			start := offset + int64(loc[0])
+			if start <= lastStream || inflated >= maxInflatedTotal {
+				continue // seen in the overlap of the previous window
+			}
+			lastStream = start
+			if bytes.HasSuffix(window[:loc[0]], []byte("end")) {
+				continue
+			}
+			body := offset + int64(loc[1])
+			inflated += inflate(io.NewSectionReader(r, body, size-body), maxInflatedTotal-inflated, collect)
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file: %w", err)
+	}
+
+	return findings, nil
+}
+
+// checkPDFStructure verifies the header, the %%EOF marker and that startxref
+// points at a cross-reference table or stream
+func checkPDFStructure(r io.ReaderAt, size int64) error {
+	head, err := readWindow(r, 0, headerWindow)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(head, pdfVersionPrefix) {
+		return &PDFValidationError{Code: PDFCodeNotPDF, Reason: fmt.Sprintf("no %%PDF- header in the first %d bytes", headerWindow)}
+	}
+
+	tail, err := readWindow(r, max(size-trailerWindow, 0), trailerWindow)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return &PDFValidationError{Code: PDFCodeMalformed, Reason: "missing %%EOF marker"}
+	}
+
+	i := bytes.LastIndex(tail, []byte("startxref"))
+	if i < 0 {
+		return &PDFValidationError{Code: PDFCodeMalformed, Reason: "missing startxref"}
+	}
+	fields := strings.Fields(string(tail[i+len("startxref"):]))
+	if len(fields) == 0 {
+		return &PDFValidationError{Code: PDFCodeMalformed, Reason: "missing startxref offset"}
+	}
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || offset < 0 || offset >= size {
+		return &PDFValidationError{Code: PDFCodeMalformed, Reason: "startxref offset is out of range"}
+	}
+
+	xref, err := readWindow(r, offset, xrefWindow)
+	if err != nil {
+		return err
+	}
+	xref = bytes.TrimLeft(xref, " \t\r\n\f\x00")
+	if !bytes.HasPrefix(xref, []byte("xref")) && !xrefObjPattern.Match(xref) {
+		return &PDFValidationError{Code: PDFCodeMalformed, Reason: "startxref does not point to a cross-reference table"}
+	}
+
+	return nil
+}
+
+// readWindow reads up to n bytes of r at offset, fewer at the end of the file
+func readWindow(r io.ReaderAt, offset, n int64) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := r.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to read file: %w", err)
+	}
+	return buf[:read], nil
+}
+
+// scanWindows reads src window by window, passing each window, the offset of
+// its start in src and whether it is the last one to fn. It returns the
+// number of bytes read from src.
+func scanWindows(src io.Reader, fn func(window []byte, offset int64, last bool)) (int64, error) {
+	buf := make([]byte, scanWindow)
+	filled := 0
+	offset := int64(0)
+	for {
+		n, err := io.ReadFull(src, buf[filled:])
+		filled += n
+		last := err != nil
+		fn(buf[:filled], offset, last)
+		if last {
+			total := offset + int64(filled)
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = nil
+			}
+			return total, err
+		}
+
+		copy(buf, buf[filled-scanOverlap:filled])
+		offset += int64(filled - scanOverlap)
+		filled = scanOverlap
+	}
+}
+
+// scanPDFNames returns findings for risky name objects in window. Names are
+// decoded first so obfuscations such as /J#61vaScript are caught. Unless the
+// window is the last one, a name running into its end is left to the next
+// window, which holds it whole.
+func scanPDFNames(window []byte, last bool) []PDFFinding {
+	var findings []PDFFinding
+	for _, loc := range pdfNamePattern.FindAllIndex(window, -1) {
+		if loc[1] == len(window) && !last {
+			continue
+		}
+		raw := window[loc[0]:loc[1]]
+		if finding, ok := riskyNames[decodePDFName(raw[1:])]; ok {
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// decodePDFName resolves #xx hex escapes in a PDF name
+func decodePDFName(name []byte) string {
+	if !bytes.Contains(name, []byte("#")) {
+		return string(name)
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if v, err := strconv.ParseUint(string(name[i+1:i+3]), 16, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// inflate decompresses the zlib stream at the start of body and passes its
+// output to scan window by window, returning the number of bytes inflated.
+// Streams that are not compressed are skipped, and output is capped to guard
+// against decompression bombs.
+func inflate(body io.Reader, limit int64, scan func(window []byte, last bool)) int64 {
+	if limit > maxInflatedStream {
+		limit = maxInflatedStream
+	}
+	r, err := zlib.NewReader(body)
+	if err != nil {
+		return 0
+	}
+	defer r.Close()
+
+	// Truncated or corrupt streams still yield their readable prefix
+	n, _ := scanWindows(io.LimitReader(r, limit), func(window []byte, _ int64, last bool) {
+		scan(window, last)
+	})
+	return n
+}
+
+// describeFindings joins the reasons of findings into one message
+func describeFindings(findings []PDFFinding) string {
+	reasons := make([]string, len(findings))
+	for i, f := range findings {
+		reasons[i] = f.Reason
+	}
+	return fmt.Sprintf("unsafe PDF: %s", strings.Join(reasons, "; "))
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a minimal PDF with body between the header and a
+// cross-reference table that startxref points at
+func buildPDF(header, body string) []byte {
+	doc := header + body
+	return []byte(doc + fmt.Sprintf("xref\n0 1\n0000000000 65535 f \ntrailer\n<< /Size 1 >>\nstartxref\n%d\n%%%%EOF\n", len(doc)))
+}
+
+// deflate compresses s as a PDF FlateDecode stream body
+func deflate(s string) string {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write([]byte(s))
+	w.Close()
+	return buf.String()
+}
+
+// streamObject wraps body in a stream object
+func streamObject(body string) string {
+	return fmt.Sprintf("1 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream\nendobj\n", len(body), body)
+}
+
+func inspect(data []byte) ([]PDFFinding, error) {
+	return InspectPDF(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestInspectPDFStructure(t *testing.T) {
+	valid := buildPDF("%PDF-1.7\n", "1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+
+	tests := []struct {
+		name string
+		data []byte
+		code string // empty when the file is valid
+	}{
+		{"valid", valid, ""},
+		{"header after leading bytes", buildPDF(strings.Repeat(" ", 100)+"%PDF-1.4\n", ""), ""},
+		{"header past the window", buildPDF(strings.Repeat(" ", headerWindow)+"%PDF-1.4\n", ""), PDFCodeNotPDF},
+		{"no header", buildPDF("", "hello"), PDFCodeNotPDF},
+		{"empty", nil, PDFCodeNotPDF},
+		{"missing EOF", bytes.TrimSuffix(valid, []byte("%%EOF\n")), PDFCodeMalformed},
+		{"missing startxref", []byte("%PDF-1.7\nxref\n%%EOF\n"), PDFCodeMalformed},
+		{"missing startxref offset", []byte("%PDF-1.7\nxref\nstartxref\n%%EOF\n"), PDFCodeMalformed},
+		{"startxref out of range", []byte("%PDF-1.7\nxref\nstartxref\n99999\n%%EOF\n"), PDFCodeMalformed},
+		{"startxref not at a table", []byte("%PDF-1.7\nxref\nstartxref\n0\n%%EOF\n"), PDFCodeMalformed},
+		{"cross-reference stream", []byte("%PDF-1.7\n1 0 obj\n<< /Type /XRef >>\nendobj\nstartxref\n9\n%%EOF\n"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := inspect(tt.data)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var validationErr *PDFValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if validationErr.Code != tt.code {
+				t.Errorf("code = %s (%s), want %s", validationErr.Code, validationErr.Reason, tt.code)
+			}
+		})
+	}
+}
+
+func TestInspectPDFFindings(t *testing.T) {
+	// A name that straddles the boundary of the first scan window
+	straddling := strings.Repeat(" ", scanWindow-len("%PDF-1.7\n")-4) + "/JavaScript "
+
+	tests := []struct {
+		name  string
+		body  string
+		codes []string
+	}{
+		{"clean", "1 0 obj\n<< /Type /Catalog >>\nendobj\n", nil},
+		{"encrypted", "trailer\n<< /Encrypt 5 0 R >>\n", []string{PDFCodeEncrypted}},
+		{"javascript", "1 0 obj\n<< /S /JavaScript /JS (app.alert(1)) >>\nendobj\n", []string{PDFCodeJavaScript}},
+		{"hex escaped name", "1 0 obj\n<< /S /J#61vaScript >>\nendobj\n", []string{PDFCodeJavaScript}},
+		{"launch and embedded file", "<< /S /Launch >>\n<< /EmbeddedFiles 3 0 R >>\n", []string{PDFCodeLaunchAction, PDFCodeEmbeddedFile}},
+		{"similar names", "<< /JSON 1 /Launcher 2 /EncryptMetadata false >>\n", nil},
+		{"in a compressed stream", streamObject(deflate("<< /OpenAction << /S /JavaScript >> >>")), []string{PDFCodeJavaScript}},
+		{"uncompressed stream", streamObject("BT /F1 12 Tf (hello) Tj ET"), nil},
+		{"across a scan window", straddling, []string{PDFCodeJavaScript}},
+		{"across an inflated scan window", streamObject(deflate(straddling)), []string{PDFCodeJavaScript}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings, err := inspect(buildPDF("%PDF-1.7\n", tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var codes []string
+			for _, f := range findings {
+				codes = append(codes, f.Code)
+			}
+			if strings.Join(codes, ",") != strings.Join(tt.codes, ",") {
+				t.Errorf("findings = %v, want %v", codes, tt.codes)
+			}
+		})
+	}
+}
+
+func TestInflateLimits(t *testing.T) {
+	bomb := deflate(strings.Repeat("\x00", maxInflatedStream+scanWindow) + "/JavaScript")
+
+	tests := []struct {
+		name  string
+		body  string
+		limit int64
+		want  int64
+		found bool // whether the /JavaScript name is within the limit
+	}{
+		{"not compressed", "plain text", maxInflatedTotal, 0, false},
+		{"small stream", deflate("<< /S /JavaScript >>"), maxInflatedTotal, 20, true},
+		{"capped per stream", bomb, maxInflatedTotal, maxInflatedStream, false},
+		{"capped by the remaining total", bomb, 1000, 1000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found := false
+			n := inflate(strings.NewReader(tt.body), tt.limit, func(window []byte, last bool) {
+				found = found || len(scanPDFNames(window, last)) > 0
+			})
+			if n != tt.want {
+				t.Errorf("inflated %d bytes, want %d", n, tt.want)
+			}
+			if found != tt.found {
+				t.Errorf("found = %v, want %v", found, tt.found)
+			}
+		})
+	}
+
+	// Streams past the total inflate budget are not inflated at all
+	var body strings.Builder
+	stream := streamObject(deflate(strings.Repeat("\x00", maxInflatedStream)))
+	for range maxInflatedTotal / maxInflatedStream {
+		body.WriteString(stream)
+	}
+	body.WriteString(streamObject(deflate("/JavaScript")))
+	findings, err := inspect(buildPDF("%PDF-1.7\n", body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("findings = %v, want none past the total inflate limit", findings)
+	}
+}
@@ -3,98 +3,258 @@ package services
 import (
 	"fmt"
 	"io"
-	"mime/multipart"
 	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/bacancy/droadmap/internal/models"
 	"github.com/ledongthuc/pdf"
 )
 
+// PageBreak separates pages in extracted text
+const PageBreak = models.PageBreak
+
+// maxPDFSize is the largest accepted upload
+const maxPDFSize = 50 * 1024 * 1024
+
 // PDFService handles PDF processing operations
-type PDFService struct{}
+type PDFService struct {
+	securityPolicy string
+}
 
-// NewPDFService creates a new PDF service
-func NewPDFService() *PDFService {
-	return &PDFService{}
+// NewPDFService creates a new PDF service. securityPolicy decides whether
+// files with risky features are rejected or quarantined.
+func NewPDFService(securityPolicy string) *PDFService {
+	if securityPolicy != PDFPolicyQuarantine {
+		securityPolicy = PDFPolicyReject
+	}
+	return &PDFService{securityPolicy: securityPolicy}
 }
 
-// ExtractText extracts text content from a PDF file
-func (s *PDFService) ExtractText(file *multipart.FileHeader) (string, error) {
-	// Open the uploaded file
+// InspectFile validates the content of an uploaded PDF. It returns a
+// *PDFValidationError for malformed files, and for risky files under the
+// reject policy. Under the quarantine policy risky files are accepted and the
+// returned quarantine record explains why.
+func (s *PDFService) InspectFile(file *FileUpload) (*models.Quarantine, error) {
 	src, err := file.Open()
 	if err != nil {
-		return "", fmt.Errorf("unable to open file: %w", err)
+		return nil, fmt.Errorf("unable to open file: %w", err)
 	}
 	defer src.Close()
 
-	// Create a temporary file
+	// Spooled uploads and multipart form files are inspected in place;
+	// archive entries have no random access, so copy them to a temp file
+	r, size := io.ReaderAt(nil), file.Size
+	if ra, ok := src.(io.ReaderAt); ok {
+		r = ra
+	} else {
+		tmpFile, err := os.CreateTemp("", "inspect-*.pdf")
+		if err != nil {
+			return nil, fmt.Errorf("unable to create temp file: %w", err)
+		}
+		defer os.Remove(tmpFile.Name())
+		defer tmpFile.Close()
+
+		size, err = io.Copy(tmpFile, io.LimitReader(src, maxPDFSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("unable to copy file: %w", err)
+		}
+		r = tmpFile
+	}
+
+	findings, err := InspectPDF(r, size)
+	if err != nil || len(findings) == 0 {
+		return nil, err
+	}
+
+	if s.securityPolicy == PDFPolicyReject {
+		return nil, &PDFValidationError{
+			Code:     findings[0].Code,
+			Reason:   describeFindings(findings),
+			Findings: findings,
+		}
+	}
+
+	quarantine := &models.Quarantine{Reason: describeFindings(findings)}
+	for _, f := range findings {
+		quarantine.Codes = append(quarantine.Codes, f.Code)
+	}
+	return quarantine, nil
+}
+
+// PDFContent holds the text and metadata extracted from a PDF
+type PDFContent struct {
+	Pages    []models.PDFPage
+	Metadata models.PDFMetadata
+}
+
+// Text returns the page texts separated by PageBreak
+func (c *PDFContent) Text() string {
+	doc := models.Document{Pages: c.Pages}
+	if text := doc.PageText(); strings.TrimSpace(text) != "" {
+		return text
+	}
+	return c.Metadata.ExtractionNote
+}
+
+// CharCount returns the number of characters extracted from all pages
+func (c *PDFContent) CharCount() int {
+	count := 0
+	for _, page := range c.Pages {
+		count += page.CharCount
+	}
+	return count
+}
+
+// ExtractTextFromReader extracts per-page text and the Info dictionary from a
+// PDF read from src, such as an object streamed back from storage
+func (s *PDFService) ExtractTextFromReader(src io.Reader, fileName string) (*PDFContent, error) {
+	// The parser needs random access, so copy the stream to a temporary file
 	tmpFile, err := os.CreateTemp("", "upload-*.pdf")
 	if err != nil {
-		return "", fmt.Errorf("unable to create temp file: %w", err)
+		return nil, fmt.Errorf("unable to create temp file: %w", err)
 	}
 	defer os.Remove(tmpFile.Name())
 	defer tmpFile.Close()
 
-	// Copy uploaded file to temp file
 	if _, err := io.Copy(tmpFile, src); err != nil {
-		return "", fmt.Errorf("unable to copy file: %w", err)
+		return nil, fmt.Errorf("unable to copy file: %w", err)
 	}
 
 	// Close temp file before reading (required for pdf.Open)
 	tmpFile.Close()
 
+	return s.ExtractTextFromFile(tmpFile.Name(), fileName)
+}
+
+// ExtractTextFromFile extracts per-page text and the Info dictionary from a
+// PDF on local disk, such as a spooled upload
+func (s *PDFService) ExtractTextFromFile(path, fileName string) (*PDFContent, error) {
+	content := &PDFContent{}
+
 	// Read PDF content
-	f, reader, err := pdf.Open(tmpFile.Name())
+	f, reader, err := pdf.Open(path)
 	if err != nil {
-		// If PDF cannot be opened, return a placeholder text
-		// This handles encrypted, corrupted, or unsupported PDFs
-		return fmt.Sprintf("PDF file: %s (Text extraction not available - PDF may be scanned, encrypted, or in unsupported format)", file.Filename), nil
+		// Structure was validated on upload, so this is an unsupported
+		// feature of an otherwise valid PDF; record why instead of failing
+		content.Metadata.ExtractionNote = fmt.Sprintf("PDF file: %s (Text extraction not available: %v)", fileName, err)
+		return content, nil
 	}
 	defer f.Close()
 
-	// Extract text from all pages
-	var textBuilder strings.Builder
+	content.Metadata = readPDFInfo(reader)
+
+	// Extract text from all pages, keeping a slot for unreadable pages so
+	// page numbers stay aligned with the PDF
 	numPages := reader.NumPage()
+	content.Metadata.PageCount = numPages
+	content.Pages = make([]models.PDFPage, 0, numPages)
 
+	hasText := false
 	for i := 1; i <= numPages; i++ {
-		page := reader.Page(i)
-		if page.V.IsNull() {
-			continue
-		}
+		page := models.PDFPage{Number: i}
 
-		text, err := page.GetPlainText(nil)
-		if err != nil {
+		p := reader.Page(i)
+		if !p.V.IsNull() {
 			// Skip pages that fail to extract
-			continue
+			if text, err := p.GetPlainText(nil); err == nil {
+				page.Text = strings.TrimSpace(text)
+				page.CharCount = utf8.RuneCountInString(page.Text)
+			}
+		}
+
+		if page.CharCount > 0 {
+			hasText = true
 		}
+		content.Pages = append(content.Pages, page)
+	}
+
+	// If no text could be extracted, record a note
+	if !hasText {
+		content.Metadata.ExtractionNote = fmt.Sprintf("PDF file: %s (No text content found - PDF may be image-based or scanned)", fileName)
+	}
+
+	return content, nil
+}
+
+// readPDFInfo reads the document Info dictionary from the trailer
+func readPDFInfo(reader *pdf.Reader) models.PDFMetadata {
+	info := reader.Trailer().Key("Info")
+	if info.IsNull() {
+		return models.PDFMetadata{}
+	}
+
+	metadata := models.PDFMetadata{
+		Title:    strings.TrimSpace(info.Key("Title").Text()),
+		Author:   strings.TrimSpace(info.Key("Author").Text()),
+		Subject:  strings.TrimSpace(info.Key("Subject").Text()),
+		Producer: strings.TrimSpace(info.Key("Producer").Text()),
+	}
+
+	if created, ok := parsePDFDate(info.Key("CreationDate").Text()); ok {
+		metadata.CreationDate = &created
+	}
 
-		textBuilder.WriteString(text)
-		textBuilder.WriteString("\n")
+	return metadata
+}
+
+// parsePDFDate parses a PDF date string such as "D:20230115093000+05'30'".
+// Trailing components are optional per the PDF specification.
+func parsePDFDate(value string) (time.Time, bool) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "D:")
+	if len(value) < 4 {
+		return time.Time{}, false
+	}
+
+	// Split the digits from the timezone suffix (Z, + or -)
+	digits := value
+	zone := ""
+	if i := strings.IndexAny(value, "Z+-"); i >= 0 {
+		digits, zone = value[:i], value[i:]
 	}
 
-	extractedText := strings.TrimSpace(textBuilder.String())
-	
-	// If no text could be extracted, return a placeholder
-	if extractedText == "" {
-		return fmt.Sprintf("PDF file: %s (No text content found - PDF may be image-based or scanned)", file.Filename), nil
+	layouts := map[int]string{4: "2006", 6: "200601", 8: "20060102", 10: "2006010215", 12: "200601021504", 14: "20060102150405"}
+	layout, ok := layouts[len(digits)]
+	if !ok {
+		return time.Time{}, false
 	}
 
-	return extractedText, nil
+	loc := time.UTC
+	zone = strings.ReplaceAll(zone, "'", "")
+	if len(zone) == 5 && (zone[0] == '+' || zone[0] == '-') {
+		if offset, err := time.Parse("-0700", zone); err == nil {
+			loc = offset.Location()
+		}
+	}
+
+	t, err := time.ParseInLocation(layout, digits, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ValidateFileName checks the extension of a file before its content is read
+func (s *PDFService) ValidateFileName(fileName string) error {
+	if !strings.HasSuffix(strings.ToLower(fileName), ".pdf") {
+		return fmt.Errorf("file must be a PDF")
+	}
+	return nil
 }
 
 // ValidatePDF checks if the file is a valid PDF
-func (s *PDFService) ValidatePDF(file *multipart.FileHeader) error {
+func (s *PDFService) ValidatePDF(file *FileUpload) error {
 	if file == nil {
 		return fmt.Errorf("file is required")
 	}
 
-	// Check file extension
-	if !strings.HasSuffix(strings.ToLower(file.Filename), ".pdf") {
-		return fmt.Errorf("file must be a PDF")
+	if err := s.ValidateFileName(file.Filename); err != nil {
+		return err
 	}
 
 	// Check file size (max 50MB)
-	if file.Size > 50*1024*1024 {
+	if file.Size > maxPDFSize {
 		return fmt.Errorf("file size must be less than 50MB")
 	}
 
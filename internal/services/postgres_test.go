@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testPostgres connects to the database named by TEST_POSTGRES_DSN, skipping
+// the test when it is not set, e.g.
+//
+//	TEST_POSTGRES_DSN="host=localhost port=5433 user=postgres password=postgres123 dbname=master_db sslmode=disable"
+//
+// The returned pool is for cleaning up rows the repository only soft-deletes.
+func testPostgres(t *testing.T) (*repository.PostgresRepository, *pgxpool.Pool) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN must be set to run against a real database")
+	}
+
+	postgresRepo, err := repository.NewPostgresRepository(dsn)
+	if err != nil {
+		t.Fatalf("connect to PostgreSQL: %v", err)
+	}
+	t.Cleanup(postgresRepo.Close)
+	if err := postgresRepo.InitSchema(context.Background()); err != nil {
+		t.Fatalf("init schema: %v", err)
+	}
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect to PostgreSQL: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return postgresRepo, pool
+}
+
+// cleanupTenants removes the tenant rows and outbox events of tenants once
+// the test is done
+func cleanupTenants(t *testing.T, pool *pgxpool.Pool, tenants ...string) {
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for _, query := range []string{
+			`DELETE FROM outbox_events WHERE tenant_name = ANY($1)`,
+			`DELETE FROM outbox_sequences WHERE tenant_name = ANY($1)`,
+			`DELETE FROM tenants WHERE tenant_name = ANY($1)`,
+		} {
+			if _, err := pool.Exec(ctx, query, tenants); err != nil {
+				t.Errorf("clean up tenants: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+// reaperActor identifies purges made by the background reaper in the audit log
+const reaperActor = "system:reaper"
+
+// ErrTenantNotDeleted is returned when purging a tenant that is not soft-deleted
+var ErrTenantNotDeleted = errors.New("tenant is not soft-deleted")
+
+// PurgeService permanently removes soft-deleted tenants: their database,
+// their stored files and their jobs and keys
+type PurgeService struct {
+	postgresRepo   *repository.PostgresRepository
+	mongoRepo      *repository.MongoRepository
+	storageService *StorageService
+	auditService   *AuditService
+	retention      time.Duration
+	interval       time.Duration
+	dryRun         bool
+}
+
+// NewPurgeService creates a purge service. Tenants soft-deleted longer than
+// retention are purged by the reaper every interval; in dry-run mode the
+// reaper only reports what it would purge.
+func NewPurgeService(
+	postgresRepo *repository.PostgresRepository,
+	mongoRepo *repository.MongoRepository,
+	storageService *StorageService,
+	auditService *AuditService,
+	retention, interval time.Duration,
+	dryRun bool,
+) *PurgeService {
+	return &PurgeService{
+		postgresRepo:   postgresRepo,
+		mongoRepo:      mongoRepo,
+		storageService: storageService,
+		auditService:   auditService,
+		retention:      retention,
+		interval:       interval,
+		dryRun:         dryRun,
+	}
+}
+
+// PurgeTenant permanently removes a soft-deleted tenant regardless of the
+// retention period. With dryRun it only reports what would be removed.
+func (s *PurgeService) PurgeTenant(ctx context.Context, tenantName string, dryRun bool) (*models.TenantPurge, error) {
+	tenant, err := s.postgresRepo.GetDeletedTenant(ctx, tenantName)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrTenantNotDeleted, tenantName)
+		}
+		return nil, fmt.Errorf("error checking tenant: %w", err)
+	}
+
+	if dryRun {
+		return s.inspect(ctx, tenant, true), nil
+	}
+	return s.purge(ctx, tenant.TenantName)
+}
+
+// Report lists the tenants the reaper would purge now and what they hold
+func (s *PurgeService) Report(ctx context.Context) (*models.PurgeReport, error) {
+	return s.reap(ctx, true)
+}
+
+// Reap purges every tenant soft-deleted longer than the retention period,
+// or only reports them in dry-run mode
+func (s *PurgeService) Reap(ctx context.Context) (*models.PurgeReport, error) {
+	return s.reap(ctx, s.dryRun)
+}
+
+// StartReaper runs Reap every interval until ctx is cancelled
+func (s *PurgeService) StartReaper(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			report, err := s.Reap(ctx)
+			if err != nil {
+				slog.ErrorContext(ctx, "tenant reaper failed", "error", err)
+				continue
+			}
+			for _, purge := range report.Tenants {
+				switch {
+				case purge.Error != "":
+					slog.ErrorContext(ctx, "failed to purge tenant", logging.KeyTenant, purge.TenantName, "error", purge.Error)
+				case purge.DryRun:
+					slog.InfoContext(ctx, "would purge tenant (dry run)", logging.KeyTenant, purge.TenantName,
+						"documents", purge.Documents, "objects", purge.Objects, "storage_bytes", purge.StorageBytes)
+				default:
+					slog.InfoContext(ctx, "purged tenant", logging.KeyTenant, purge.TenantName,
+						"documents", purge.Documents, "objects", purge.Objects)
+				}
+			}
+		}
+	}()
+}
+
+func (s *PurgeService) reap(ctx context.Context, dryRun bool) (*models.PurgeReport, error) {
+	cutoff := time.Now().Add(-s.retention)
+	tenants, err := s.postgresRepo.ListTenantsDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.PurgeReport{
+		Retention: s.retention.String(),
+		Cutoff:    cutoff,
+		DryRun:    dryRun,
+		Tenants:   []models.TenantPurge{},
+	}
+	for i := range tenants {
+		if dryRun {
+			report.Tenants = append(report.Tenants, *s.inspect(ctx, &tenants[i], true))
+			continue
+		}
+
+		purge, err := s.purge(ctx, tenants[i].TenantName)
+		if err != nil {
+			purge = s.inspect(ctx, &tenants[i], false)
+			purge.Error = err.Error()
+		} else {
+			s.auditService.Record(ctx, &models.AuditLog{
+				TenantName:   purge.TenantName,
+				Action:       models.AuditTenantPurge,
+				ResourceType: "tenant",
+				ResourceID:   purge.TenantName,
+				Actor:        reaperActor,
+				Diff:         map[string]models.AuditChange{"status": {Old: tenants[i].Status, New: models.TenantStatusPurged}},
+				Details: map[string]interface{}{
+					"documents": purge.Documents,
+					"objects":   purge.Objects,
+					"retention": report.Retention,
+				},
+			})
+		}
+		report.Tenants = append(report.Tenants, *purge)
+	}
+
+	return report, nil
+}
+
+// inspect reports what a tenant holds. Counting errors are reported on the
+// result rather than failing the whole report.
+func (s *PurgeService) inspect(ctx context.Context, tenant *models.Tenant, dryRun bool) *models.TenantPurge {
+	purge := &models.TenantPurge{
+		TenantName: tenant.TenantName,
+		DBName:     tenant.DBName,
+		DeletedAt:  tenant.DeletedAt,
+		DryRun:     dryRun,
+	}
+	if tenant.DeletedAt != nil {
+		purgeAfter := tenant.DeletedAt.Add(s.retention)
+		purge.PurgeAfter = &purgeAfter
+	}
+
+	usage, err := s.mongoRepo.DocumentUsage(ctx, tenant.TenantName)
+	if err != nil {
+		purge.Error = err.Error()
+	}
+	purge.Documents = usage.Documents
+
+	purge.Objects, purge.StorageBytes, err = s.storageService.PrefixUsage(ctx, tenantPrefix(tenant.TenantName))
+	if err != nil && purge.Error == "" {
+		purge.Error = err.Error()
+	}
+
+	return purge
+}
+
+// purge claims a tenant, so it can no longer be restored, then removes its
+// database and files before marking it purged. Every step is idempotent, so
+// a failed purge is finished by the next attempt.
+func (s *PurgeService) purge(ctx context.Context, tenantName string) (*models.TenantPurge, error) {
+	tenant, err := s.postgresRepo.ClaimTenantPurge(ctx, tenantName)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrTenantNotDeleted, tenantName)
+		}
+		return nil, fmt.Errorf("unable to claim tenant: %w", err)
+	}
+
+	purge := s.inspect(ctx, tenant, false)
+	purge.Error = ""
+
+	if err := s.mongoRepo.DropDatabase(ctx, tenantName); err != nil {
+		return nil, err
+	}
+
+	removed, err := s.storageService.RemovePrefix(ctx, tenantPrefix(tenantName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to remove stored files: %w", err)
+	}
+	purge.Objects = removed
+
+	if err := s.postgresRepo.MarkTenantPurged(ctx, tenantName); err != nil {
+		return nil, err
+	}
+	purge.Purged = true
+
+	return purge, nil
+}
+
+// tenantPrefix is the object key prefix under which a tenant's files are stored
+func tenantPrefix(tenantName string) string {
+	return tenantName + "/"
+}
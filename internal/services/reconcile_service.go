@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+)
+
+// ReconcileService detects and repairs inconsistencies between the master
+// database, the tenant databases and object storage left by partial failures
+// that compensating actions could not undo
+type ReconcileService struct {
+	postgresRepo   *repository.PostgresRepository
+	mongoRepo      *repository.MongoRepository
+	storageService *StorageService
+	tenantService  *TenantService
+	grace          time.Duration
+	interval       time.Duration
+	dryRun         bool
+}
+
+// NewReconcileService creates a reconcile service. Objects younger than grace
+// are never treated as orphaned, since an upload may still be in flight.
+func NewReconcileService(
+	postgresRepo *repository.PostgresRepository,
+	mongoRepo *repository.MongoRepository,
+	storageService *StorageService,
+	tenantService *TenantService,
+	grace, interval time.Duration,
+	dryRun bool,
+) *ReconcileService {
+	return &ReconcileService{
+		postgresRepo:   postgresRepo,
+		mongoRepo:      mongoRepo,
+		storageService: storageService,
+		tenantService:  tenantService,
+		grace:          grace,
+		interval:       interval,
+		dryRun:         dryRun,
+	}
+}
+
+// Start runs reconciliation every interval until ctx is cancelled
+func (s *ReconcileService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			report, err := s.Run(ctx, s.dryRun)
+			if err != nil {
+				slog.ErrorContext(ctx, "reconciliation failed", "error", err)
+				continue
+			}
+			for _, issue := range report.Issues {
+				switch {
+				case issue.Error != "":
+					slog.ErrorContext(ctx, "reconcile repair failed",
+						"kind", issue.Kind, logging.KeyTenant, issue.TenantName, "resource", issue.Resource, "error", issue.Error)
+				case issue.Repaired:
+					slog.InfoContext(ctx, "reconcile issue repaired",
+						"kind", issue.Kind, logging.KeyTenant, issue.TenantName, "resource", issue.Resource)
+				default:
+					slog.WarnContext(ctx, "reconcile issue found",
+						"kind", issue.Kind, logging.KeyTenant, issue.TenantName, "resource", issue.Resource, "detail", issue.Detail)
+				}
+			}
+		}
+	}()
+}
+
+// Run checks every tenant known to any store. Unless dryRun is set, each
+// issue that can be repaired safely is repaired.
+func (s *ReconcileService) Run(ctx context.Context, dryRun bool) (*models.ReconcileReport, error) {
+	report := &models.ReconcileReport{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Issues:    []models.ReconcileIssue{},
+	}
+
+	tenants, err := s.postgresRepo.ListAllTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	databases, err := s.mongoRepo.ListTenantDatabases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prefixes, err := s.storageService.ListTopLevelPrefixes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*models.Tenant, len(tenants))
+	for i := range tenants {
+		records[tenants[i].TenantName] = &tenants[i]
+	}
+	hasDatabase := make(map[string]bool, len(databases))
+	for _, name := range databases {
+		hasDatabase[name] = true
+	}
+
+	// Every tenant known to Postgres, MongoDB or MinIO
+	names := make(map[string]bool)
+	for name := range records {
+		names[name] = true
+	}
+	for _, name := range databases {
+		names[name] = true
+	}
+	for _, name := range prefixes {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Tenants++
+
+		tenant := records[name]
+		s.checkTenant(ctx, report, name, tenant, hasDatabase[name], dryRun)
+
+		// Files of tenants being purged are removed by the purge itself
+		if tenant != nil && tenant.Status == models.TenantStatusPurging {
+			continue
+		}
+		readable := hasDatabase[name] && (tenant == nil || tenant.Status != models.TenantStatusPurged)
+		if err := s.checkFiles(ctx, report, name, readable, dryRun); err != nil {
+			report.Issues = append(report.Issues, models.ReconcileIssue{
+				Kind:       models.IssueCheckFailed,
+				TenantName: name,
+				Detail:     "unable to compare stored files with documents",
+				Error:      err.Error(),
+			})
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	return report, nil
+}
+
+// checkTenant compares a tenant's record with its database
+func (s *ReconcileService) checkTenant(ctx context.Context, report *models.ReconcileReport, name string, tenant *models.Tenant, hasDatabase bool, dryRun bool) {
+	add := func(kind, detail string, repair func() error) {
+		issue := models.ReconcileIssue{Kind: kind, TenantName: name, Resource: "tenant_" + name, Detail: detail}
+		if repair != nil && !dryRun {
+			if err := repair(); err != nil {
+				issue.Error = err.Error()
+			} else {
+				issue.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	if tenant == nil {
+		if hasDatabase {
+			add(models.IssueDatabaseMissingTenant, "database has no tenant record; registering it as active", func() error {
+				return s.adoptDatabase(ctx, name)
+			})
+		}
+		return
+	}
+
+	switch tenant.Status {
+	case models.TenantStatusActive:
+		if !hasDatabase {
+			add(models.IssueTenantMissingDatabase, "active tenant has no database; provisioning it again", func() error {
+				if err := s.postgresRepo.SetTenantStatus(ctx, name, models.TenantStatusFailed, "database missing"); err != nil {
+					return err
+				}
+				_, err := s.tenantService.RetryProvisioning(ctx, name)
+				return err
+			})
+			return
+		}
+		count, err := s.mongoRepo.CountDocumentsDeletedWithTenant(ctx, name)
+		if err == nil && count > 0 {
+			add(models.IssueRestoredTenantDocuments, fmt.Sprintf("%d document(s) still deleted with the tenant", count), func() error {
+				_, err := s.mongoRepo.RestoreDocumentsDeletedWithTenant(ctx, name)
+				return err
+			})
+		}
+
+	case models.TenantStatusDeleted:
+		if !hasDatabase {
+			add(models.IssueTenantMissingDatabase, "soft-deleted tenant has no database; its documents cannot be restored", nil)
+			return
+		}
+		count, err := s.mongoRepo.CountDocuments(ctx, name)
+		if err == nil && count > 0 {
+			add(models.IssueDeletedTenantDocuments, fmt.Sprintf("%d active document(s) in a deleted tenant", count), func() error {
+				_, err := s.mongoRepo.SoftDeleteAllDocuments(ctx, name)
+				return err
+			})
+		}
+
+	case models.TenantStatusPurged:
+		if hasDatabase {
+			add(models.IssuePurgedTenantDatabase, "purged tenant still has a database; dropping it", func() error {
+				return s.mongoRepo.DropDatabase(ctx, name)
+			})
+		}
+	}
+
+	// Provisioning and failed tenants are handled by the provisioner, and
+	// purging tenants by the reaper
+}
+
+// adoptDatabase registers a tenant database that has no tenant record, so
+// its documents become reachable again
+func (s *ReconcileService) adoptDatabase(ctx context.Context, name string) error {
+	if err := s.tenantService.ValidateTenantName(name); err != nil {
+		return fmt.Errorf("database name is not a valid tenant name: %w", err)
+	}
+
+	tenant := &models.Tenant{
+		TenantName: name,
+		DBHost:     s.tenantService.mongoHost,
+		DBPort:     27017,
+		DBName:     fmt.Sprintf("tenant_%s", name),
+		Status:     models.TenantStatusActive,
+	}
+	if err := s.postgresRepo.CreateTenant(ctx, tenant); err != nil {
+		return fmt.Errorf("unable to save tenant metadata: %w", err)
+	}
+	return s.mongoRepo.EnsureSearchIndex(ctx, name)
+}
+
+// checkFiles compares a tenant's stored files with its documents, their
+// versions and pending jobs. Jobs are listed before documents and documents
+// before files, so a job finishing mid-check never makes its file look
+// orphaned.
+func (s *ReconcileService) checkFiles(ctx context.Context, report *models.ReconcileReport, name string, readable bool, dryRun bool) error {
+	referenced := make(map[string]bool)
+
+	pending, err := s.postgresRepo.PendingJobStoragePaths(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, path := range pending {
+		referenced[path] = true
+	}
+
+	var docs []models.Document
+	if readable {
+		docs, err = s.mongoRepo.ListDocumentFiles(ctx, name)
+		if err != nil {
+			return err
+		}
+	}
+	for _, doc := range docs {
+		referenced[doc.StoragePath] = true
+	}
+	if readable {
+		// Earlier versions keep their files
+		paths, err := s.mongoRepo.ListVersionFiles(ctx, name)
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			referenced[path] = true
+		}
+	}
+
+	objects, err := s.storageService.ListObjects(ctx, tenantPrefix(name))
+	if err != nil {
+		return err
+	}
+	report.Objects += len(objects)
+
+	stored := make(map[string]bool, len(objects))
+	cutoff := time.Now().Add(-s.grace)
+	for _, object := range objects {
+		stored[object.Key] = true
+		if referenced[object.Key] || object.LastModified.After(cutoff) {
+			continue
+		}
+
+		issue := models.ReconcileIssue{
+			Kind:       models.IssueOrphanedObject,
+			TenantName: name,
+			Resource:   object.Key,
+			Detail:     fmt.Sprintf("%d bytes, last modified %s", object.Size, object.LastModified.Format(time.RFC3339)),
+		}
+		if !dryRun {
+			if err := s.storageService.DeleteFile(ctx, object.Key); err != nil {
+				issue.Error = err.Error()
+			} else {
+				issue.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for _, doc := range docs {
+		if doc.IsDeleted || doc.StoragePath == "" || stored[doc.StoragePath] {
+			continue
+		}
+
+		// The file cannot be recovered; hide the document but keep it
+		// restorable for its text and summary
+		issue := models.ReconcileIssue{
+			Kind:       models.IssueDanglingDocument,
+			TenantName: name,
+			Resource:   doc.ID.Hex(),
+			Detail:     fmt.Sprintf("file %s is missing; soft-deleting the document", doc.StoragePath),
+		}
+		if !dryRun {
+			if err := s.mongoRepo.SoftDeleteDocument(ctx, name, doc.ID); err != nil {
+				issue.Error = err.Error()
+			} else {
+				issue.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bacancy/droadmap/internal/models"
+)
+
+const (
+	snippetContext = 80 // characters kept on each side of a match
+	maxSnippets    = 3
+	highlightOpen  = "<mark>"
+	highlightClose = "</mark>"
+	minTermLength  = 2
+)
+
+// searchTerms splits a MongoDB $text query into plain lowercase terms for
+// highlighting. Negated terms are dropped and quoted phrases are kept whole.
+func searchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+
+	add := func(term string) {
+		term = strings.ToLower(strings.TrimSpace(term))
+		if utf8.RuneCountInString(term) < minTermLength || seen[term] {
+			return
+		}
+		seen[term] = true
+		terms = append(terms, term)
+	}
+
+	// Quoted phrases first
+	rest := query
+	for {
+		start := strings.Index(rest, `"`)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start+1:], `"`)
+		if end < 0 {
+			break
+		}
+		add(rest[start+1 : start+1+end])
+		rest = rest[:start] + " " + rest[start+1+end+1:]
+	}
+
+	for _, word := range strings.Fields(rest) {
+		if strings.HasPrefix(word, "-") {
+			continue
+		}
+		add(strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}))
+	}
+
+	return terms
+}
+
+// buildSnippets extracts up to maxSnippets highlighted excerpts of text around
+// matches of the given terms. Page numbers are derived from PageBreak markers
+// when the text contains them.
+func buildSnippets(field, text string, terms []string) []models.SearchSnippet {
+	if text == "" || len(terms) == 0 {
+		return nil
+	}
+
+	lower := strings.ToLower(text)
+	// ToLower can change byte lengths for some scripts; only use offsets when aligned
+	if len(lower) != len(text) {
+		return nil
+	}
+
+	paged := strings.Contains(text, PageBreak)
+	var snippets []models.SearchSnippet
+	searchFrom := 0
+
+	for len(snippets) < maxSnippets {
+		pos, term := nextMatch(lower, terms, searchFrom)
+		if pos < 0 {
+			break
+		}
+
+		start := clampToRune(text, pos-snippetContext)
+		end := clampToRune(text, pos+len(term)+snippetContext)
+
+		// Keep the snippet within the page containing the match
+		if paged {
+			if i := strings.LastIndex(text[start:pos], PageBreak); i >= 0 {
+				start += i + len(PageBreak)
+			}
+			if i := strings.Index(text[pos:end], PageBreak); i >= 0 {
+				end = pos + i
+			}
+		}
+
+		snippet := models.SearchSnippet{
+			Field: field,
+			Text:  highlight(text[start:end], lower[start:end], terms),
+		}
+		if start > 0 {
+			snippet.Text = "…" + snippet.Text
+		}
+		if end < len(text) {
+			snippet.Text += "…"
+		}
+		if paged {
+			snippet.Page = strings.Count(text[:pos], PageBreak) + 1
+		}
+		snippets = append(snippets, snippet)
+
+		searchFrom = end
+	}
+
+	return snippets
+}
+
+// pageSnippets builds snippets from per-page text, citing page numbers
+func pageSnippets(pages []models.PDFPage, terms []string) []models.SearchSnippet {
+	var snippets []models.SearchSnippet
+	for _, page := range pages {
+		for _, snippet := range buildSnippets("pages.text", page.Text, terms) {
+			snippet.Page = page.Number
+			snippets = append(snippets, snippet)
+			if len(snippets) == maxSnippets {
+				return snippets
+			}
+		}
+	}
+	return snippets
+}
+
+// nextMatch returns the earliest position at or after from where any term occurs
+func nextMatch(lower string, terms []string, from int) (int, string) {
+	best, bestTerm := -1, ""
+	for _, term := range terms {
+		if i := strings.Index(lower[from:], term); i >= 0 && (best < 0 || from+i < best) {
+			best, bestTerm = from+i, term
+		}
+	}
+	return best, bestTerm
+}
+
+// highlight wraps every occurrence of the terms in text with highlight markers
+func highlight(text, lower string, terms []string) string {
+	var b strings.Builder
+	i := 0
+	for i < len(text) {
+		pos, term := nextMatch(lower, terms, i)
+		if pos < 0 {
+			break
+		}
+		b.WriteString(text[i:pos])
+		b.WriteString(highlightOpen)
+		b.WriteString(text[pos : pos+len(term)])
+		b.WriteString(highlightClose)
+		i = pos + len(term)
+	}
+	b.WriteString(text[i:])
+	return strings.ReplaceAll(b.String(), PageBreak, " ")
+}
+
+// clampToRune bounds i to the text and moves it back to a rune boundary
+func clampToRune(text string, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= len(text) {
+		return len(text)
+	}
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
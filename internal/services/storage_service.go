@@ -2,22 +2,28 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"mime/multipart"
+	"io"
+	"mime"
+	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/bacancy/droadmap/internal/tracing"
 	"github.com/google/uuid"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // StorageService handles file storage operations using MinIO/S3
 type StorageService struct {
 	client     *minio.Client
 	bucketName string
-	endpoint   string
-	useSSL     bool
 }
 
 // NewStorageService creates a new storage service
@@ -33,8 +39,6 @@ func NewStorageService(endpoint, accessKey, secretKey, bucketName string, useSSL
 	return &StorageService{
 		client:     client,
 		bucketName: bucketName,
-		endpoint:   endpoint,
-		useSSL:     useSSL,
 	}, nil
 }
 
@@ -55,36 +59,251 @@ func (s *StorageService) EnsureBucketExists(ctx context.Context) error {
 	return nil
 }
 
-// UploadFile uploads a file to MinIO and returns the storage path and URL
-func (s *StorageService) UploadFile(ctx context.Context, tenantName string, file *multipart.FileHeader) (string, string, error) {
-	// Generate unique filename
-	timestamp := time.Now().Format("2006/01/02")
-	fileID := uuid.New().String()
-	ext := filepath.Ext(file.Filename)
-	objectKey := fmt.Sprintf("%s/%s/%s%s", tenantName, timestamp, fileID, ext)
+// streamPartSize is the multipart part size for streams of unknown length;
+// minio-go buffers one part in memory at a time
+const streamPartSize = 16 * 1024 * 1024
 
-	// Open the file
+// ErrFileTooLarge is returned when a streamed file exceeds its size limit
+var ErrFileTooLarge = errors.New("file too large")
+
+// StoredFile is a file written to storage
+type StoredFile struct {
+	StoragePath string
+	ContentHash string // hex SHA-256 of the content
+	Size        int64
+	StartedAt   time.Time
+	FinishedAt  time.Time
+}
+
+// UploadFile uploads a file to MinIO and returns where it was stored and the
+// hash of its content. Download links are generated on demand with PresignedURL.
+func (s *StorageService) UploadFile(ctx context.Context, tenantName string, file *FileUpload) (*StoredFile, error) {
 	src, err := file.Open()
 	if err != nil {
-		return "", "", fmt.Errorf("unable to open file: %w", err)
+		return nil, fmt.Errorf("unable to open file: %w", err)
 	}
 	defer src.Close()
 
-	// Upload to MinIO
-	_, err = s.client.PutObject(ctx, s.bucketName, objectKey, src, file.Size, minio.PutObjectOptions{
+	return s.StreamFile(ctx, tenantName, file.Filename, src, file.Size, maxPDFSize, nil)
+}
+
+// StreamFile writes src to MinIO in a single pass, hashing it as it goes and
+// failing with ErrFileTooLarge past maxSize bytes. size is -1 when the length
+// is not known in advance. Every byte sent is also written to local, if set,
+// so callers can keep a local copy without reading the stream twice.
+func (s *StorageService) StreamFile(ctx context.Context, tenantName, fileName string, src io.Reader, size, maxSize int64, local io.Writer) (*StoredFile, error) {
+	startedAt := time.Now()
+
+	// Generate unique filename
+	timestamp := startedAt.Format("2006/01/02")
+	fileID := uuid.New().String()
+	ext := filepath.Ext(fileName)
+	objectKey := fmt.Sprintf("%s/%s/%s%s", tenantName, timestamp, fileID, ext)
+
+	hash := sha256.New()
+	sinks := []io.Writer{hash}
+	if local != nil {
+		sinks = append(sinks, local)
+	}
+	limited := &sizeLimitReader{r: src, remaining: maxSize}
+
+	// Upload to MinIO, hashing the bytes as they are sent
+	putCtx, span := tracing.StartClient(ctx, "minio.PutObject",
+		attribute.String("storage.bucket", s.bucketName),
+		attribute.String("storage.key", objectKey),
+	)
+	info, err := s.client.PutObject(putCtx, s.bucketName, objectKey, io.TeeReader(limited, io.MultiWriter(sinks...)), size, minio.PutObjectOptions{
 		ContentType: "application/pdf",
+		PartSize:    streamPartSize,
 	})
+	span.SetAttributes(attribute.Int64("storage.size", info.Size))
+	tracing.End(span, err)
+	if err != nil {
+		if limited.exceeded {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrFileTooLarge, maxSize)
+		}
+		return nil, fmt.Errorf("unable to upload file: %w", err)
+	}
+
+	return &StoredFile{
+		StoragePath: objectKey,
+		ContentHash: hex.EncodeToString(hash.Sum(nil)),
+		Size:        info.Size,
+		StartedAt:   startedAt,
+		FinishedAt:  time.Now(),
+	}, nil
+}
+
+// sizeLimitReader fails once more than remaining bytes have been read
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return 0, ErrFileTooLarge
+	}
+	return n, err
+}
+
+// DeleteFile removes a stored object
+func (s *StorageService) DeleteFile(ctx context.Context, objectKey string) error {
+	err := s.client.RemoveObject(ctx, s.bucketName, objectKey, minio.RemoveObjectOptions{})
 	if err != nil {
-		return "", "", fmt.Errorf("unable to upload file: %w", err)
+		return fmt.Errorf("unable to delete file: %w", err)
 	}
+	return nil
+}
+
+// StoredObject is an object listed from the bucket
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
 
-	// Generate URL
-	protocol := "http"
-	if s.useSSL {
-		protocol = "https"
+// ListTopLevelPrefixes returns the first path segment of every stored
+// object, i.e. the tenants that have files
+func (s *StorageService) ListTopLevelPrefixes(ctx context.Context) ([]string, error) {
+	var prefixes []string
+	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("unable to list objects: %w", object.Err)
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			prefixes = append(prefixes, strings.TrimSuffix(object.Key, "/"))
+		}
 	}
-	url := fmt.Sprintf("%s://%s/%s/%s", protocol, s.endpoint, s.bucketName, objectKey)
+	return prefixes, nil
+}
 
-	return objectKey, url, nil
+// ListObjects returns every object stored under a prefix
+func (s *StorageService) ListObjects(ctx context.Context, prefix string) ([]StoredObject, error) {
+	var objects []StoredObject
+	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("unable to list objects: %w", object.Err)
+		}
+		objects = append(objects, StoredObject{Key: object.Key, Size: object.Size, LastModified: object.LastModified})
+	}
+	return objects, nil
+}
+
+// PrefixUsage counts the objects stored under a prefix and their total size
+func (s *StorageService) PrefixUsage(ctx context.Context, prefix string) (int64, int64, error) {
+	var objects, size int64
+	for object := range s.client.ListObjects(ctx, s.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return objects, size, fmt.Errorf("unable to list objects: %w", object.Err)
+		}
+		objects++
+		size += object.Size
+	}
+	return objects, size, nil
+}
+
+// RemovePrefix removes every object stored under a prefix and returns how
+// many were removed
+func (s *StorageService) RemovePrefix(ctx context.Context, prefix string) (int64, error) {
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// sent and listErr are read only after RemoveObjects has drained objects
+	objects := make(chan minio.ObjectInfo)
+	var sent int64
+	var listErr error
+	go func() {
+		defer close(objects)
+		for object := range s.client.ListObjects(listCtx, s.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			select {
+			case objects <- object:
+				sent++
+			case <-listCtx.Done():
+				return
+			}
+		}
+	}()
+
+	var failed int64
+	var removeErr error
+	for result := range s.client.RemoveObjects(ctx, s.bucketName, objects, minio.RemoveObjectsOptions{}) {
+		failed++
+		if removeErr == nil {
+			removeErr = fmt.Errorf("unable to delete %s: %w", result.ObjectName, result.Err)
+		}
+	}
+	removed := sent - failed
+	if removeErr != nil {
+		return removed, removeErr
+	}
+	if listErr != nil {
+		return removed, fmt.Errorf("unable to list objects: %w", listErr)
+	}
+
+	// RemoveObjects only reports failures; count what is left to verify
+	remaining, _, err := s.PrefixUsage(ctx, prefix)
+	if err != nil {
+		return removed, err
+	}
+	if remaining > 0 {
+		return removed, fmt.Errorf("%d object(s) remain under %s", remaining, prefix)
+	}
+	return removed, nil
+}
+
+// GetFile opens a stored object for streaming and returns its size.
+// The caller must close the returned reader.
+func (s *StorageService) GetFile(ctx context.Context, objectKey string) (io.ReadCloser, int64, error) {
+	object, err := s.client.GetObject(ctx, s.bucketName, objectKey, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to get file: %w", err)
+	}
+
+	// GetObject is lazy; Stat performs the request and surfaces missing objects
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, 0, fmt.Errorf("unable to stat file: %w", err)
+	}
+
+	return object, info.Size, nil
+}
+
+// PresignedURL generates a time-limited download URL for a stored object.
+// The URL forces a download with the given file name.
+func (s *StorageService) PresignedURL(ctx context.Context, objectKey, fileName string, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", ContentDisposition(fileName))
+	params.Set("response-content-type", "application/pdf")
+
+	presigned, err := s.client.PresignedGetObject(ctx, s.bucketName, objectKey, expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("unable to presign URL: %w", err)
+	}
+
+	return presigned.String(), nil
+}
+
+// ContentDisposition builds an attachment Content-Disposition header value,
+// encoding non-ASCII file names per RFC 2231
+func ContentDisposition(fileName string) string {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": fileName})
+	if disposition == "" {
+		// FormatMediaType rejects names it cannot encode; fall back to a safe name
+		return `attachment; filename="document.pdf"`
+	}
+	return disposition
 }
 
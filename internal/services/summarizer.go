@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Summarizer provider names
+const (
+	ProviderGemini   = "gemini"
+	ProviderOpenAI   = "openai"
+	ProviderMock     = "mock"
+	ProviderFallback = "fallback"
+)
+
+// Summarizer produces a short summary of document text.
+// Implementations must be safe for concurrent use.
+type Summarizer interface {
+	// Name returns the provider name used in configuration
+	Name() string
+	// Summarize returns a summary of text. The instruction tells
+	// LLM-backed providers what to produce; it is never part of the text, so
+	// providers that only extract from the text ignore it.
+	Summarize(ctx context.Context, instruction, text string) (string, error)
+}
+
+// summaryInstructions are shared by the LLM-backed providers
+const (
+	summarySystemPrompt = "You are a helpful assistant that summarizes documents in 2-3 sentences."
+	summaryUserPrompt   = "Provide a concise summary of this document:"
+	// reduceInstruction combines the summaries of a long document's chunks
+	reduceInstruction = "The following are summaries of consecutive sections of one document. Combine them into a single summary of the whole document:"
+)
+
+// ExtractiveSummarizer builds a summary from the leading text of the
+// document. It needs no external service and is used when AI calls fail.
+type ExtractiveSummarizer struct{}
+
+// NewExtractiveSummarizer creates a new extractive summarizer
+func NewExtractiveSummarizer() *ExtractiveSummarizer {
+	return &ExtractiveSummarizer{}
+}
+
+// Name returns the provider name
+func (s *ExtractiveSummarizer) Name() string {
+	return ProviderFallback
+}
+
+// Summarize returns the first sentences of text, up to 500 bytes
+func (s *ExtractiveSummarizer) Summarize(ctx context.Context, instruction, text string) (string, error) {
+	// Only the first page is used when page breaks are present
+	if i := strings.Index(text, PageBreak); i >= 0 {
+		text = text[:i]
+	}
+	summary := truncateRunes(text, 500)
+
+	if lastPeriod := strings.LastIndex(summary, "."); lastPeriod > 100 {
+		summary = summary[:lastPeriod+1]
+	}
+
+	return strings.TrimSpace(summary) + "...", nil
+}
+
+// MockSummarizer returns a deterministic summary without any network access,
+// for tests and CI
+type MockSummarizer struct{}
+
+// NewMockSummarizer creates a new mock summarizer
+func NewMockSummarizer() *MockSummarizer {
+	return &MockSummarizer{}
+}
+
+// Name returns the provider name
+func (s *MockSummarizer) Name() string {
+	return ProviderMock
+}
+
+// Summarize returns a summary derived only from the input text
+func (s *MockSummarizer) Summarize(ctx context.Context, instruction, text string) (string, error) {
+	words := strings.Fields(text)
+	preview := words
+	if len(preview) > 12 {
+		preview = preview[:12]
+	}
+	return fmt.Sprintf("[mock summary] %d words: %s", len(words), strings.Join(preview, " ")), nil
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxGeminiErrorBody bounds how much of an unrecognized error response is
+// kept in the returned error
+const maxGeminiErrorBody = 256
+
+// GeminiSummarizer summarizes text with the Google Gemini REST API
+type GeminiSummarizer struct {
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+// NewGeminiSummarizer creates a new Gemini summarizer
+func NewGeminiSummarizer(apiKey, model string) *GeminiSummarizer {
+	if model == "" {
+		// gemini-2.5-flash is available in the free tier
+		model = "gemini-2.5-flash"
+	}
+	return &GeminiSummarizer{
+		apiKey: apiKey,
+		model:  model,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name returns the provider name
+func (s *GeminiSummarizer) Name() string {
+	return ProviderGemini
+}
+
+// Summarize makes the HTTP request to Google Gemini API
+func (s *GeminiSummarizer) Summarize(ctx context.Context, instruction, text string) (summary string, err error) {
+	// The v1 API is stable
+	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:generateContent", s.model)
+
+	// Build payload - NOTE: we don't use generationConfig as it can cause MAX_TOKENS issues
+	payload := map[string]interface{}{
+		"contents": []map[string]interface{}{
+			{
+				"parts": []map[string]interface{}{
+					{
+						"text": s.buildPrompt(instruction, text),
+					},
+				},
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	// The key goes in a header rather than the URL, which ends up in errors
+	// and logs
+	req.Header.Set("x-goog-api-key", s.apiKey)
+
+	_, span := tracing.StartClient(ctx, "gemini.generateContent",
+		attribute.String("gen_ai.system", "gemini"),
+		attribute.String("gen_ai.request.model", s.model),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, geminiErrorMessage(respBody))
+	}
+
+	var geminiResp GeminiResponse
+	if err := json.Unmarshal(respBody, &geminiResp); err != nil {
+		return "", fmt.Errorf("parse response: %w", err)
+	}
+
+	// Extract text from response
+	if len(geminiResp.Candidates) > 0 {
+		candidate := geminiResp.Candidates[0]
+		if len(candidate.Content.Parts) > 0 {
+			result := candidate.Content.Parts[0].Text
+			return strings.TrimSpace(result), nil
+		}
+	}
+
+	return "", fmt.Errorf("no text in response")
+}
+
+// buildPrompt constructs the prompt for Gemini
+func (s *GeminiSummarizer) buildPrompt(instruction, text string) string {
+	return summarySystemPrompt + "\n\n" + instruction + "\n\n" + text + "\n\nSummary:"
+}
+
+// geminiErrorMessage returns the message of an API error response, or the
+// start of the body if it is not one. Bodies can echo parts of the request,
+// so they are never returned whole.
+func geminiErrorMessage(body []byte) string {
+	var errResp GeminiErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error.Message != "" {
+		return fmt.Sprintf("%s: %s", errResp.Error.Status, errResp.Error.Message)
+	}
+
+	message := strings.TrimSpace(string(body))
+	if len(message) > maxGeminiErrorBody {
+		message = strings.ToValidUTF8(message[:maxGeminiErrorBody], "") + "..."
+	}
+	return message
+}
+
+// GeminiErrorResponse represents a Gemini API error
+type GeminiErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// GeminiResponse represents Gemini API response structure
+type GeminiResponse struct {
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text string `json:"text"`
+			} `json:"parts"`
+			Role string `json:"role"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+		Index        int    `json:"index"`
+	} `json:"candidates"`
+}
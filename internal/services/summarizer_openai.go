@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// OpenAISummarizer summarizes text with an OpenAI-compatible chat completions
+// API. Pointing the base URL at a local Ollama or llama.cpp server
+// (e.g. http://localhost:11434/v1) uses a self-hosted model instead.
+type OpenAISummarizer struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAISummarizer creates a new OpenAI-compatible summarizer.
+// An empty baseURL targets the OpenAI API.
+func NewOpenAISummarizer(apiKey, baseURL, model string) *OpenAISummarizer {
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	config.HTTPClient = &http.Client{
+		Timeout: 60 * time.Second,
+	}
+
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+
+	return &OpenAISummarizer{
+		client: openai.NewClientWithConfig(config),
+		model:  model,
+	}
+}
+
+// Name returns the provider name
+func (s *OpenAISummarizer) Name() string {
+	return ProviderOpenAI
+}
+
+// Summarize requests a chat completion following instruction for text
+func (s *OpenAISummarizer) Summarize(ctx context.Context, instruction, text string) (string, error) {
+	resp, err := s.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: s.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: summarySystemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: instruction + "\n\n" + text},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("chat completion failed: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
@@ -2,72 +2,356 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
+	"github.com/bacancy/droadmap/internal/logging"
 	"github.com/bacancy/droadmap/internal/models"
 	"github.com/bacancy/droadmap/internal/repository"
 	"github.com/jackc/pgx/v5"
 )
 
+const (
+	// maxProvisionAttempts is how often provisioning is tried before a tenant
+	// stays failed until retried manually
+	maxProvisionAttempts = 5
+	// provisionStuckAfter is when a tenant left in provisioning (e.g. by a
+	// crash) is provisioned again
+	provisionStuckAfter = 5 * time.Minute
+	// provisionPollInterval is how often failed tenants are checked for retry
+	provisionPollInterval = 30 * time.Second
+	// provisionWaitTimeout is how long an upload waits for a tenant that a
+	// concurrent request is provisioning
+	provisionWaitTimeout = 10 * time.Second
+	// provisionWaitInterval is how often a waiting upload checks the tenant
+	provisionWaitInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrTenantExists is returned when creating a tenant whose name is taken
+	ErrTenantExists = errors.New("tenant already exists")
+	// ErrInvalidTenantRequest is returned for malformed tenant requests
+	ErrInvalidTenantRequest = errors.New("invalid tenant request")
+	// ErrTenantNotReady is returned when a tenant is not active
+	ErrTenantNotReady = errors.New("tenant is not ready")
+	// ErrProvisioningFailed is returned when the tenant database could not be created
+	ErrProvisioningFailed = errors.New("tenant provisioning failed")
+	// ErrQuotaExceeded is returned when an upload would exceed a tenant quota
+	ErrQuotaExceeded = errors.New("tenant quota exceeded")
+)
+
 // TenantService handles tenant management operations
 type TenantService struct {
 	postgresRepo *repository.PostgresRepository
 	mongoRepo    *repository.MongoRepository
+	webhooks     *WebhookService
+	outbox       *OutboxService
 	mongoHost    string
 	mongoPort    string
+	strictMode   bool
 }
 
-// NewTenantService creates a new tenant service
-func NewTenantService(postgresRepo *repository.PostgresRepository, mongoRepo *repository.MongoRepository, mongoHost, mongoPort string) *TenantService {
+// NewTenantService creates a new tenant service. In strict mode tenants must
+// be created explicitly and uploads to unknown tenants are rejected.
+func NewTenantService(postgresRepo *repository.PostgresRepository, mongoRepo *repository.MongoRepository, webhooks *WebhookService, outbox *OutboxService, mongoHost, mongoPort string, strictMode bool) *TenantService {
 	return &TenantService{
 		postgresRepo: postgresRepo,
 		mongoRepo:    mongoRepo,
+		webhooks:     webhooks,
+		outbox:       outbox,
 		mongoHost:    mongoHost,
 		mongoPort:    mongoPort,
+		strictMode:   strictMode,
 	}
 }
 
-// GetOrCreateTenant gets an existing tenant or creates a new one with a dedicated database
-func (s *TenantService) GetOrCreateTenant(ctx context.Context, tenantName string) (*models.Tenant, error) {
+// GetOrCreateTenant gets an existing tenant or, unless in strict mode,
+// provisions a new one with default settings, reporting whether it was created.
+// Concurrent first uploads are safe: the tenant row is inserted before the
+// database is created, so exactly one caller provisions the tenant and the
+// others wait for it.
+func (s *TenantService) GetOrCreateTenant(ctx context.Context, tenantName string) (*models.Tenant, bool, error) {
 	// Step 1: Check if tenant exists in master database
 	tenant, err := s.postgresRepo.GetTenantByName(ctx, tenantName)
 	if err == nil {
-		// Tenant exists
-		return tenant, nil
+		// Tenant exists, but may still be provisioned by another request
+		if tenant.Status == models.TenantStatusProvisioning {
+			tenant, err = s.awaitProvisioning(ctx, tenantName)
+		}
+		return tenant, false, err
 	}
 
 	// Check if error is "not found" or something else
 	if err != pgx.ErrNoRows {
-		return nil, fmt.Errorf("error checking tenant: %w", err)
+		return nil, false, fmt.Errorf("error checking tenant: %w", err)
 	}
 
-	// Step 2: Tenant doesn't exist - create new tenant database
-	fmt.Printf("Creating new tenant database for: %s\n", tenantName)
+	if s.strictMode {
+		return nil, false, fmt.Errorf("%w: '%s' (create it with POST /api/v1/tenants)", ErrTenantNotFound, tenantName)
+	}
 
-	// Create MongoDB database for this tenant
-	err = s.mongoRepo.CreateTenantDatabase(ctx, tenantName)
+	// Step 2: Tenant doesn't exist - create new tenant database
+	slog.InfoContext(ctx, "creating tenant database", logging.KeyTenant, tenantName)
+	tenant, err = s.CreateTenant(ctx, models.TenantRequest{TenantName: tenantName})
+	if errors.Is(err, ErrTenantExists) {
+		// Another request registered it first; use its tenant
+		tenant, err = s.awaitProvisioning(ctx, tenantName)
+		return tenant, false, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("unable to create tenant database: %w", err)
+		// A tenant whose provisioning failed is still registered
+		return tenant, tenant != nil, err
 	}
 
-	// Step 3: Save tenant metadata to master database
-	tenant = &models.Tenant{
-		TenantName: tenantName,
-		DBHost:     s.mongoHost,
-		DBPort:     27017,
-		DBName:     fmt.Sprintf("tenant_%s", tenantName),
-		Status:     "active",
+	return tenant, true, nil
+}
+
+// awaitProvisioning waits until a tenant registered by another request leaves
+// the provisioning state. After provisionWaitTimeout the tenant is returned
+// as it is, and uploads are rejected as not ready.
+func (s *TenantService) awaitProvisioning(ctx context.Context, tenantName string) (*models.Tenant, error) {
+	deadline := time.Now().Add(provisionWaitTimeout)
+	for {
+		tenant, err := s.postgresRepo.GetTenantByName(ctx, tenantName)
+		if err == pgx.ErrNoRows {
+			// The name belongs to a soft-deleted tenant
+			return nil, fmt.Errorf("%w: '%s' (deleted tenants must be restored instead)", ErrTenantExists, tenantName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error checking tenant: %w", err)
+		}
+		if tenant.Status != models.TenantStatusProvisioning || time.Now().After(deadline) {
+			return tenant, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(provisionWaitInterval):
+		}
 	}
+}
 
-	err = s.postgresRepo.CreateTenant(ctx, tenant)
-	if err != nil {
+// CreateTenant registers a tenant in the provisioning state and creates its
+// database. If that fails the tenant is left failed, is retried in the
+// background, and ErrProvisioningFailed is returned along with the tenant.
+func (s *TenantService) CreateTenant(ctx context.Context, req models.TenantRequest) (*models.Tenant, error) {
+	if err := s.ValidateTenantName(req.TenantName); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTenantRequest, err.Error())
+	}
+	if len(req.DisplayName) > 255 {
+		return nil, fmt.Errorf("%w: display name must be at most 255 characters", ErrInvalidTenantRequest)
+	}
+	if req.Quotas.MaxDocuments < 0 || req.Quotas.MaxStorageBytes < 0 || req.Quotas.MaxFileSize < 0 {
+		return nil, fmt.Errorf("%w: quotas must not be negative", ErrInvalidTenantRequest)
+	}
+
+	// Register first so the name is reserved before any database exists
+	tenant := &models.Tenant{
+		TenantName:  req.TenantName,
+		DisplayName: req.DisplayName,
+		DBHost:      s.mongoHost,
+		DBPort:      27017,
+		DBName:      fmt.Sprintf("tenant_%s", req.TenantName),
+		Status:      models.TenantStatusProvisioning,
+		Settings:    req.Settings,
+		Quotas:      req.Quotas,
+	}
+	if err := s.postgresRepo.CreateTenant(ctx, tenant); err != nil {
+		if repository.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: '%s' (deleted tenants must be restored instead)", ErrTenantExists, req.TenantName)
+		}
 		return nil, fmt.Errorf("unable to save tenant metadata: %w", err)
 	}
 
-	fmt.Printf("✓ Tenant database created successfully for: %s\n", tenantName)
+	if err := s.provision(ctx, tenant); err != nil {
+		return tenant, err
+	}
+
+	slog.InfoContext(ctx, "tenant database created", logging.KeyTenant, req.TenantName)
+	return tenant, nil
+}
+
+// RetryProvisioning provisions a failed tenant again
+func (s *TenantService) RetryProvisioning(ctx context.Context, tenantName string) (*models.Tenant, error) {
+	tenant, err := s.postgresRepo.ClaimTenantProvisioning(ctx, tenantName, provisionStuckAfter)
+	if err == pgx.ErrNoRows {
+		existing, getErr := s.GetTenant(ctx, tenantName)
+		if getErr != nil {
+			return nil, getErr
+		}
+		return nil, fmt.Errorf("%w: tenant '%s' is %s", ErrTenantNotReady, tenantName, existing.Status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to claim tenant: %w", err)
+	}
+
+	if err := s.provision(ctx, tenant); err != nil {
+		return tenant, err
+	}
 	return tenant, nil
 }
 
+// provision creates the tenant database and records the outcome
+func (s *TenantService) provision(ctx context.Context, tenant *models.Tenant) error {
+	if err := s.mongoRepo.CreateTenantDatabase(ctx, tenant.TenantName); err != nil {
+		tenant.Status = models.TenantStatusFailed
+		tenant.ProvisionAttempts++
+		tenant.ProvisionError = err.Error()
+		if setErr := s.postgresRepo.SetTenantStatus(ctx, tenant.TenantName, tenant.Status, tenant.ProvisionError); setErr != nil {
+			slog.ErrorContext(ctx, "failed to record provisioning failure", logging.KeyTenant, tenant.TenantName, "error", setErr)
+		}
+		return fmt.Errorf("%w: %v", ErrProvisioningFailed, err)
+	}
+
+	if err := s.postgresRepo.SetTenantStatus(ctx, tenant.TenantName, models.TenantStatusActive, ""); err != nil {
+		// The database exists; the retry loop will mark it active
+		return fmt.Errorf("unable to activate tenant: %w", err)
+	}
+	tenant.Status = models.TenantStatusActive
+	tenant.ProvisionError = ""
+	return nil
+}
+
+// StartProvisioner retries failed and stuck provisioning with backoff until
+// ctx is cancelled
+func (s *TenantService) StartProvisioner(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(provisionPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			names, err := s.postgresRepo.ListTenantsToProvision(ctx, maxProvisionAttempts, provisionStuckAfter)
+			if err != nil {
+				slog.ErrorContext(ctx, "failed to list tenants to provision", "error", err)
+				continue
+			}
+			for _, name := range names {
+				if _, err := s.RetryProvisioning(ctx, name); err != nil {
+					slog.WarnContext(ctx, "provisioning retry failed", logging.KeyTenant, name, "error", err)
+					continue
+				}
+				slog.InfoContext(ctx, "tenant provisioned on retry", logging.KeyTenant, name)
+			}
+		}
+	}()
+}
+
+// GetTenant retrieves an active or provisioning tenant by name
+func (s *TenantService) GetTenant(ctx context.Context, tenantName string) (*models.Tenant, error) {
+	tenant, err := s.postgresRepo.GetTenantByName(ctx, tenantName)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrTenantNotFound, tenantName)
+		}
+		return nil, fmt.Errorf("error checking tenant: %w", err)
+	}
+	return tenant, nil
+}
+
+// GetUsage reports what a tenant stores, including uploads still in the
+// ingest queue
+func (s *TenantService) GetUsage(ctx context.Context, tenantName string) (models.TenantUsage, error) {
+	stored, err := s.mongoRepo.DocumentUsage(ctx, tenantName)
+	if err != nil {
+		return models.TenantUsage{}, err
+	}
+	pending, err := s.postgresRepo.PendingJobUsage(ctx, tenantName)
+	if err != nil {
+		return models.TenantUsage{}, fmt.Errorf("unable to count pending uploads: %w", err)
+	}
+
+	return models.TenantUsage{
+		Documents:    stored.Documents + pending.Documents,
+		StorageBytes: stored.StorageBytes + pending.StorageBytes,
+	}, nil
+}
+
+// CheckUpload verifies that a tenant is active and that a file of the given
+// size fits its quotas
+func (s *TenantService) CheckUpload(ctx context.Context, tenant *models.Tenant, fileSize int64) error {
+	if err := s.CheckUploadStatus(tenant); err != nil {
+		return err
+	}
+
+	quotas := tenant.Quotas
+	if quotas.MaxFileSize > 0 && fileSize > quotas.MaxFileSize {
+		return fmt.Errorf("%w: file size %d exceeds the limit of %d bytes", ErrQuotaExceeded, fileSize, quotas.MaxFileSize)
+	}
+	if quotas.MaxDocuments == 0 && quotas.MaxStorageBytes == 0 {
+		return nil
+	}
+
+	usage, err := s.GetUsage(ctx, tenant.TenantName)
+	if err != nil {
+		return err
+	}
+	if quotas.MaxDocuments > 0 && usage.Documents+1 > quotas.MaxDocuments {
+		return fmt.Errorf("%w: tenant already has %d of %d documents", ErrQuotaExceeded, usage.Documents, quotas.MaxDocuments)
+	}
+	if quotas.MaxStorageBytes > 0 && usage.StorageBytes+fileSize > quotas.MaxStorageBytes {
+		return fmt.Errorf("%w: %d of %d storage bytes used", ErrQuotaExceeded, usage.StorageBytes, quotas.MaxStorageBytes)
+	}
+
+	return nil
+}
+
+// CheckUploadStatus returns ErrTenantNotReady unless the tenant is active.
+// Unlike CheckUpload it does not need the file, so uploads can be refused
+// before they are read.
+func (s *TenantService) CheckUploadStatus(tenant *models.Tenant) error {
+	if tenant.Status != models.TenantStatusActive {
+		return fmt.Errorf("%w: tenant '%s' is %s", ErrTenantNotReady, tenant.TenantName, tenant.Status)
+	}
+	return nil
+}
+
+// BackfillSearchIndexes ensures the full-text and deduplication indexes exist
+// for every tenant, including soft-deleted ones, so tenants created before
+// search and deduplication were added can be searched and deduplicated.
+// Only active and deleted tenants have a database to index: the others are
+// skipped, since touching their database would create it outside
+// provisioning. A tenant that fails is logged and skipped; the returned error joins the
+// failures of all such tenants.
+func (s *TenantService) BackfillSearchIndexes(ctx context.Context) (int, error) {
+	active, err := s.postgresRepo.ListTenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := s.postgresRepo.ListDeletedTenants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	var errs []error
+	for _, tenant := range append(active, deleted...) {
+		if tenant.Status != models.TenantStatusActive && tenant.Status != models.TenantStatusDeleted {
+			continue
+		}
+		err := s.mongoRepo.EnsureSearchIndex(ctx, tenant.TenantName)
+		if err == nil {
+			err = s.mongoRepo.EnsureDocumentIndexes(ctx, tenant.TenantName)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to backfill search indexes", logging.KeyTenant, tenant.TenantName, "error", err)
+			errs = append(errs, fmt.Errorf("tenant '%s': %w", tenant.TenantName, err))
+			continue
+		}
+		count++
+	}
+
+	return count, errors.Join(errs...)
+}
+
 // ValidateTenantName checks if tenant name is valid
 func (s *TenantService) ValidateTenantName(tenantName string) error {
 	if tenantName == "" {
@@ -107,26 +391,39 @@ func (s *TenantService) DeleteTenant(ctx context.Context, tenantName string) (ma
 		return stats, fmt.Errorf("error checking tenant: %w", err)
 	}
 
-	// Step 2: Soft delete all documents in MongoDB
-	modifiedCount, err := s.mongoRepo.SoftDeleteAllDocuments(ctx, tenantName)
+	// Step 2: Soft delete tenant metadata in PostgreSQL first, so the tenant
+	// stops accepting uploads before its documents are hidden
+	err = s.postgresRepo.DeleteTenant(ctx, tenantName, s.outbox.NewEvents(tenantName, models.EventTenantDeleted, nil)...)
 	if err != nil {
-		return stats, fmt.Errorf("failed to soft delete documents: %w", err)
+		return stats, fmt.Errorf("failed to soft delete tenant: %w", err)
 	}
-	stats["documents_marked_deleted"] = modifiedCount
 
-	// Step 3: Soft delete tenant metadata in PostgreSQL
-	err = s.postgresRepo.DeleteTenant(ctx, tenantName)
+	// Step 3: Soft delete all documents in MongoDB
+	modifiedCount, err := s.mongoRepo.SoftDeleteAllDocuments(ctx, tenantName)
 	if err != nil {
-		return stats, fmt.Errorf("failed to soft delete tenant: %w", err)
+		// Compensate: undo the documents that were marked and the tenant row
+		if _, undoErr := s.mongoRepo.RestoreDocumentsDeletedWithTenant(ctx, tenantName); undoErr != nil {
+			slog.ErrorContext(ctx, "failed to undo document deletion; reconciliation will repair it", logging.KeyTenant, tenantName, "error", undoErr)
+		}
+		undoEvents := s.outbox.NewEvents(tenantName, models.EventTenantRestored, map[string]interface{}{"compensation": true})
+		if undoErr := s.postgresRepo.RestoreTenant(ctx, tenantName, undoEvents...); undoErr != nil {
+			slog.ErrorContext(ctx, "failed to undo tenant deletion; reconciliation will repair it", logging.KeyTenant, tenantName, "error", undoErr)
+		}
+		return stats, fmt.Errorf("failed to soft delete documents: %w", err)
 	}
+	stats["documents_marked_deleted"] = modifiedCount
 	stats["soft_deleted"] = true
 
 	// Note: Files in MinIO are still preserved
 	stats["note"] = "Tenant and all documents marked as deleted. Data can be restored."
 	stats["storage_preserved"] = fmt.Sprintf("MinIO: %s/*", tenantName)
 
-	fmt.Printf("Tenant '%s' soft deleted: DB=%s, Documents=%d marked as deleted\n", 
-		tenantName, tenant.DBName, stats["documents_marked_deleted"])
+	slog.InfoContext(ctx, "tenant soft deleted",
+		logging.KeyTenant, tenantName, "db_name", tenant.DBName, "documents", modifiedCount)
+
+	s.webhooks.Publish(ctx, tenantName, models.EventTenantDeleted, map[string]interface{}{
+		"documents_marked_deleted": modifiedCount,
+	})
 
 	return stats, nil
 }
@@ -136,7 +433,7 @@ func (s *TenantService) RestoreTenant(ctx context.Context, tenantName string) (m
 	stats := make(map[string]interface{})
 	
 	// Step 1: Restore tenant in PostgreSQL
-	err := s.postgresRepo.RestoreTenant(ctx, tenantName)
+	err := s.postgresRepo.RestoreTenant(ctx, tenantName, s.outbox.NewEvents(tenantName, models.EventTenantRestored, nil)...)
 	if err != nil {
 		return stats, fmt.Errorf("failed to restore tenant: %w", err)
 	}
@@ -145,11 +442,23 @@ func (s *TenantService) RestoreTenant(ctx context.Context, tenantName string) (m
 	// Step 2: Restore all documents in MongoDB
 	modifiedCount, err := s.mongoRepo.RestoreAllDocuments(ctx, tenantName)
 	if err != nil {
+		// Compensate: put the tenant and any restored documents back
+		undoEvents := s.outbox.NewEvents(tenantName, models.EventTenantDeleted, map[string]interface{}{"compensation": true})
+		if undoErr := s.postgresRepo.DeleteTenant(ctx, tenantName, undoEvents...); undoErr != nil {
+			slog.ErrorContext(ctx, "failed to undo tenant restore; reconciliation will repair it", logging.KeyTenant, tenantName, "error", undoErr)
+		} else if _, undoErr := s.mongoRepo.SoftDeleteAllDocuments(ctx, tenantName); undoErr != nil {
+			slog.ErrorContext(ctx, "failed to undo document restore; reconciliation will repair it", logging.KeyTenant, tenantName, "error", undoErr)
+		}
+		stats["tenant_restored"] = false
 		return stats, fmt.Errorf("failed to restore documents: %w", err)
 	}
 	stats["documents_restored"] = modifiedCount
 
-	fmt.Printf("Tenant '%s' restored: Documents=%d restored\n", tenantName, modifiedCount)
+	slog.InfoContext(ctx, "tenant restored", logging.KeyTenant, tenantName, "documents", modifiedCount)
+
+	s.webhooks.Publish(ctx, tenantName, models.EventTenantRestored, map[string]interface{}{
+		"documents_restored": modifiedCount,
+	})
 	return stats, nil
 }
 
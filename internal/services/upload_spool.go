@@ -0,0 +1,95 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// spoolPattern names spooled files, so only they are cleaned up
+	spoolPattern = "upload-*.pdf"
+	// spoolTTL bounds how long a spooled copy waits for its job, e.g. when
+	// another instance claimed the job
+	spoolTTL = time.Hour
+)
+
+// UploadSpool keeps the local copy of each streamed upload until its ingest
+// job has extracted it, so extraction reads the file from local disk instead
+// of downloading it from storage again
+type UploadSpool struct {
+	dir   string
+	mu    sync.Mutex
+	files map[string]spooledFile // by storage path
+}
+
+type spooledFile struct {
+	path    string
+	created time.Time
+}
+
+// NewUploadSpool creates a spool in dir, removing copies left behind by a
+// previous run. An empty dir uses a directory under the system temp dir.
+func NewUploadSpool(dir string) (*UploadSpool, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "pdf-upload-spool")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create spool directory: %w", err)
+	}
+
+	stale, _ := filepath.Glob(filepath.Join(dir, spoolPattern))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+
+	return &UploadSpool{dir: dir, files: make(map[string]spooledFile)}, nil
+}
+
+// Create opens a new spool file for writing
+func (s *UploadSpool) Create() (*os.File, error) {
+	file, err := os.CreateTemp(s.dir, spoolPattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create spool file: %w", err)
+	}
+	return file, nil
+}
+
+// Keep records path as the local copy of the object at storagePath and
+// removes copies whose jobs never claimed them
+func (s *UploadSpool) Keep(storagePath, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().Add(-spoolTTL)
+	for key, file := range s.files {
+		if file.created.Before(cutoff) {
+			os.Remove(file.path)
+			delete(s.files, key)
+		}
+	}
+	s.files[storagePath] = spooledFile{path: path, created: time.Now()}
+}
+
+// Path returns the local copy of the object at storagePath, if it is spooled
+func (s *UploadSpool) Path(storagePath string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[storagePath]
+	return file.path, ok
+}
+
+// Release removes the local copy of the object at storagePath, if any
+func (s *UploadSpool) Release(storagePath string) {
+	s.mu.Lock()
+	file, ok := s.files[storagePath]
+	delete(s.files, storagePath)
+	s.mu.Unlock()
+
+	if ok {
+		os.Remove(file.path)
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidUserRequest is returned for malformed user requests
+	ErrInvalidUserRequest = errors.New("invalid user request")
+	// ErrUserExists is returned when the email is already registered
+	ErrUserExists = errors.New("user already exists")
+)
+
+// UserService manages the users of each tenant and their roles
+type UserService struct {
+	postgresRepo  *repository.PostgresRepository
+	tenantService *TenantService
+}
+
+// NewUserService creates a new user service
+func NewUserService(postgresRepo *repository.PostgresRepository, tenantService *TenantService) *UserService {
+	return &UserService{
+		postgresRepo:  postgresRepo,
+		tenantService: tenantService,
+	}
+}
+
+// CreateUser creates a user. Platform admins have no tenant; every other
+// role belongs to an existing tenant.
+func (s *UserService) CreateUser(ctx context.Context, req models.UserRequest) (*models.User, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		return nil, fmt.Errorf("%w: invalid email '%s'", ErrInvalidUserRequest, req.Email)
+	}
+	if !models.ValidRole(req.Role) {
+		return nil, fmt.Errorf("%w: role must be one of %s, %s, %s, %s", ErrInvalidUserRequest,
+			models.RoleViewer, models.RoleUploader, models.RoleTenantAdmin, models.RolePlatformAdmin)
+	}
+
+	if req.Role == models.RolePlatformAdmin {
+		if req.TenantName != "" {
+			return nil, fmt.Errorf("%w: platform admins cannot belong to a tenant", ErrInvalidUserRequest)
+		}
+	} else {
+		if err := s.tenantService.ValidateTenantName(req.TenantName); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidUserRequest, err.Error())
+		}
+		if _, err := s.postgresRepo.GetTenantByName(ctx, req.TenantName); err != nil {
+			if err == pgx.ErrNoRows {
+				return nil, fmt.Errorf("%w: '%s'", ErrTenantNotFound, req.TenantName)
+			}
+			return nil, fmt.Errorf("unable to get tenant: %w", err)
+		}
+	}
+
+	user := &models.User{
+		TenantName: req.TenantName,
+		Email:      email,
+		Name:       strings.TrimSpace(req.Name),
+		Role:       req.Role,
+	}
+	if err := s.postgresRepo.CreateUser(ctx, user); err != nil {
+		if repository.IsUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: '%s'", ErrUserExists, email)
+		}
+		return nil, fmt.Errorf("unable to create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// GetUser retrieves a user by ID
+func (s *UserService) GetUser(ctx context.Context, id string) (*models.User, error) {
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrUserNotFound, id)
+	}
+
+	user, err := s.postgresRepo.GetUser(ctx, userID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrUserNotFound, id)
+		}
+		return nil, fmt.Errorf("unable to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// ListUsers lists users, optionally for a single tenant
+func (s *UserService) ListUsers(ctx context.Context, tenantName string) ([]models.User, error) {
+	return s.postgresRepo.ListUsers(ctx, tenantName)
+}
+
+// DisableUser disables a user; API keys issued for the user stop working
+func (s *UserService) DisableUser(ctx context.Context, id int) error {
+	if err := s.postgresRepo.DisableUser(ctx, id); err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("%w: '%d' (or already disabled)", ErrUserNotFound, id)
+		}
+		return fmt.Errorf("unable to disable user: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"syscall"
+)
+
+// ErrWebhookAddressBlocked is returned when a webhook URL leads to an address
+// that is not publicly routable
+var ErrWebhookAddressBlocked = errors.New("webhook address is not public")
+
+// blockedPrefixes are ranges besides the loopback, private, link-local,
+// multicast and unspecified ones that webhooks must not reach
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which embeds IPv4 addresses
+}
+
+// publicAddr reports whether webhooks may connect to addr. Loopback, private
+// (RFC 1918 and unique local), link-local (including cloud metadata
+// endpoints such as 169.254.169.254), multicast and unspecified addresses are
+// refused, so a tenant cannot make the server call its own network.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// guardWebhookDial is the net.Dialer Control of the webhook client. It runs
+// after DNS resolution on the address actually dialed, so a host name that
+// resolves to a public address when checked and to a private one when
+// dialed (DNS rebinding) is still refused.
+func guardWebhookDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrWebhookAddressBlocked, host)
+	}
+	return nil
+}
+
+// checkWebhookAddress resolves the host of a webhook URL and checks that all
+// of its addresses are public. Hosts that do not resolve are refused.
+func checkWebhookAddress(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := parsed.Hostname()
+
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("unable to resolve webhook host '%s': %w", host, err)
+		}
+	}
+
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrWebhookAddressBlocked, host, addr)
+		}
+	}
+	return nil
+}
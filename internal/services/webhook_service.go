@@ -0,0 +1,496 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/logging"
+	"github.com/bacancy/droadmap/internal/models"
+	"github.com/bacancy/droadmap/internal/repository"
+	"github.com/bacancy/droadmap/internal/tracing"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// webhookSecretPrefix marks webhook signing secrets
+	webhookSecretPrefix = "whsec_"
+	// webhookPollInterval is how often idle dispatchers check for due deliveries
+	webhookPollInterval = 2 * time.Second
+	// maxRetryDelay caps the exponential backoff between attempts
+	maxRetryDelay = 6 * time.Hour
+	// maxResponseDrain is how much of a response is read so the connection
+	// can be reused; the body itself is never kept
+	maxResponseDrain = 64 << 10
+
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 500
+)
+
+var (
+	// ErrWebhookNotFound is returned when a tenant has no such webhook
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhookRequest is returned for malformed webhook requests
+	ErrInvalidWebhookRequest = errors.New("invalid webhook request")
+	// ErrDeliveryNotFound is returned when a tenant has no such delivery
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	// ErrDeliveryConflict is returned when redelivering a delivery that is
+	// still pending
+	ErrDeliveryConflict = errors.New("webhook delivery is still pending")
+)
+
+// WebhookConfig configures webhook delivery
+type WebhookConfig struct {
+	MaxAttempts int           // attempts before a delivery is dead-lettered
+	RetryBase   time.Duration // delay before the first retry; doubled for every further retry
+	Timeout     time.Duration // per attempt
+	Workers     int           // concurrent deliveries
+	// AllowPrivate permits loopback and private network addresses, for local
+	// development only
+	AllowPrivate bool
+}
+
+// WebhookService manages tenant webhooks and delivers events to them.
+// Deliveries are persisted in the master database and sent by a pool of
+// dispatchers, so events survive restarts and are retried until delivered
+// or dead-lettered.
+type WebhookService struct {
+	postgresRepo *repository.PostgresRepository
+	client       *http.Client
+	config       WebhookConfig
+	wake         chan struct{}
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(postgresRepo *repository.PostgresRepository, config WebhookConfig) *WebhookService {
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if !config.AllowPrivate {
+		dialer.Control = guardWebhookDial
+	}
+	return &WebhookService{
+		postgresRepo: postgresRepo,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			// No proxy: the dialer must see the webhook's own address
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			// A redirect is a failed attempt; following it would send the
+			// signed event somewhere the tenant did not register
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		config: config,
+		wake:   make(chan struct{}, config.Workers),
+	}
+}
+
+// CreateWebhook registers an endpoint for a tenant. The signing secret is
+// only returned here.
+func (s *WebhookService) CreateWebhook(ctx context.Context, tenantName string, req models.WebhookRequest) (*models.CreatedWebhook, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if err := s.checkAddress(ctx, req.URL); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhookRequest, err)
+	}
+	events, err := normalizeWebhookEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.postgresRepo.GetTenantByName(ctx, tenantName); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrTenantNotFound, tenantName)
+		}
+		return nil, fmt.Errorf("error checking tenant: %w", err)
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &models.Webhook{
+		ID:         uuid.New().String(),
+		TenantName: tenantName,
+		URL:        req.URL,
+		Events:     events,
+		Secret:     secret,
+	}
+	if err := s.postgresRepo.CreateWebhook(ctx, webhook); err != nil {
+		return nil, fmt.Errorf("unable to save webhook: %w", err)
+	}
+
+	return &models.CreatedWebhook{Webhook: *webhook, Secret: secret}, nil
+}
+
+// ListWebhooks lists the webhooks of a tenant
+func (s *WebhookService) ListWebhooks(ctx context.Context, tenantName string) ([]models.Webhook, error) {
+	return s.postgresRepo.ListWebhooks(ctx, tenantName)
+}
+
+// DeleteWebhook deletes a webhook of a tenant; its pending deliveries are
+// dropped
+func (s *WebhookService) DeleteWebhook(ctx context.Context, tenantName, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("%w: '%s'", ErrWebhookNotFound, id)
+	}
+
+	err := s.postgresRepo.DeleteWebhook(ctx, tenantName, id)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("%w: '%s'", ErrWebhookNotFound, id)
+	}
+	return err
+}
+
+// ListDeliveries returns the delivery history of a tenant, newest first,
+// optionally limited to one webhook or status
+func (s *WebhookService) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]models.WebhookDelivery, error) {
+	switch filter.Status {
+	case "", models.DeliveryStatusPending, models.DeliveryStatusDelivered, models.DeliveryStatusDead:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, delivered or dead", ErrInvalidWebhookRequest)
+	}
+	if filter.Limit < 0 || filter.Limit > maxDeliveryLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidWebhookRequest, maxDeliveryLimit)
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultDeliveryLimit
+	}
+
+	// Only show the history of the tenant's own webhooks
+	if filter.WebhookID != "" {
+		webhook, err := s.getWebhook(ctx, filter.WebhookID)
+		if err == nil && webhook.TenantName != filter.TenantName {
+			err = fmt.Errorf("%w: '%s'", ErrWebhookNotFound, filter.WebhookID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.postgresRepo.ListDeliveries(ctx, filter)
+}
+
+// Redeliver queues a dead or delivered delivery of a tenant to be sent again
+func (s *WebhookService) Redeliver(ctx context.Context, tenantName, id string) (*models.WebhookDelivery, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrDeliveryNotFound, id)
+	}
+
+	delivery, err := s.postgresRepo.RequeueDelivery(ctx, tenantName, id)
+	if err == pgx.ErrNoRows {
+		// Tell a pending delivery apart from a missing one
+		if _, getErr := s.postgresRepo.GetDelivery(ctx, tenantName, id); getErr == nil {
+			return nil, fmt.Errorf("%w: '%s'", ErrDeliveryConflict, id)
+		}
+		return nil, fmt.Errorf("%w: '%s'", ErrDeliveryNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to requeue delivery: %w", err)
+	}
+
+	s.notify()
+	return delivery, nil
+}
+
+// Publish queues an event for every webhook of the tenant subscribed to it.
+// The event has already happened by the time it is published, so failures
+// are logged rather than returned.
+func (s *WebhookService) Publish(ctx context.Context, tenantName, event string, data map[string]interface{}) {
+	payload, err := json.Marshal(models.WebhookEvent{
+		ID:         uuid.New().String(),
+		Event:      event,
+		TenantName: tenantName,
+		CreatedAt:  time.Now().UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode webhook event", "event", event, logging.KeyTenant, tenantName, "error", err)
+		return
+	}
+
+	queued, err := s.postgresRepo.QueueWebhookDeliveries(ctx, tenantName, event, payload, tracing.Inject(ctx))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to queue webhook event", "event", event, logging.KeyTenant, tenantName, "error", err)
+		return
+	}
+	if queued > 0 {
+		s.notify()
+	}
+}
+
+// notify wakes an idle dispatcher, if any
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start launches the dispatchers. They stop when ctx is cancelled.
+func (s *WebhookService) Start(ctx context.Context) {
+	for i := 0; i < s.config.Workers; i++ {
+		go s.dispatcher(ctx)
+	}
+	slog.Info("webhook dispatchers started", "workers", s.config.Workers)
+}
+
+// dispatcher claims and sends due deliveries until ctx is cancelled
+func (s *WebhookService) dispatcher(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	// The lease outlives an attempt, so a delivery is only claimed twice
+	// when its dispatcher died
+	lease := s.config.Timeout + time.Minute
+
+	for {
+		// Drain all due deliveries before going idle
+		for {
+			delivery, err := s.postgresRepo.ClaimNextDelivery(ctx, lease)
+			if err != nil {
+				if err != pgx.ErrNoRows && ctx.Err() == nil {
+					slog.ErrorContext(ctx, "failed to claim webhook delivery", "error", err)
+				}
+				break
+			}
+			s.deliver(ctx, delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver makes one attempt to send a claimed delivery and records the
+// outcome, scheduling a retry with exponential backoff or dead-lettering it
+// after MaxAttempts
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	webhook, err := s.postgresRepo.GetWebhook(ctx, delivery.WebhookID)
+	if err != nil {
+		// A deleted webhook takes its deliveries with it
+		if err != pgx.ErrNoRows {
+			slog.ErrorContext(ctx, "failed to load webhook", "webhook_id", delivery.WebhookID, "error", err)
+		}
+		return
+	}
+	ctx = logging.With(ctx,
+		logging.KeyTenant, webhook.TenantName,
+		"webhook_id", webhook.ID,
+		"delivery_id", delivery.ID,
+		"event", delivery.Event,
+	)
+
+	// Continue the trace the event was raised in
+	sendCtx, span := tracing.StartClient(tracing.Extract(ctx, delivery.TraceContext), "webhook.deliver",
+		attribute.String("webhook.id", webhook.ID),
+		attribute.String("webhook.delivery", delivery.ID),
+		attribute.String("webhook.event", delivery.Event),
+		attribute.Int("webhook.attempt", delivery.Attempts),
+	)
+	statusCode, err := s.send(sendCtx, webhook, delivery)
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	tracing.End(span, err)
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	now := time.Now()
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryStatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		slog.InfoContext(sendCtx, "webhook delivered", "attempt", delivery.Attempts, "status", statusCode)
+	case delivery.Attempts < s.config.MaxAttempts:
+		next := now.Add(s.retryDelay(delivery.Attempts))
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = &next
+		slog.WarnContext(sendCtx, "webhook delivery failed, retrying",
+			"attempt", delivery.Attempts, "status", statusCode, "next_attempt_at", next, "error", err)
+	default:
+		delivery.Status = models.DeliveryStatusDead
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = nil
+		slog.ErrorContext(sendCtx, "webhook delivery dead",
+			"attempts", delivery.Attempts, "status", statusCode, "error", err)
+	}
+
+	if err := s.postgresRepo.UpdateDelivery(ctx, delivery); err != nil {
+		// The lease expires and the delivery is attempted again
+		slog.ErrorContext(ctx, "failed to update webhook delivery", "error", err)
+	}
+}
+
+// send posts a delivery to its webhook, returning the response status. Only
+// 2xx responses count as delivered.
+func (s *WebhookService) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	// The host may resolve elsewhere than when the webhook was registered
+	if err := s.checkAddress(ctx, webhook.URL); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("unable to build request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pdf-ingestion-webhooks/1.0")
+	req.Header.Set("X-Webhook-Id", webhook.ID)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID)
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", SignWebhookPayload(webhook.Secret, timestamp, delivery.Payload))
+	tracing.InjectHeader(ctx, req.Header)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// The body is not kept: the delivery history is readable by the tenant,
+	// and must not reveal what an endpoint returned
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseDrain))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// checkAddress refuses webhook URLs leading to non-public addresses, unless
+// private addresses are allowed
+func (s *WebhookService) checkAddress(ctx context.Context, rawURL string) error {
+	if s.config.AllowPrivate {
+		return nil
+	}
+	return checkWebhookAddress(ctx, rawURL)
+}
+
+// retryDelay returns the backoff after the given number of failed attempts
+func (s *WebhookService) retryDelay(attempts int) time.Duration {
+	delay := s.config.RetryBase
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// getWebhook retrieves a webhook by ID
+func (s *WebhookService) getWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrWebhookNotFound, id)
+	}
+
+	webhook, err := s.postgresRepo.GetWebhook(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("%w: '%s'", ErrWebhookNotFound, id)
+		}
+		return nil, fmt.Errorf("unable to get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// SignWebhookPayload returns the X-Webhook-Signature value of a payload:
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret.
+// Receivers recompute it to verify that a delivery is authentic and recent.
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP(S) URL
+func validateWebhookURL(rawURL string) error {
+	if rawURL == "" {
+		return fmt.Errorf("%w: url is required", ErrInvalidWebhookRequest)
+	}
+	if len(rawURL) > 2048 {
+		return fmt.Errorf("%w: url must be at most 2048 characters", ErrInvalidWebhookRequest)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhookRequest)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhookRequest)
+	}
+	return nil
+}
+
+// normalizeWebhookEvents checks and deduplicates subscribed events. No events
+// subscribes to all of them.
+func normalizeWebhookEvents(events []string) ([]string, error) {
+	if len(events) == 0 {
+		return append([]string(nil), models.WebhookEvents...), nil
+	}
+
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, event := range events {
+		known := false
+		for _, candidate := range models.WebhookEvents {
+			known = known || candidate == event
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: unknown event '%s'", ErrInvalidWebhookRequest, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+	return normalized, nil
+}
+
+// generateWebhookSecret returns a new signing secret with 256 bits of entropy
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("unable to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(secret), nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bacancy/droadmap/internal/models"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"fd00:ec2::254", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := publicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+				t.Errorf("publicAddr(%s) = %v, want %v", tt.addr, got, tt.public)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookAddress(t *testing.T) {
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"https://93.184.216.34/hook", false},
+		{"http://127.0.0.1:8080/hook", true},
+		{"http://[::1]/hook", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://localhost/hook", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := checkWebhookAddress(context.Background(), tt.url)
+			if got := errors.Is(err, ErrWebhookAddressBlocked); got != tt.blocked {
+				t.Errorf("checkWebhookAddress(%s) = %v, want blocked %v", tt.url, err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestWebhookSendBlocksPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("internal secret"))
+	}))
+	defer server.Close()
+
+	webhook := &models.Webhook{ID: "w1", URL: server.URL, Secret: "whsec_test"}
+	delivery := &models.WebhookDelivery{ID: "d1", Event: models.EventDocumentIngested, Payload: []byte(`{}`)}
+
+	service := NewWebhookService(nil, WebhookConfig{Timeout: time.Second})
+	if _, err := service.send(context.Background(), webhook, delivery); !errors.Is(err, ErrWebhookAddressBlocked) {
+		t.Errorf("send to %s: got %v, want blocked", server.URL, err)
+	}
+
+	// The dialer refuses the address even when the URL check is bypassed,
+	// as after DNS rebinding
+	req, _ := http.NewRequest(http.MethodPost, server.URL, nil)
+	if _, err := service.client.Do(req); !errors.Is(err, ErrWebhookAddressBlocked) {
+		t.Errorf("dial %s: got %v, want blocked", server.URL, err)
+	}
+
+	// Allowed for local development, without keeping the response body
+	service = NewWebhookService(nil, WebhookConfig{Timeout: time.Second, AllowPrivate: true})
+	status, err := service.send(context.Background(), webhook, delivery)
+	if status != http.StatusInternalServerError || err == nil {
+		t.Fatalf("send: got %d, %v", status, err)
+	}
+	if want := "endpoint responded with status 500"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Expected values computed independently, e.g. with
+	// printf '1700000000.<body>' | openssl dgst -sha256 -hmac whsec_test
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"payload", "whsec_test", "1700000000", `{"event":"document.ingested"}`, "sha256=362a46dcaa58902983fda6127048766ab2eac44e42fc32e62f89405686e0faf7"},
+		{"empty body", "whsec_test", "1700000000", "", "sha256=5967f3c560522fa40cf2876ebc3c3a08551dd6959aaade3b413460591895bdcc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignWebhookPayload(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("SignWebhookPayload() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// The timestamp is part of the signed content
+	body := []byte(`{"event":"document.ingested"}`)
+	if SignWebhookPayload("whsec_test", "1700000000", body) == SignWebhookPayload("whsec_test", "1700000001", body) {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	service := NewWebhookService(nil, WebhookConfig{RetryBase: 30 * time.Second})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, maxRetryDelay},
+		{1000, maxRetryDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempts), func(t *testing.T) {
+			if got := service.retryDelay(tt.attempts); got != tt.want {
+				t.Errorf("retryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxStatementLength bounds the SQL recorded on a span
+const maxStatementLength = 2048
+
+// PostgresTracer records a span for every query made within a trace. Only
+// the SQL is recorded, never its arguments.
+type PostgresTracer struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (PostgresTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !traced(ctx) {
+		return ctx
+	}
+
+	sql := strings.Join(strings.Fields(data.SQL), " ")
+	operation, _, _ := strings.Cut(sql, " ")
+	if len(sql) > maxStatementLength {
+		sql = strings.ToValidUTF8(sql[:maxStatementLength], "")
+	}
+
+	ctx, _ = StartClient(ctx, "postgres "+strings.ToUpper(operation),
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", strings.ToUpper(operation)),
+		attribute.String("db.statement", sql),
+	)
+	return ctx
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (PostgresTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	// No rows is an answer, not a failure
+	err := data.Err
+	if err == pgx.ErrNoRows {
+		err = nil
+	}
+	End(span, err)
+}
+
+// MongoMonitor returns a command monitor recording a span for every MongoDB
+// command made within a trace. Command documents are not recorded since they
+// carry document contents.
+func MongoMonitor() *event.CommandMonitor {
+	// Spans in flight, by request ID
+	var spans sync.Map
+
+	finish := func(requestID int64, err error) {
+		if value, ok := spans.LoadAndDelete(requestID); ok {
+			End(value.(trace.Span), err)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if !traced(ctx) {
+				return
+			}
+			attrs := []attribute.KeyValue{
+				attribute.String("db.system", "mongodb"),
+				attribute.String("db.name", e.DatabaseName),
+				attribute.String("db.operation", e.CommandName),
+			}
+			if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+				attrs = append(attrs, attribute.String("db.mongodb.collection", collection))
+			}
+			_, span := StartClient(ctx, "mongo "+e.CommandName, attrs...)
+			spans.Store(e.RequestID, span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.RequestID, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.RequestID, commandError(e.Failure))
+		},
+	}
+}
+
+// commandError carries the failure message of a MongoDB command
+type commandError string
+
+func (e commandError) Error() string {
+	return string(e)
+}
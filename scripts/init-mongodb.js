@@ -35,9 +35,10 @@ appDb.createCollection("documents", {
                 file_name: { bsonType: "string" },
                 file_size: { bsonType: "int" },
                 extracted_text: { bsonType: "string" },
+                pages: { bsonType: "array" },
+                metadata: { bsonType: "object" },
                 summary: { bsonType: "string" },
                 storage_path: { bsonType: "string" },
-                storage_url: { bsonType: "string" },
                 uploaded_at: { bsonType: "date" },
                 is_deleted: { bsonType: "bool" },
                 deleted_at: { bsonType: ["date", "null"] }
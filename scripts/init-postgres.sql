@@ -4,12 +4,18 @@
 CREATE TABLE IF NOT EXISTS tenants (
     id SERIAL PRIMARY KEY,
     tenant_name VARCHAR(255) UNIQUE NOT NULL,
+    display_name VARCHAR(255),
     db_host VARCHAR(500) NOT NULL,
     db_port INTEGER NOT NULL DEFAULT 27017,
     db_name VARCHAR(255) NOT NULL,
-    status VARCHAR(50) DEFAULT 'active',
+    status VARCHAR(50) DEFAULT 'active', -- provisioning, active, failed, deleted, purging, purged
+    settings JSONB NOT NULL DEFAULT '{}',
+    quotas JSONB NOT NULL DEFAULT '{}',
+    provision_attempts INTEGER NOT NULL DEFAULT 0,
+    provision_error TEXT,
     is_deleted BOOLEAN DEFAULT FALSE,
     deleted_at TIMESTAMP,
+    purged_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -18,13 +24,58 @@ CREATE TABLE IF NOT EXISTS tenants (
 CREATE INDEX IF NOT EXISTS idx_tenant_name ON tenants(tenant_name);
 CREATE INDEX IF NOT EXISTS idx_is_deleted ON tenants(is_deleted);
 
--- Create users table (optional)
+-- Create ingest jobs table (asynchronous upload processing)
+CREATE TABLE IF NOT EXISTS ingest_jobs (
+    id UUID PRIMARY KEY,
+    tenant_name VARCHAR(255) NOT NULL,
+    file_name VARCHAR(1024) NOT NULL,
+    file_size BIGINT NOT NULL,
+    storage_path VARCHAR(1024) NOT NULL,
+    document_id VARCHAR(24) NOT NULL,
+    content_hash CHAR(64),
+    new_version BOOLEAN NOT NULL DEFAULT FALSE,
+    quarantine JSONB,
+    status VARCHAR(50) NOT NULL DEFAULT 'queued',
+    steps JSONB NOT NULL DEFAULT '[]',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    run_after TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    trace_context JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_ingest_jobs_status ON ingest_jobs(status, run_after);
+CREATE INDEX IF NOT EXISTS idx_ingest_jobs_tenant ON ingest_jobs(tenant_name, created_at);
+CREATE INDEX IF NOT EXISTS idx_ingest_jobs_content_hash ON ingest_jobs(tenant_name, content_hash);
+
+-- Create API keys table (only SHA-256 hashes of keys are stored)
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    scope VARCHAR(50) NOT NULL,
+    tenant_name VARCHAR(255),
+    key_prefix VARCHAR(32) NOT NULL,
+    key_hash CHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys(tenant_name);
+
+-- Create users table (roles: viewer, uploader, tenant-admin, platform-admin;
+-- platform admins have no tenant)
 CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
-    tenant_id INTEGER NOT NULL REFERENCES tenants(id),
+    tenant_id INTEGER REFERENCES tenants(id),
     email VARCHAR(255) UNIQUE NOT NULL,
     name VARCHAR(255),
-    role VARCHAR(50) DEFAULT 'user',
+    role VARCHAR(50) DEFAULT 'viewer',
+    disabled_at TIMESTAMP,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -33,20 +84,90 @@ CREATE TABLE IF NOT EXISTS users (
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 CREATE INDEX IF NOT EXISTS idx_users_tenant_id ON users(tenant_id);
 
--- Create audit log table
+-- API keys issued for a user act with the user's role
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id);
+
+-- Create audit log table (every mutating API action, with its actor and diff)
 CREATE TABLE IF NOT EXISTS audit_logs (
-    id SERIAL PRIMARY KEY,
-    tenant_id INTEGER REFERENCES tenants(id),
+    id BIGSERIAL PRIMARY KEY,
+    tenant_name VARCHAR(255),
     action VARCHAR(255),
     resource_type VARCHAR(100),
     resource_id VARCHAR(255),
+    actor VARCHAR(255),
+    actor_role VARCHAR(50),
+    api_key_id VARCHAR(36),
+    request_id VARCHAR(128),
+    diff JSONB,
     details JSONB,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Create indexes for audit logs
-CREATE INDEX IF NOT EXISTS idx_audit_logs_tenant_id ON audit_logs(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_tenant_name ON audit_logs(tenant_name, id);
 CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at);
 
+-- Create webhook table (tenant endpoints subscribed to events, with their signing secret)
+CREATE TABLE IF NOT EXISTS webhooks (
+    id UUID PRIMARY KEY,
+    tenant_name VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    events TEXT[] NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_tenant ON webhooks(tenant_name);
+
+-- Create webhook delivery table (one row per event and webhook, retried until delivered or dead)
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    tenant_name VARCHAR(255) NOT NULL,
+    event VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    last_status_code INTEGER,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    trace_context JSONB
+);
+
+-- Create indexes for webhook deliveries
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_tenant ON webhook_deliveries(tenant_name, status, created_at);
+
+-- Create outbox table (events committed with their changes, relayed to the event bus)
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID UNIQUE NOT NULL,
+    tenant_name VARCHAR(255) NOT NULL,
+    sequence BIGINT NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    data JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP,
+    UNIQUE (tenant_name, sequence)
+);
+
+-- Create indexes for the outbox
+CREATE INDEX IF NOT EXISTS idx_outbox_events_unpublished ON outbox_events(id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_events_published_at ON outbox_events(published_at);
+
+-- Create outbox sequence table (last event sequence number per tenant)
+CREATE TABLE IF NOT EXISTS outbox_sequences (
+    tenant_name VARCHAR(255) PRIMARY KEY,
+    last_sequence BIGINT NOT NULL
+);
+
 -- Grant permissions
 GRANT ALL PRIVILEGES ON DATABASE master_db TO postgres;
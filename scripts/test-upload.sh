@@ -5,6 +5,7 @@
 API_URL="${API_URL:-http://localhost:8080/api/v1/upload}"
 TENANT_NAME="${TENANT_NAME:-test_company}"
 PDF_FILE="${PDF_FILE:-sample.pdf}"
+API_KEY="${API_KEY:-$ADMIN_API_KEY}"
 
 echo "🧪 Testing PDF Upload API"
 echo "=========================="
@@ -13,6 +14,11 @@ echo "Tenant: $TENANT_NAME"
 echo "PDF File: $PDF_FILE"
 echo ""
 
+if [ -z "$API_KEY" ]; then
+    echo "❌ Error: set API_KEY (or ADMIN_API_KEY) to authenticate."
+    exit 1
+fi
+
 # Check if PDF file exists
 if [ ! -f "$PDF_FILE" ]; then
     echo "❌ Error: PDF file '$PDF_FILE' not found!"
@@ -22,6 +28,7 @@ fi
 
 echo "📤 Uploading PDF..."
 response=$(curl -s -X POST "$API_URL" \
+    -H "Authorization: Bearer $API_KEY" \
     -F "tenantName=$TENANT_NAME" \
     -F "pdf=@$PDF_FILE" \
     -w "\n%{http_code}")
@@ -35,9 +42,13 @@ echo "HTTP Status: $http_code"
 echo "Response:"
 echo "$body" | jq '.' 2>/dev/null || echo "$body"
 
-if [ "$http_code" = "200" ]; then
+if [ "$http_code" = "202" ]; then
     echo ""
-    echo "✅ Upload successful!"
+    echo "✅ Upload accepted!"
+    job_id=$(echo "$body" | jq -r '.data.job_id' 2>/dev/null)
+    if [ -n "$job_id" ] && [ "$job_id" != "null" ]; then
+        echo "Track progress: curl -H \"Authorization: Bearer \$API_KEY\" ${API_URL%/upload}/jobs/$job_id"
+    fi
 else
     echo ""
     echo "❌ Upload failed!"